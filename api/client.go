@@ -16,20 +16,26 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ollama/ollama/auth"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/security/certs"
+	"github.com/ollama/ollama/security/session"
 	"github.com/ollama/ollama/version"
 )
 
@@ -38,6 +44,11 @@ import (
 type Client struct {
 	base *url.URL
 	http *http.Client
+
+	mu          sync.Mutex
+	session     *session.Key // encrypted session, opened on first use
+	plaintext   bool         // the server doesn't support encrypted sessions
+	established bool         // a session has been opened with the server before
 }
 
 func checkError(resp *http.Response, body []byte) error {
@@ -48,6 +59,13 @@ func checkError(resp *http.Response, body []byte) error {
 	if resp.StatusCode == http.StatusUnauthorized {
 		authError := AuthorizationError{StatusCode: resp.StatusCode}
 		json.Unmarshal(body, &authError)
+
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &errorResponse) == nil {
+			authError.Status = errorResponse.Error
+		}
 		return authError
 	}
 
@@ -69,15 +87,61 @@ func checkError(resp *http.Response, body []byte) error {
 //
 //	<scheme>://<host>:<port>
 //
+// or, for a server listening on a Unix socket:
+//
+//	unix://<path>
+//
 // If the variable is not specified, a default ollama host and port will be
-// used.
+// used. The API key in SECLLAMA_API_KEY, if set, is sent with every request.
+//
+// Servers reached over https are verified against the system's CAs, or the
+// CAs in SECLLAMA_TLS_CA, unless SECLLAMA_TLS_FINGERPRINT pins the
+// fingerprint of the server's certificate or its CA. SECLLAMA_TLS_CLIENT_CERT
+// and SECLLAMA_TLS_CLIENT_KEY hold the certificate presented to servers
+// requiring one.
 func ClientFromEnvironment() (*Client, error) {
+	base := envconfig.Host()
+	if base.Scheme == "unix" {
+		return &Client{
+			base: &url.URL{Scheme: "http", Host: "localhost"},
+			http: unixSocketClient(base.Path),
+		}, nil
+	}
+
+	tlsConfig, err := certs.ClientConfig(envconfig.TLSFingerprint(), envconfig.TLSCA(), envconfig.TLSClientCert(), envconfig.TLSClientKey())
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	client := http.DefaultClient
+	if tlsConfig != nil {
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+	}
+
 	return &Client{
-		base: envconfig.Host(),
-		http: http.DefaultClient,
+		base: base,
+		http: client,
 	}, nil
 }
 
+// unixSocketClient returns an HTTP client sending every request over the Unix
+// socket at path
+func unixSocketClient(path string) *http.Client {
+	var dialer net.Dialer
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
 func NewClient(base *url.URL, http *http.Client) *Client {
 	return &Client{
 		base: base,
@@ -109,40 +173,9 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		if err != nil {
 			return err
 		}
-
-		reqBody = bytes.NewReader(data)
-	}
-
-	requestURL := c.base.JoinPath(path)
-
-	var token string
-	if envconfig.UseAuth() || c.base.Hostname() == "ollama.com" {
-		now := strconv.FormatInt(time.Now().Unix(), 10)
-		chal := fmt.Sprintf("%s,%s?ts=%s", method, path, now)
-		token, err = getAuthorizationToken(ctx, chal)
-		if err != nil {
-			return err
-		}
-
-		q := requestURL.Query()
-		q.Set("ts", now)
-		requestURL.RawQuery = q.Encode()
-	}
-
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/json")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
-
-	if token != "" {
-		request.Header.Set("Authorization", token)
 	}
 
-	respObj, err := c.http.Do(request)
+	respObj, sealed, err := c.send(ctx, method, path, reqBody, data, "application/json")
 	if err != nil {
 		return err
 	}
@@ -153,6 +186,13 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		return err
 	}
 
+	// responses to HEAD requests have no body to seal
+	if sealed != nil && method != http.MethodHead {
+		if respBody, err = sealed.OpenAll(respBody); err != nil {
+			return err
+		}
+	}
+
 	if err := checkError(respObj, respBody); err != nil {
 		return err
 	}
@@ -165,19 +205,36 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 	return nil
 }
 
-const maxBufferSize = 512 * format.KiloByte
+// send makes a request to path with either body or JSON encoded data. Data is
+// sealed in the client's encrypted session if there is one, and the returned
+// stream opens the response; it is nil for plaintext responses. A request
+// rejected because its session expired is retried once in a new session.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, data []byte, accept string) (*http.Response, *session.Stream, error) {
+	for retry := true; ; retry = false {
+		var key *session.Key
+		if body == nil {
+			var err error
+			if key, err = c.openSession(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
 
-func (c *Client) stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
-	var buf io.Reader
-	if data != nil {
-		bts, err := json.Marshal(data)
+		resp, sealed, err := c.sendOnce(ctx, method, path, body, data, accept, key)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		if key != nil && retry && resp.StatusCode == http.StatusUnauthorized && resp.Header.Get(session.HeaderError) != "" {
+			resp.Body.Close()
+			c.closeSession(key)
+			continue
 		}
 
-		buf = bytes.NewBuffer(bts)
+		return resp, sealed, nil
 	}
+}
 
+func (c *Client) sendOnce(ctx context.Context, method, path string, body io.Reader, data []byte, accept string, key *session.Key) (*http.Response, *session.Stream, error) {
 	requestURL := c.base.JoinPath(path)
 
 	var token string
@@ -187,7 +244,7 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		chal := fmt.Sprintf("%s,%s?ts=%s", method, path, now)
 		token, err = getAuthorizationToken(ctx, chal)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		q := requestURL.Query()
@@ -195,20 +252,161 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		requestURL.RawQuery = q.Encode()
 	}
 
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
+	contentType := "application/json"
+	var requestID string
+	if key != nil {
+		requestID = session.NewRequestID()
+		if data != nil {
+			stream := key.Stream(session.Request, requestID)
+			data = append(append(stream.Seal(data), '\n'), append(stream.SealEnd(), '\n')...)
+			contentType = session.ContentType
+		}
+	}
+
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/x-ndjson")
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Accept", accept)
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	if key != nil {
+		request.Header.Set(session.HeaderSession, key.ID())
+		request.Header.Set(session.HeaderRequest, requestID)
+	}
+
+	resp, err := c.http.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key == nil {
+		return resp, nil, nil
+	}
+
+	if resp.Header.Get(session.HeaderSession) != key.ID() {
+		// errors raised before the session is checked are never sealed, so
+		// their bodies can't be authenticated
+		if resp.StatusCode < http.StatusBadRequest {
+			resp.Body.Close()
+			return nil, nil, errors.New("server sent an unencrypted response to an encrypted request")
+		}
+		slog.Warn("server sent an unencrypted error response to an encrypted request", "path", path, "status", resp.StatusCode)
+		return resp, nil, nil
+	}
+
+	return resp, key.Stream(session.Response, requestID), nil
+}
+
+// openSession returns the client's encrypted session, opening it with a key
+// exchange on first use. It returns nil if transport encryption is off, or if
+// the server doesn't support it and SECLLAMA_TRANSPORT_ENCRYPTION isn't "required".
+// A server that has opened a session before is never taken to not support
+// them, since anyone on the path can answer a handshake with a 404.
+func (c *Client) openSession(ctx context.Context) (*session.Key, error) {
+	mode := envconfig.TransportEncryption()
+	if mode == "off" || c.base.Hostname() == "ollama.com" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil {
+		return c.session, nil
+	} else if c.plaintext && mode != "required" {
+		return nil, nil
+	}
+
+	key, err := c.handshake(ctx)
+	if errors.Is(err, errSessionUnsupported) && mode != "required" && !c.established {
+		slog.Warn("server does not support encrypted sessions, sending requests unencrypted", "host", c.base.Host)
+		c.plaintext = true
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted session: %w", err)
+	}
+
+	c.session, c.established = key, true
+	return key, nil
+}
+
+// closeSession forgets key, so the next request opens a new session
+func (c *Client) closeSession(key *session.Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == key {
+		c.session = nil
+	}
+}
+
+var errSessionUnsupported = errors.New("server does not support encrypted sessions")
+
+// handshake performs the X25519 key exchange opening a session
+func (c *Client) handshake(ctx context.Context) (*session.Key, error) {
+	private, err := session.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	public := private.PublicKey().Bytes()
+	data, err := json.Marshal(session.HandshakeRequest{PublicKey: public})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := c.sendOnce(ctx, http.MethodPost, session.Path, nil, data, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil, errSessionUnsupported
 	}
 
-	response, err := c.http.Do(request)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkError(resp, body); err != nil {
+		return nil, err
+	}
+
+	var hr session.HandshakeResponse
+	if err := json.Unmarshal(body, &hr); err != nil {
+		return nil, err
+	}
+
+	return session.DeriveKey(hr.SessionID, private, public, hr.PublicKey)
+}
+
+const maxBufferSize = 512 * format.KiloByte
+
+func (c *Client) stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
+	var bts []byte
+	if data != nil {
+		var err error
+		if bts, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+
+	response, sealed, err := c.send(ctx, method, path, nil, bts, "application/x-ndjson")
 	if err != nil {
 		return err
 	}
@@ -225,6 +423,14 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		}
 
 		bts := scanner.Bytes()
+		if sealed != nil {
+			if bts, err = sealed.Open(bts); errors.Is(err, io.EOF) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+
 		if err := json.Unmarshal(bts, &errorResponse); err != nil {
 			return fmt.Errorf("unmarshal: %w", err)
 		}
@@ -232,7 +438,7 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		if response.StatusCode == http.StatusUnauthorized {
 			return AuthorizationError{
 				StatusCode: response.StatusCode,
-				Status:     response.Status,
+				Status:     cmp.Or(errorResponse.Error, response.Status),
 				SigninURL:  errorResponse.SigninURL,
 			}
 		} else if response.StatusCode >= http.StatusBadRequest {
@@ -252,6 +458,12 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		}
 	}
 
+	if sealed != nil {
+		// a stream cut short at a line boundary is only told apart from a
+		// finished one by its missing end record
+		return sealed.Done()
+	}
+
 	return nil
 }
 
@@ -370,6 +582,26 @@ func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	return &lr, nil
 }
 
+// Security reports which security mechanisms are in effect on the server. The
+// server launches a sandboxed probe runner to verify its isolation.
+func (c *Client) Security(ctx context.Context) (*SecurityResponse, error) {
+	var resp SecurityResponse
+	if err := c.do(ctx, http.MethodGet, "/api/security", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Usage reports usage of the server against its rate limits and token quota:
+// the caller's own, or every caller's when called with an admin API key.
+func (c *Client) Usage(ctx context.Context) (*UsageResponse, error) {
+	var resp UsageResponse
+	if err := c.do(ctx, http.MethodGet, "/api/usage", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Copy copies a model - creating a model with another name from an existing
 // model.
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
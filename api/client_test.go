@@ -7,7 +7,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
+
+	"github.com/ollama/ollama/security/session"
 )
 
 func TestClientFromEnvironment(t *testing.T) {
@@ -262,3 +265,49 @@ func TestClientDo(t *testing.T) {
 		})
 	}
 }
+
+func TestClientSessionDowngrade(t *testing.T) {
+	t.Setenv("SECLLAMA_TRANSPORT_ENCRYPTION", "auto")
+
+	store := session.NewStore(session.DefaultTTL)
+	var unsupported atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != session.Path || unsupported.Load() {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req session.HandshakeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		resp, err := store.Handshake(req)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	client := NewClient(&url.URL{Scheme: "http", Host: ts.Listener.Addr().String()}, http.DefaultClient)
+
+	key, err := client.openSession(t.Context())
+	if err != nil || key == nil {
+		t.Fatalf("expected a session, got %v, %v", key, err)
+	}
+
+	// the session expires, and the next handshake is answered with a 404
+	client.closeSession(key)
+	unsupported.Store(true)
+
+	if key, err := client.openSession(t.Context()); err == nil {
+		t.Fatalf("expected an error instead of falling back to plaintext, got session %v", key)
+	}
+
+	// a server that never supported sessions is still used in plaintext
+	fresh := NewClient(&url.URL{Scheme: "http", Host: ts.Listener.Addr().String()}, http.DefaultClient)
+	if key, err := fresh.openSession(t.Context()); err != nil || key != nil {
+		t.Fatalf("expected plaintext, got %v, %v", key, err)
+	}
+}
@@ -365,6 +365,15 @@ type ChatResponse struct {
 	// DoneReason is the reason the model stopped generating text.
 	DoneReason string `json:"done_reason,omitempty"`
 
+	// Redactions counts the values of each kind of personal data redacted
+	// from the request before it reached the model. It is set on the final
+	// response.
+	Redactions map[string]int `json:"redactions,omitempty"`
+
+	// PolicyMatches counts the matches of each output policy rule in the
+	// response. It is set on the final response.
+	PolicyMatches map[string]int `json:"policy_matches,omitempty"`
+
 	DebugInfo *DebugInfo `json:"_debug_info,omitempty"`
 
 	Metrics
@@ -513,6 +522,10 @@ type CreateRequest struct {
 	// Info is a map of additional information for the model
 	Info map[string]any `json:"info,omitempty"`
 
+	// EncryptLayers stores the template, system prompt, parameters and
+	// messages of the model encrypted with the server's key.
+	EncryptLayers bool `json:"encrypt_layers,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 	// Deprecated: use Quantize instead
@@ -611,6 +624,49 @@ type ProcessResponse struct {
 	Models []ProcessModelResponse `json:"models"`
 }
 
+// SecurityResponse is the response from [Client.Security]. It reports the
+// server's security posture as measured, not as configured.
+type SecurityResponse struct {
+	KeyStore string          `json:"keystore,omitempty"`
+	Checks   []SecurityCheck `json:"checks"`
+	Passed   bool            `json:"passed"`
+}
+
+// SecurityCheck is a single check in [SecurityResponse]. Category is one of
+// "keystore", "encryption", "sandbox" or "probe"; probes attempt to escape a
+// sandboxed runner and pass if they were blocked.
+type SecurityCheck struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// UsageResponse is the response from [Client.Usage]
+type UsageResponse struct {
+	Callers []CallerUsage `json:"callers"`
+}
+
+// CallerUsage is the usage of one caller of the server against its limits.
+// Caller is "key:<id>" for requests with an API key, "uid:<uid>" over the
+// Unix socket and "addr:<ip>" otherwise. Limits of zero mean no limit.
+type CallerUsage struct {
+	Caller string `json:"caller"`
+	// Requests counts the requests of the last minute
+	Requests   int `json:"requests"`
+	Concurrent int `json:"concurrent"`
+	// Tokens counts the prompt and generated tokens of the last hour
+	Tokens int         `json:"tokens"`
+	Limits UsageLimits `json:"limits"`
+}
+
+// UsageLimits are the limits in [CallerUsage]
+type UsageLimits struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	Concurrent        int `json:"concurrent,omitempty"`
+	TokensPerHour     int `json:"tokens_per_hour,omitempty"`
+}
+
 // ListModelResponse is a single model description in [ListResponse].
 type ListModelResponse struct {
 	Name        string       `json:"name"`
@@ -670,6 +726,15 @@ type GenerateResponse struct {
 	// can be sent in the next request to keep a conversational memory.
 	Context []int `json:"context,omitempty"`
 
+	// Redactions counts the values of each kind of personal data redacted
+	// from the request before it reached the model. It is set on the final
+	// response.
+	Redactions map[string]int `json:"redactions,omitempty"`
+
+	// PolicyMatches counts the matches of each output policy rule in the
+	// response. It is set on the final response.
+	PolicyMatches map[string]int `json:"policy_matches,omitempty"`
+
 	Metrics
 
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
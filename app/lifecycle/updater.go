@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/security"
 	"github.com/ollama/ollama/version"
 )
 
@@ -43,6 +44,11 @@ func IsNewReleaseAvailable(ctx context.Context) (bool, UpdateResponse) {
 		return false, updateResp
 	}
 
+	if err := security.CheckOutbound(requestURL.Host); err != nil {
+		slog.Debug("skipping update check", "error", err)
+		return false, updateResp
+	}
+
 	query := requestURL.Query()
 	query.Add("os", runtime.GOOS)
 	query.Add("arch", runtime.GOARCH)
@@ -105,6 +111,14 @@ func IsNewReleaseAvailable(ctx context.Context) (bool, UpdateResponse) {
 }
 
 func DownloadNewRelease(ctx context.Context, updateResp UpdateResponse) error {
+	u, err := url.Parse(updateResp.UpdateURL)
+	if err != nil {
+		return err
+	}
+	if err := security.CheckOutbound(u.Host); err != nil {
+		return err
+	}
+
 	// Do a head first to check etag info
 	req, err := http.NewRequestWithContext(ctx, http.MethodHead, updateResp.UpdateURL, nil)
 	if err != nil {
@@ -200,6 +214,13 @@ func cleanupOldDownloads() {
 }
 
 func StartBackgroundUpdaterChecker(ctx context.Context, cb func(string) error) {
+	if u, err := url.Parse(UpdateCheckURLBase); err == nil {
+		if err := security.CheckOutbound(u.Host); err != nil {
+			slog.Info("automatic updates disabled", "error", err)
+			return
+		}
+	}
+
 	go func() {
 		// Don't blast an update message immediately after startup
 		// time.Sleep(30 * time.Second)
@@ -2,7 +2,6 @@ package tray
 
 import (
 	"fmt"
-	"runtime"
 
 	"github.com/ollama/ollama/app/assets"
 	"github.com/ollama/ollama/app/tray/commontray"
@@ -18,20 +18,29 @@ import (
 
 const defaultPrivateKey = "id_ed25519"
 
-func GetPublicKey() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+// LoadPrivateKey reads the ssh private key at path, or the default key in
+// ~/.ollama if path is empty
+func LoadPrivateKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(home, ".ollama", defaultPrivateKey)
 	}
 
-	keyPath := filepath.Join(home, ".ollama", defaultPrivateKey)
-	privateKeyFile, err := os.ReadFile(keyPath)
+	privateKeyFile, err := os.ReadFile(path)
 	if err != nil {
 		slog.Info(fmt.Sprintf("Failed to load private key: %v", err))
-		return "", err
+		return nil, err
 	}
 
-	privateKey, err := ssh.ParsePrivateKey(privateKeyFile)
+	return ssh.ParsePrivateKey(privateKeyFile)
+}
+
+func GetPublicKey() (string, error) {
+	privateKey, err := LoadPrivateKey("")
 	if err != nil {
 		return "", err
 	}
@@ -51,19 +60,7 @@ func NewNonce(r io.Reader, length int) (string, error) {
 }
 
 func Sign(ctx context.Context, bts []byte) (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-
-	keyPath := filepath.Join(home, ".ollama", defaultPrivateKey)
-	privateKeyFile, err := os.ReadFile(keyPath)
-	if err != nil {
-		slog.Info(fmt.Sprintf("Failed to load private key: %v", err))
-		return "", err
-	}
-
-	privateKey, err := ssh.ParsePrivateKey(privateKeyFile)
+	privateKey, err := LoadPrivateKey("")
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/security/audit"
+)
+
+func auditLogPath() (string, error) {
+	path := envconfig.AuditLog()
+	if path == "" {
+		return "", errors.New("auditing is disabled (SECLLAMA_AUDIT_LOG=off)")
+	}
+	return path, nil
+}
+
+// AuditVerifyHandler checks the hash chain of the audit log, failing if any
+// record was edited, removed or reordered
+func AuditVerifyHandler(cmd *cobra.Command, _ []string) error {
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+
+	mgr, err := security.GetManager()
+	if err != nil {
+		return err
+	}
+
+	summary, err := audit.Verify(path, mgr)
+	if err != nil {
+		return err
+	}
+
+	if summary.Records == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: no records\n", path)
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s: %d records verified, %s to %s\n", path, summary.Records,
+		summary.First.Local().Format(time.RFC3339), summary.Last.Local().Format(time.RFC3339))
+	return nil
+}
+
+// parseSince accepts a duration before now, e.g. "24h", or a date or time in
+// RFC 3339 format
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a duration like 24h or a date like 2006-01-02", s)
+}
+
+// AuditShowHandler decrypts and prints audit records. Records are verified as
+// they are read, and the command fails at the first one that doesn't check out.
+func AuditShowHandler(cmd *cobra.Command, _ []string) error {
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+
+	sinceFlag, _ := cmd.Flags().GetString("since")
+	since, err := parseSince(sinceFlag)
+	if err != nil {
+		return err
+	}
+
+	mgr, err := security.GetManager()
+	if err != nil {
+		return err
+	}
+
+	asJSON, _ := cmd.Flags().GetBool("json")
+	enc := json.NewEncoder(cmd.OutOrStdout())
+
+	var data [][]string
+	err = audit.Read(path, mgr, func(r audit.Record, _ string) error {
+		if r.Time.Before(since) {
+			return nil
+		}
+
+		if asJSON {
+			return enc.Encode(r)
+		}
+
+		tokens := ""
+		if r.PromptTokens+r.EvalTokens > 0 {
+			tokens = strconv.Itoa(r.PromptTokens) + "/" + strconv.Itoa(r.EvalTokens)
+		}
+
+		duration := ""
+		if r.Duration > 0 {
+			duration = r.Duration.Round(time.Millisecond).String()
+		}
+
+		model := r.Model
+		if r.Target != "" {
+			model += " -> " + r.Target
+		}
+
+		data = append(data, []string{
+			r.Time.Local().Format(time.DateTime),
+			r.Event,
+			model,
+			r.Caller,
+			tokens,
+			duration,
+			r.Error,
+		})
+		return nil
+	})
+
+	if !asJSON {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"TIME", "EVENT", "MODEL", "CALLER", "TOKENS", "DURATION", "ERROR"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAutoWrapText(false)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.AppendBulk(data)
+		table.Render()
+	}
+
+	return err
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+	"github.com/ollama/ollama/server"
+	"github.com/ollama/ollama/types/model"
+)
+
+// bundleProgress shows a bar for each blob of a bundle, labeled with verb
+func bundleProgress(p *progress.Progress, verb string) func(api.ProgressResponse) {
+	bars := make(map[string]*progress.Bar)
+	var status string
+	var spinner *progress.Spinner
+
+	return func(resp api.ProgressResponse) {
+		if resp.Digest != "" {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			bar, ok := bars[resp.Digest]
+			if !ok {
+				name := strings.TrimPrefix(resp.Digest, "sha256:")
+				bar = progress.NewBar(fmt.Sprintf("%s %s:", verb, name[:min(12, len(name))]), resp.Total, resp.Completed)
+				bars[resp.Digest] = bar
+				p.Add(resp.Digest, bar)
+			}
+
+			bar.Set(resp.Completed)
+		} else if status != resp.Status {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			status = resp.Status
+			spinner = progress.NewSpinner(status)
+			p.Add(status, spinner)
+		}
+	}
+}
+
+// ExportHandler writes one or more local models to a bundle file, or to
+// stdout, for importing on machines without network access
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+
+	names := make([]model.Name, len(args))
+	for i, arg := range args {
+		names[i] = model.ParseName(arg)
+		if !names[i].IsValid() {
+			return fmt.Errorf("invalid model name %q", arg)
+		}
+	}
+
+	// write to a temporary file next to the output, so a failed export
+	// doesn't leave a partial bundle behind
+	var f *os.File
+	if output == "" || output == "-" {
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("refusing to write a bundle to a terminal, use --output")
+		}
+	} else {
+		var err error
+		f, err = os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+	}
+
+	var w io.Writer = os.Stdout
+	if f != nil {
+		w = f
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	if err := server.ExportBundle(w, names, bundleProgress(p, "exporting")); err != nil {
+		return err
+	}
+
+	if f == nil {
+		return nil
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), output)
+}
+
+// ImportHandler adds the models of a bundle, read from a file or stdin, to the
+// local models directory
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else if term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("no bundle given: pass a file or pipe a bundle to stdin")
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	names, err := server.ImportBundle(r, bundleProgress(p, "importing"))
+	p.Stop()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		fmt.Fprintf(cmd.OutOrStdout(), "imported %s\n", n.DisplayShortest())
+	}
+
+	return nil
+}
@@ -41,6 +41,7 @@ import (
 	"github.com/ollama/ollama/progress"
 	"github.com/ollama/ollama/readline"
 	"github.com/ollama/ollama/runner"
+	"github.com/ollama/ollama/security/apikey"
 	"github.com/ollama/ollama/server"
 	"github.com/ollama/ollama/types/model"
 	"github.com/ollama/ollama/types/syncmap"
@@ -132,6 +133,8 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		req.Quantize = quantize
 	}
 
+	req.EncryptLayers, _ = cmd.Flags().GetBool("encrypt-layers")
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
@@ -326,12 +329,43 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	interactive := true
 
 	opts := runOptions{
-		Model:       args[0],
 		WordWrap:    os.Getenv("TERM") == "xterm-256color",
 		Options:     map[string]any{},
 		ShowConnect: true,
 	}
 
+	sessionName, err := cmd.Flags().GetString("session")
+	if err != nil {
+		return err
+	}
+	if sessionName != "" {
+		store, err := openSessionStore()
+		if err != nil {
+			return err
+		}
+
+		session, err := store.load(sessionName)
+		if errors.Is(err, errSessionNotFound) {
+			return fmt.Errorf("couldn't find session %q", sessionName)
+		} else if err != nil {
+			return err
+		}
+
+		session.apply(&opts)
+		opts.Session = sessionName
+	}
+
+	switch {
+	case len(args) > 0 && sessionName != "":
+		// carry the session on with another model, which may not think
+		opts.Model = args[0]
+		opts.Think = nil
+	case len(args) > 0:
+		opts.Model = args[0]
+	case sessionName == "":
+		return errors.New("requires a model, or a session to resume with --session")
+	}
+
 	format, err := cmd.Flags().GetString("format")
 	if err != nil {
 		return err
@@ -357,7 +391,7 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		default:
 			return fmt.Errorf("invalid value for --think: %q (must be true, false, high, medium, or low)", thinkStr)
 		}
-	} else {
+	} else if sessionName == "" {
 		opts.Think = nil
 	}
 	hidethinking, err := cmd.Flags().GetBool("hidethinking")
@@ -378,7 +412,10 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		opts.KeepAlive = &api.Duration{Duration: d}
 	}
 
-	prompts := args[1:]
+	var prompts []string
+	if len(args) > 1 {
+		prompts = args[1:]
+	}
 	// prepend stdin to the prompt if provided
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
 		in, err := io.ReadAll(os.Stdin)
@@ -406,6 +443,10 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	}
 	opts.WordWrap = !nowrap
 
+	if sessionName != "" && !interactive {
+		return errors.New("sessions can only be resumed interactively, without a prompt or redirection")
+	}
+
 	// Fill out the rest of the options based on information about the
 	// model.
 	client, err := api.ClientFromEnvironment()
@@ -413,7 +454,7 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	name := args[0]
+	name := opts.Model
 	info, err := func() (*api.ShowResponse, error) {
 		showReq := &api.ShowRequest{Name: name}
 		info, err := client.Show(cmd.Context(), showReq)
@@ -430,7 +471,8 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	opts.Think, err = inferThinkingOption(&info.Capabilities, &opts, thinkFlag.Changed)
+	// a session's think setting was settled when it was saved
+	opts.Think, err = inferThinkingOption(&info.Capabilities, &opts, thinkFlag.Changed || opts.Think != nil)
 	if err != nil {
 		return err
 	}
@@ -466,16 +508,10 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		for _, msg := range info.Messages {
-			switch msg.Role {
-			case "user":
-				fmt.Printf(">>> %s\n", msg.Content)
-			case "assistant":
-				state := &displayResponseState{}
-				displayResponse(msg.Content, opts.WordWrap, state)
-				fmt.Println()
-				fmt.Println()
-			}
+		if sessionName != "" {
+			displayMessages(opts.Messages, opts.WordWrap)
+		} else {
+			displayMessages(info.Messages, opts.WordWrap)
 		}
 
 		return generateInteractive(cmd, opts)
@@ -1121,6 +1157,7 @@ type runOptions struct {
 	Think        *api.ThinkValue
 	HideThinking bool
 	ShowConnect  bool
+	Session      string
 }
 
 func (r runOptions) Copy() runOptions {
@@ -1165,6 +1202,7 @@ func (r runOptions) Copy() runOptions {
 		Think:        think,
 		HideThinking: r.HideThinking,
 		ShowConnect:  r.ShowConnect,
+		Session:      r.Session,
 	}
 }
 
@@ -1504,12 +1542,32 @@ func RunServer(_ *cobra.Command, _ []string) error {
 		return err
 	}
 
-	ln, err := net.Listen("tcp", envconfig.Host().Host)
-	if err != nil {
-		return err
+	var lns []net.Listener
+	host, socket := envconfig.Host(), envconfig.Socket()
+	if host.Scheme == "unix" {
+		socket = host.Path
+	} else {
+		listen := func(addr string) (net.Listener, error) { return net.Listen("tcp", addr) }
+		if host.Scheme == "https" {
+			listen = server.ListenTLS
+		}
+
+		ln, err := listen(host.Host)
+		if err != nil {
+			return err
+		}
+		lns = append(lns, ln)
+	}
+
+	if socket != "" {
+		ln, err := server.ListenUnix(socket)
+		if err != nil {
+			return err
+		}
+		lns = append(lns, ln)
 	}
 
-	err = server.Serve(ln)
+	err := server.Serve(lns...)
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
@@ -1652,6 +1710,7 @@ func NewCLI() *cobra.Command {
 
 	createCmd.Flags().StringP("file", "f", "", "Name of the Modelfile (default \"Modelfile\")")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_K_M)")
+	createCmd.Flags().Bool("encrypt-layers", false, "Encrypt the template, system prompt, parameters and messages at rest")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1669,9 +1728,14 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().BoolP("verbose", "v", false, "Show detailed model information")
 
 	runCmd := &cobra.Command{
-		Use:     "run MODEL [PROMPT]",
-		Short:   "Run a model",
-		Args:    cobra.MinimumNArgs(1),
+		Use:   "run MODEL [PROMPT]",
+		Short: "Run a model",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("session") {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		PreRunE: checkServerHeartbeat,
 		RunE:    RunHandler,
 	}
@@ -1684,6 +1748,7 @@ func NewCLI() *cobra.Command {
 	runCmd.Flags().String("think", "", "Enable thinking mode: true/false or high/medium/low for supported models")
 	runCmd.Flags().Lookup("think").NoOptDefVal = "true"
 	runCmd.Flags().Bool("hidethinking", false, "Hide thinking output (if provided)")
+	runCmd.Flags().String("session", "", "Resume a conversation saved with /session save")
 
 	stopCmd := &cobra.Command{
 		Use:     "stop MODEL",
@@ -1767,6 +1832,144 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	exportCmd := &cobra.Command{
+		Use:   "export MODEL [MODEL...]",
+		Short: "Export models to a bundle for machines without network access",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  ExportHandler,
+	}
+	exportCmd.Flags().StringP("output", "o", "", "Bundle file to write (default stdout)")
+
+	importCmd := &cobra.Command{
+		Use:   "import [FILE]",
+		Short: "Import models from a bundle file or stdin",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  ImportHandler,
+	}
+
+	signCmd := &cobra.Command{
+		Use:   "sign MODEL",
+		Short: "Sign a model so it can be loaded under a trust policy",
+		Args:  cobra.ExactArgs(1),
+		RunE:  SignHandler,
+	}
+	signCmd.Flags().String("key", "", "ed25519 private key in OpenSSH format (default ~/.ollama/id_ed25519)")
+
+	keysCmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage encryption and API keys",
+	}
+
+	keysRotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the encryption key and re-encrypt stored data",
+		Args:  cobra.ExactArgs(0),
+		RunE:  KeysRotateHandler,
+	}
+
+	keysCreateCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key for clients of the server",
+		Args:  cobra.ExactArgs(0),
+		RunE:  KeysCreateHandler,
+	}
+	keysCreateCmd.Flags().String("scope", string(apikey.Generate), "What the key may do: read, generate or admin")
+	keysCreateCmd.Flags().String("name", "", "Name to tell the key apart by")
+
+	keysListCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List API keys",
+		Args:    cobra.ExactArgs(0),
+		RunE:    KeysListHandler,
+	}
+
+	keysRevokeCmd := &cobra.Command{
+		Use:   "revoke ID|NAME [ID|NAME...]",
+		Short: "Revoke API keys",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  KeysRevokeHandler,
+	}
+
+	keysCmd.AddCommand(keysRotateCmd, keysCreateCmd, keysListCmd, keysRevokeCmd)
+
+	tlsCmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Manage the certificates for serving over TLS",
+	}
+
+	tlsFingerprintCmd := &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Print the fingerprints of the CA and server certificate for clients to pin",
+		Args:  cobra.ExactArgs(0),
+		RunE:  TLSFingerprintHandler,
+	}
+
+	tlsClientCmd := &cobra.Command{
+		Use:   "client NAME",
+		Short: "Issue a client certificate for servers requiring one",
+		Args:  cobra.ExactArgs(1),
+		RunE:  TLSClientHandler,
+	}
+	tlsClientCmd.Flags().String("out", ".", "Directory to write the certificate and key to")
+
+	tlsCmd.AddCommand(tlsFingerprintCmd, tlsClientCmd)
+
+	sessionsCmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage chat sessions saved with /session save",
+	}
+
+	sessionsExportCmd := &cobra.Command{
+		Use:   "export NAME FILE",
+		Short: "Export a session as Markdown, JSON or HTML (FILE - for stdout)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  SessionsExportHandler,
+	}
+	addExportFlags(sessionsExportCmd)
+
+	sessionsCmd.AddCommand(sessionsExportCmd)
+
+	securityCmd := &cobra.Command{
+		Use:   "security",
+		Short: "Inspect security settings",
+	}
+
+	securityStatusCmd := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"doctor"},
+		Short:   "Verify encryption and runner sandboxing are in effect",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    SecurityStatusHandler,
+	}
+	securityStatusCmd.Flags().Bool("json", false, "Output the report as JSON")
+
+	securityCmd.AddCommand(securityStatusCmd)
+
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+
+	auditVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the audit log for edited, removed or reordered records",
+		Args:  cobra.ExactArgs(0),
+		RunE:  AuditVerifyHandler,
+	}
+
+	auditShowCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Decrypt and print audit records",
+		Args:  cobra.ExactArgs(0),
+		RunE:  AuditShowHandler,
+	}
+	auditShowCmd.Flags().String("since", "", "Only show records since a duration ago (e.g. 24h) or a date")
+	auditShowCmd.Flags().Bool("json", false, "Output records as JSON lines")
+
+	auditCmd.AddCommand(auditVerifyCmd, auditShowCmd)
+
 	runnerCmd := &cobra.Command{
 		Use:    "runner",
 		Hidden: true,
@@ -1794,6 +1997,8 @@ func NewCLI() *cobra.Command {
 		psCmd,
 		copyCmd,
 		deleteCmd,
+		exportCmd,
+		importCmd,
 		serveCmd,
 	} {
 		switch cmd {
@@ -1837,6 +2042,14 @@ func NewCLI() *cobra.Command {
 		psCmd,
 		copyCmd,
 		deleteCmd,
+		exportCmd,
+		importCmd,
+		signCmd,
+		keysCmd,
+		tlsCmd,
+		sessionsCmd,
+		securityCmd,
+		auditCmd,
 		runnerCmd,
 	)
 
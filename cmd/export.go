@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/pii"
+)
+
+// exportOptions selects what a conversation export includes and how it is
+// written
+type exportOptions struct {
+	// Format is "md", "json" or "html"
+	Format   string
+	Redact   bool
+	Thinking bool
+	Tools    bool
+}
+
+// addExportFlags adds the flags of /export and secllama sessions export to c
+func addExportFlags(c *cobra.Command) {
+	c.Flags().String("format", "", "Export format: md, json or html (default from the file extension, else md)")
+	c.Flags().Bool("redact", false, "Mask personal data and secrets, such as email addresses and API keys")
+	c.Flags().Bool("no-thinking", false, "Leave out thinking")
+	c.Flags().Bool("no-tools", false, "Leave out tool calls and their results")
+}
+
+// exportOptionsFromFlags returns the options set by the flags of c for an
+// export to path
+func exportOptionsFromFlags(c *cobra.Command, path string) (exportOptions, error) {
+	format, _ := c.Flags().GetString("format")
+	redact, _ := c.Flags().GetBool("redact")
+	noThinking, _ := c.Flags().GetBool("no-thinking")
+	noTools, _ := c.Flags().GetBool("no-tools")
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = "json"
+		case ".html", ".htm":
+			format = "html"
+		default:
+			format = "md"
+		}
+	}
+
+	if !slices.Contains([]string{"md", "json", "html"}, format) {
+		return exportOptions{}, fmt.Errorf("unknown export format %q: expected md, json or html", format)
+	}
+
+	return exportOptions{Format: format, Redact: redact, Thinking: !noThinking, Tools: !noTools}, nil
+}
+
+// transcript is an exported conversation. Images are left out.
+type transcript struct {
+	Model      string         `json:"model"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Messages   []api.Message  `json:"messages"`
+	Redactions map[string]int `json:"redactions,omitempty"`
+}
+
+func newTranscript(model string, messages []api.Message, opts exportOptions) (*transcript, error) {
+	t := &transcript{Model: model, ExportedAt: time.Now().UTC()}
+
+	var s *pii.Session
+	if opts.Redact {
+		r, err := pii.Load(envconfig.PIIPatterns())
+		if err != nil {
+			return nil, fmt.Errorf("pii redaction: %w", err)
+		}
+		s = r.NewSession()
+	}
+
+	for _, msg := range messages {
+		if msg.Role == "tool" && !opts.Tools {
+			continue
+		}
+
+		m := api.Message{Role: msg.Role, Content: msg.Content, ToolName: msg.ToolName}
+		if opts.Thinking {
+			m.Thinking = msg.Thinking
+		}
+		if opts.Tools {
+			m.ToolCalls = slices.Clone(msg.ToolCalls)
+		}
+
+		// an assistant turn may be nothing but the tool calls left out
+		if m.Content == "" && m.Thinking == "" && len(m.ToolCalls) == 0 && len(msg.Images) == 0 {
+			continue
+		}
+
+		if s != nil {
+			m.Content = s.Redact(m.Content)
+			m.Thinking = s.Redact(m.Thinking)
+		}
+		for i := range m.ToolCalls {
+			m.ToolCalls[i].Function.Arguments = copyArguments(s, m.ToolCalls[i].Function.Arguments)
+		}
+
+		t.Messages = append(t.Messages, m)
+	}
+
+	if s != nil {
+		t.Redactions = s.Stats()
+	}
+
+	return t, nil
+}
+
+// copyArguments returns a copy of the arguments of a tool call, with their
+// strings redacted by s unless it is nil
+func copyArguments(s *pii.Session, args api.ToolCallFunctionArguments) api.ToolCallFunctionArguments {
+	var redact func(v any) any
+	redact = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if s != nil {
+				return s.Redact(v)
+			}
+		case []any:
+			c := make([]any, len(v))
+			for i := range v {
+				c[i] = redact(v[i])
+			}
+			return c
+		case map[string]any:
+			c := make(map[string]any, len(v))
+			for k := range v {
+				c[k] = redact(v[k])
+			}
+			return c
+		}
+		return v
+	}
+
+	if args == nil {
+		return nil
+	}
+	return api.ToolCallFunctionArguments(redact(map[string]any(args)).(map[string]any))
+}
+
+// write writes t in format
+func (t *transcript) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	case "html":
+		return transcriptHTML.Execute(w, t)
+	default:
+		return t.writeMarkdown(w)
+	}
+}
+
+func (t *transcript) writeMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Conversation with %s\n\n", t.Model)
+	fmt.Fprintf(&sb, "Exported %s\n", t.ExportedAt.Format(time.RFC3339))
+
+	for _, m := range t.Messages {
+		fmt.Fprintf(&sb, "\n## %s\n\n", messageTitle(m))
+
+		if m.Thinking != "" {
+			sb.WriteString("> **Thinking**\n>\n")
+			for line := range strings.SplitSeq(strings.TrimRight(m.Thinking, "\n"), "\n") {
+				sb.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+			sb.WriteString("\n")
+		}
+
+		switch {
+		case m.Role == "tool":
+			fmt.Fprintf(&sb, "%s\n%s\n%s\n", fence(m.Content), strings.TrimRight(m.Content, "\n"), fence(m.Content))
+		case m.Content != "":
+			sb.WriteString(strings.TrimRight(m.Content, "\n") + "\n")
+		}
+
+		for _, call := range m.ToolCalls {
+			args := call.Function.Arguments.String()
+			fmt.Fprintf(&sb, "\n**Tool call:** `%s`\n\n%sjson\n%s\n%s\n", call.Function.Name, fence(args), args, fence(args))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// fence returns a code fence longer than any run of backticks in s
+func fence(s string) string {
+	n, longest := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			n++
+			longest = max(longest, n)
+		} else {
+			n = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// messageTitle names the author of m, e.g. "Assistant" or "Tool: get_weather"
+func messageTitle(m api.Message) string {
+	title := m.Role
+	if title != "" {
+		title = strings.ToUpper(title[:1]) + title[1:]
+	}
+	if m.ToolName != "" {
+		title += ": " + m.ToolName
+	}
+	return title
+}
+
+var transcriptHTML = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"title": messageTitle,
+	"time":  func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Conversation with {{.Model}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; color: #222; }
+section { border-left: 4px solid #ccc; margin: 1.5em 0; padding: 0 1em; }
+section.user { border-color: #4a7bd0; }
+section.assistant { border-color: #3a9a5b; }
+section.tool { border-color: #c08a2e; }
+h2 { font-size: 1em; }
+pre { white-space: pre-wrap; word-wrap: break-word; font-family: inherit; }
+pre.code, details pre { font-family: monospace; background: #f4f4f4; padding: 0.5em; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>Conversation with {{.Model}}</h1>
+<p class="meta">Exported {{time .ExportedAt}}</p>
+{{- range .Messages}}
+<section class="{{.Role}}">
+<h2>{{title .}}</h2>
+{{- if .Thinking}}
+<details><summary>Thinking</summary><pre>{{.Thinking}}</pre></details>
+{{- end}}
+{{- if .Content}}
+<pre{{if eq .Role "tool"}} class="code"{{end}}>{{.Content}}</pre>
+{{- end}}
+{{- range .ToolCalls}}
+<p>Tool call: <code>{{.Function.Name}}</code></p>
+<pre class="code">{{.Function.Arguments.String}}</pre>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// exportConversation writes a transcript of messages with model to path, or
+// to stdout if path is "-". The file is readable by its owner only, even if
+// it replaces one that wasn't.
+func exportConversation(path, model string, messages []api.Message, opts exportOptions) (*transcript, error) {
+	t, err := newTranscript(model, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "-" {
+		return t, t.write(os.Stdout, opts.Format)
+	}
+
+	// write to a temporary file next to path, created 0600, so a failed
+	// export doesn't leave a partial transcript behind
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := t.write(f, opts.Format); err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return t, os.Rename(f.Name(), path)
+}
+
+// redactionSummary describes what an export redacted as "kind=count"
+// pairs, e.g. "email=2, phone=1"
+func redactionSummary(t *transcript) string {
+	if len(t.Redactions) == 0 {
+		return "nothing"
+	}
+
+	var pairs []string
+	for _, kind := range slices.Sorted(maps.Keys(t.Redactions)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", kind, t.Redactions[kind]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func usageExport() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  /export <file> [--format md|json|html] [--redact] [--no-thinking] [--no-tools]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "  --format        md, json or html (default from the file extension, else md)")
+	fmt.Fprintln(os.Stderr, "  --redact        Mask personal data and secrets, such as email addresses")
+	fmt.Fprintln(os.Stderr, "  --no-thinking   Leave out thinking")
+	fmt.Fprintln(os.Stderr, "  --no-tools      Leave out tool calls and their results")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+// exportCommand runs /export in interactive mode
+func exportCommand(args []string, opts runOptions) {
+	c := &cobra.Command{}
+	addExportFlags(c)
+	if err := c.ParseFlags(args[1:]); err != nil || len(c.Flags().Args()) != 1 {
+		usageExport()
+		return
+	}
+
+	path := c.Flags().Arg(0)
+	eopts, err := exportOptionsFromFlags(c, path)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+
+	t, err := exportConversation(path, opts.Model, opts.Messages, eopts)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Exported %d messages to '%s'\n", len(t.Messages), path)
+	if eopts.Redact {
+		fmt.Printf("Redacted %s\n", redactionSummary(t))
+	}
+}
+
+// SessionsExportHandler writes a transcript of a session saved with
+// /session save to a file, or to stdout if it is "-"
+func SessionsExportHandler(cmd *cobra.Command, args []string) error {
+	name, path := args[0], args[1]
+
+	eopts, err := exportOptionsFromFlags(cmd, path)
+	if err != nil {
+		return err
+	}
+
+	store, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	session, err := store.load(name)
+	if errors.Is(err, errSessionNotFound) {
+		return fmt.Errorf("couldn't find session %q", name)
+	} else if err != nil {
+		return err
+	}
+
+	t, err := exportConversation(path, session.Model, session.Messages, eopts)
+	if err != nil {
+		return err
+	}
+
+	if eopts.Redact {
+		fmt.Fprintf(cmd.ErrOrStderr(), "redacted %s\n", redactionSummary(t))
+	}
+	return nil
+}
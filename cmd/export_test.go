@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func exportMessages() []api.Message {
+	return []api.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "what's the weather at alice@example.com's place? <b>now</b>"},
+		{Role: "assistant", Thinking: "ask the tool", ToolCalls: []api.ToolCall{{
+			Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{
+				"owner": "alice@example.com",
+				"units": []any{"metric"},
+			}},
+		}}},
+		{Role: "tool", ToolName: "get_weather", Content: "sunny"},
+		{Role: "assistant", Content: "It's sunny.", Thinking: "the tool said so"},
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	t.Setenv("SECLLAMA_PII_PATTERNS", filepath.Join(t.TempDir(), "pii.json"))
+
+	messages := exportMessages()
+
+	all, err := newTranscript("llama3.2", messages, exportOptions{Thinking: true, Tools: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(messages, all.Messages); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	redacted, err := newTranscript("llama3.2", messages, exportOptions{Redact: true, Thinking: true, Tools: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := redacted.Messages[1].Content; got != "what's the weather at [EMAIL_1]'s place? <b>now</b>" {
+		t.Errorf("content %q", got)
+	}
+	if got := redacted.Messages[2].ToolCalls[0].Function.Arguments["owner"]; got != "[EMAIL_1]" {
+		t.Errorf("tool call argument %q", got)
+	}
+	if diff := cmp.Diff(map[string]int{"email": 2}, redacted.Redactions); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := redactionSummary(redacted); got != "email=2" {
+		t.Errorf("summary %q", got)
+	}
+
+	// redacting the export leaves the conversation as it was
+	if diff := cmp.Diff(exportMessages(), messages); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	brief, err := newTranscript("llama3.2", messages, exportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []api.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: messages[1].Content},
+		{Role: "assistant", Content: "It's sunny."},
+	}
+	if diff := cmp.Diff(want, brief.Messages); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTranscriptFormats(t *testing.T) {
+	tr, err := newTranscript("llama3.2", exportMessages(), exportOptions{Thinking: true, Tools: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var md bytes.Buffer
+	if err := tr.write(&md, "md"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Conversation with llama3.2\n",
+		"\n## System\n\nbe brief\n",
+		"\n## Assistant\n\n> **Thinking**\n>\n> ask the tool\n\n\n**Tool call:** `get_weather`\n\n```json\n{\"owner\":\"alice@example.com\",\"units\":[\"metric\"]}\n```\n",
+		"\n## Tool: get_weather\n\n```\nsunny\n```\n",
+		"> the tool said so\n\nIt's sunny.\n",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown is missing %q:\n%s", want, md.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := tr.write(&html, "html"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Conversation with llama3.2</title>",
+		"&lt;b&gt;now&lt;/b&gt;",
+		"<h2>Tool: get_weather</h2>",
+		"<details><summary>Thinking</summary><pre>ask the tool</pre></details>",
+		"<p>Tool call: <code>get_weather</code></p>",
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("html is missing %q:\n%s", want, html.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := tr.write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got transcript
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(tr, &got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := fence("a ```` b"); got != "`````" {
+		t.Errorf("fence %q", got)
+	}
+}
+
+func TestExportConversation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.md")
+	if err := os.WriteFile(path, []byte("an older export"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := exportConversation(path, "llama3.2", exportMessages(), exportOptions{Format: "md"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("mode %o, want 600", mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Conversation with llama3.2\n") {
+		t.Errorf("unexpected export:\n%s", data)
+	}
+
+	// only the export is left in the directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the export, got %v", entries)
+	}
+}
+
+func TestExportOptionsFromFlags(t *testing.T) {
+	cases := []struct {
+		args []string
+		path string
+		want string
+	}{
+		{nil, "chat.md", "md"},
+		{nil, "chat.JSON", "json"},
+		{nil, "chat.htm", "html"},
+		{nil, "chat", "md"},
+		{[]string{"--format", "html"}, "chat.json", "html"},
+	}
+
+	for _, tt := range cases {
+		c := &cobra.Command{}
+		addExportFlags(c)
+		if err := c.ParseFlags(tt.args); err != nil {
+			t.Fatal(err)
+		}
+
+		opts, err := exportOptionsFromFlags(c, tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Format != tt.want {
+			t.Errorf("%v %s: got %q, want %q", tt.args, tt.path, opts.Format, tt.want)
+		}
+	}
+
+	c := &cobra.Command{}
+	addExportFlags(c)
+	if err := c.ParseFlags([]string{"--format=pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportOptionsFromFlags(c, "chat.pdf"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
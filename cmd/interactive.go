@@ -36,6 +36,8 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  /show           Show model information")
 		fmt.Fprintln(os.Stderr, "  /load <model>   Load a session or model")
 		fmt.Fprintln(os.Stderr, "  /save <model>   Save your current session")
+		fmt.Fprintln(os.Stderr, "  /session        Save and resume encrypted conversations")
+		fmt.Fprintln(os.Stderr, "  /export <file>  Export the conversation as Markdown, JSON or HTML")
 		fmt.Fprintln(os.Stderr, "  /clear          Clear session context")
 		fmt.Fprintln(os.Stderr, "  /bye            Exit")
 		fmt.Fprintln(os.Stderr, "  /?, /help       Help for a command")
@@ -77,6 +79,10 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  Ctrl + u            Delete the sentence before the cursor")
 		fmt.Fprintln(os.Stderr, "  Ctrl + w            Delete the word before the cursor")
 		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  Ctrl + r            Search the history backwards (again for older matches)")
+		fmt.Fprintln(os.Stderr, "  Ctrl + s            Search the history forwards")
+		fmt.Fprintln(os.Stderr, "  Esc                 Cancel the search")
+		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "  Ctrl + l            Clear the screen")
 		fmt.Fprintln(os.Stderr, "  Ctrl + c            Stop the model from responding")
 		fmt.Fprintln(os.Stderr, "  Ctrl + d            Exit secllama (/bye)")
@@ -247,6 +253,14 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 			}
 			fmt.Printf("Created new model '%s'\n", args[1])
 			continue
+		case strings.HasPrefix(line, "/session"):
+			if err := sessionCommand(cmd, strings.Fields(line), &opts); err != nil {
+				return err
+			}
+			continue
+		case strings.HasPrefix(line, "/export"):
+			exportCommand(strings.Fields(line), opts)
+			continue
 		case strings.HasPrefix(line, "/clear"):
 			opts.Messages = []api.Message{}
 			if opts.System != "" {
@@ -453,6 +467,10 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 					usageShow()
 				case "shortcut", "shortcuts":
 					usageShortcuts()
+				case "session", "/session":
+					usageSession()
+				case "export", "/export":
+					usageExport()
 				}
 			} else {
 				usage()
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/security/apikey"
+)
+
+// KeysRotateHandler replaces the message encryption key and re-encrypts
+// everything previously encrypted with it
+func KeysRotateHandler(cmd *cobra.Command, _ []string) error {
+	mgr, err := security.GetManager()
+	if err != nil {
+		return err
+	}
+
+	oldID := mgr.KeyID()
+	if err := mgr.RotateKey(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "rotated encryption key %s -> %s\n", oldID, mgr.KeyID())
+	return nil
+}
+
+func apiKeyStore() (*apikey.Store, error) {
+	path := envconfig.APIKeys()
+	if path == "" {
+		return nil, errors.New("API keys are disabled (SECLLAMA_API_KEYS=off)")
+	}
+	return apikey.Open(path), nil
+}
+
+// KeysCreateHandler creates an API key and prints it. Only its hash is
+// stored, so this is the one time it is shown.
+func KeysCreateHandler(cmd *cobra.Command, _ []string) error {
+	keys, err := apiKeyStore()
+	if err != nil {
+		return err
+	}
+
+	s, _ := cmd.Flags().GetString("scope")
+	scope, err := apikey.ParseScope(s)
+	if err != nil {
+		return err
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	token, key, err := keys.Create(name, scope)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), token)
+	fmt.Fprintf(cmd.ErrOrStderr(), "created API key %s with the %s scope; it won't be shown again\n", key.ID, key.Scope)
+	return nil
+}
+
+// KeysListHandler prints the API keys, without the keys themselves
+func KeysListHandler(cmd *cobra.Command, _ []string) error {
+	keys, err := apiKeyStore()
+	if err != nil {
+		return err
+	}
+
+	list, err := keys.List()
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, k := range list {
+		data = append(data, []string{k.ID, k.Name, string(k.Scope), format.HumanTime(k.CreatedAt, "Never")})
+	}
+
+	table := tablewriter.NewWriter(cmd.OutOrStdout())
+	table.SetHeader([]string{"ID", "NAME", "SCOPE", "CREATED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+// KeysRevokeHandler deletes API keys by ID or name
+func KeysRevokeHandler(cmd *cobra.Command, args []string) error {
+	keys, err := apiKeyStore()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		key, err := keys.Revoke(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "revoked API key %s\n", key.ID)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+// SecurityStatusHandler prints the security checks reported by the server as
+// a pass/fail table, and fails if any check didn't pass
+func SecurityStatusHandler(cmd *cobra.Command, _ []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Security(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	} else {
+		var data [][]string
+		for _, check := range resp.Checks {
+			result := "PASS"
+			if !check.Passed {
+				result = "FAIL"
+			}
+			data = append(data, []string{check.Category, check.Name, result, check.Detail})
+		}
+
+		table := tablewriter.NewWriter(cmd.OutOrStdout())
+		table.SetHeader([]string{"CATEGORY", "CHECK", "RESULT", "DETAIL"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAutoWrapText(false)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.AppendBulk(data)
+		table.Render()
+	}
+
+	if !resp.Passed {
+		return errors.New("one or more security checks failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/security"
+)
+
+// sessionFormat identifies chat session files, which are sealed record files
+// holding a single record: the session as JSON
+const sessionFormat = "secllama-session"
+
+const sessionExt = ".session"
+
+var sessionNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var errSessionNotFound = errors.New("session not found")
+
+func init() {
+	security.RegisterReEncrypter("sessions", func(m *security.Manager) error {
+		return (&sessionStore{dir: envconfig.Sessions(), cipher: m}).reEncrypt()
+	})
+	security.RegisterEncryptedStore("sessions", func() bool {
+		names, err := (&sessionStore{dir: envconfig.Sessions()}).names()
+		return err == nil && len(names) > 0
+	})
+}
+
+// chatSession is a conversation saved with /session save, and what it takes
+// to carry it on
+type chatSession struct {
+	Model    string          `json:"model"`
+	System   string          `json:"system,omitempty"`
+	Messages []api.Message   `json:"messages"`
+	Options  map[string]any  `json:"options,omitempty"`
+	Think    *api.ThinkValue `json:"think,omitempty"`
+	SavedAt  time.Time       `json:"saved_at"`
+}
+
+func newChatSession(opts runOptions) *chatSession {
+	return &chatSession{
+		Model:    opts.Model,
+		System:   opts.System,
+		Messages: opts.Messages,
+		Options:  opts.Options,
+		Think:    opts.Think,
+		SavedAt:  time.Now().UTC(),
+	}
+}
+
+// apply replaces the conversation in opts with the session's
+func (s *chatSession) apply(opts *runOptions) {
+	opts.Model = s.Model
+	opts.System = s.System
+	opts.Messages = slices.Clone(s.Messages)
+	opts.Options = map[string]any{}
+	for k, v := range s.Options {
+		opts.Options[k] = v
+	}
+	opts.Think = s.Think
+}
+
+// recordCipher seals and opens record files. security.Manager implements it.
+type recordCipher interface {
+	WriteRecords(w io.Writer, format string, records [][]byte) error
+	ReadRecords(data []byte, format string) ([][]byte, error)
+}
+
+// sessionStore is a directory of chat sessions, one file per session sealed
+// with the message encryption key
+type sessionStore struct {
+	dir    string
+	cipher recordCipher
+}
+
+func openSessionStore() (*sessionStore, error) {
+	mgr, err := security.GetManager()
+	if err != nil {
+		return nil, fmt.Errorf("sessions need the encryption key: %w", err)
+	}
+	return &sessionStore{dir: envconfig.Sessions(), cipher: mgr}, nil
+}
+
+func (s *sessionStore) path(name string) (string, error) {
+	if !sessionNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q: use up to 64 letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(s.dir, name+sessionExt), nil
+}
+
+// save stores session as name, replacing any session of that name
+func (s *sessionStore) save(name string, session *chatSession) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	defer security.Wipe(data)
+
+	return s.write(path, data)
+}
+
+func (s *sessionStore) write(path string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := s.cipher.WriteRecords(&buf, sessionFormat, [][]byte{data}); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (s *sessionStore) read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	records, err := s.cipher.ReadRecords(data, sessionFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	if len(records) != 1 {
+		for _, record := range records {
+			security.Wipe(record)
+		}
+		return nil, fmt.Errorf("%s: expected one record, got %d", filepath.Base(path), len(records))
+	}
+	return records[0], nil
+}
+
+// load returns the session saved as name
+func (s *sessionStore) load(name string) (*chatSession, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	defer security.Wipe(data)
+
+	var session chatSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &session, nil
+}
+
+// names returns the names of the saved sessions, sorted
+func (s *sessionStore) names() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), sessionExt)
+		if ok && entry.Type().IsRegular() && sessionNameRe.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// remove deletes the session saved as name
+func (s *sessionStore) remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return errSessionNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// reEncrypt rewrites every session so that it is sealed with the active key
+func (s *sessionStore) reEncrypt() error {
+	names, err := s.names()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		path := filepath.Join(s.dir, name+sessionExt)
+		data, err := s.read(path)
+		if err != nil {
+			return err
+		}
+
+		err = s.write(path, data)
+		security.Wipe(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func usageSession() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /session save [name]   Save the conversation, encrypted")
+	fmt.Fprintln(os.Stderr, "  /session load <name>   Resume a saved conversation")
+	fmt.Fprintln(os.Stderr, "  /session list          List saved conversations")
+	fmt.Fprintln(os.Stderr, "  /session delete <name> Delete a saved conversation")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+// sessionCommand runs /session in interactive mode. /session save saves to
+// the session last saved or loaded, opts.Session, by default. Problems with
+// the command or a session are printed; only errors that should end the
+// interactive session are returned.
+func sessionCommand(cmd *cobra.Command, args []string, opts *runOptions) error {
+	if len(args) < 2 {
+		usageSession()
+		return nil
+	}
+
+	store, err := openSessionStore()
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return nil
+	}
+
+	switch args[1] {
+	case "save":
+		name := opts.Session
+		if len(args) > 2 {
+			name = args[2]
+		}
+		if name == "" || len(args) > 3 {
+			fmt.Println("Usage:\n  /session save <name>")
+			return nil
+		}
+
+		if err := store.save(name, newChatSession(*opts)); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return nil
+		}
+		opts.Session = name
+		fmt.Printf("Saved session '%s'\n", name)
+	case "load":
+		if len(args) != 3 {
+			fmt.Println("Usage:\n  /session load <name>")
+			return nil
+		}
+
+		session, err := store.load(args[2])
+		if errors.Is(err, errSessionNotFound) {
+			fmt.Printf("Couldn't find session '%s'\n", args[2])
+			return nil
+		} else if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return nil
+		}
+
+		origOpts := opts.Copy()
+		session.apply(opts)
+		if err := loadOrUnloadModel(cmd, opts); err != nil {
+			*opts = origOpts
+			if strings.Contains(err.Error(), "not found") {
+				fmt.Printf("Couldn't find model '%s'\n", session.Model)
+				return nil
+			}
+			if strings.Contains(err.Error(), "does not support thinking") {
+				fmt.Printf("error: %v\n", err)
+				return nil
+			}
+			return err
+		}
+
+		opts.Session = args[2]
+		fmt.Printf("Loaded session '%s' with model '%s'\n\n", args[2], opts.Model)
+		displayMessages(opts.Messages, opts.WordWrap)
+	case "list":
+		names, err := store.names()
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return nil
+		}
+
+		var data [][]string
+		for _, name := range names {
+			session, err := store.load(name)
+			if err != nil {
+				data = append(data, []string{name, "error: " + err.Error(), "", ""})
+				continue
+			}
+			data = append(data, []string{name, session.Model, strconv.Itoa(len(session.Messages)), format.HumanTime(session.SavedAt, "Never")})
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"NAME", "MODEL", "MESSAGES", "SAVED"})
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAutoWrapText(false)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.AppendBulk(data)
+		table.Render()
+	case "delete":
+		if len(args) != 3 {
+			fmt.Println("Usage:\n  /session delete <name>")
+			return nil
+		}
+
+		if err := store.remove(args[2]); errors.Is(err, errSessionNotFound) {
+			fmt.Printf("Couldn't find session '%s'\n", args[2])
+			return nil
+		} else if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return nil
+		}
+
+		if opts.Session == args[2] {
+			opts.Session = ""
+		}
+		fmt.Printf("Deleted session '%s'\n", args[2])
+	default:
+		usageSession()
+	}
+
+	return nil
+}
+
+// displayMessages replays the user and assistant messages of a conversation
+func displayMessages(messages []api.Message, wordWrap bool) {
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			fmt.Printf(">>> %s\n", msg.Content)
+		case "assistant":
+			state := &displayResponseState{}
+			displayResponse(msg.Content, wordWrap, state)
+			fmt.Println()
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+// plainCipher stores records unencrypted, counting how often it wrote
+type plainCipher struct {
+	writes int
+}
+
+func (c *plainCipher) WriteRecords(w io.Writer, format string, records [][]byte) error {
+	c.writes++
+	if len(records) != 1 {
+		return fmt.Errorf("got %d records", len(records))
+	}
+	_, err := fmt.Fprintf(w, "%s\n%s", format, records[0])
+	return err
+}
+
+func (c *plainCipher) ReadRecords(data []byte, format string) ([][]byte, error) {
+	header, record, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || string(header) != format {
+		return nil, errors.New("wrong format")
+	}
+	return [][]byte{bytes.Clone(record)}, nil
+}
+
+func TestSessionStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	cipher := &plainCipher{}
+	s := &sessionStore{dir: dir, cipher: cipher}
+
+	if names, err := s.names(); err != nil || len(names) != 0 {
+		t.Fatalf("empty store: %v, %v", names, err)
+	}
+
+	opts := runOptions{
+		Model:  "llama3.2",
+		System: "be brief",
+		Messages: []api.Message{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello", Thinking: "greet back"},
+		},
+		Options: map[string]any{"temperature": 0.5},
+		Think:   &api.ThinkValue{Value: "high"},
+	}
+
+	if err := s.save("work", newChatSession(opts)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save("b.2", newChatSession(runOptions{Model: "qwen3"})); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := s.load("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got runOptions
+	session.apply(&got)
+	if diff := cmp.Diff(opts, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// files other than sessions are skipped
+	if err := os.WriteFile(filepath.Join(dir, "work.session.123.tmp"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := s.names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"b.2", "work"}, names); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, name := range []string{"", "../work", ".hidden", "a/b", "no spaces"} {
+		if err := s.save(name, session); err == nil {
+			t.Errorf("expected an error saving %q", name)
+		}
+	}
+
+	cipher.writes = 0
+	if err := s.reEncrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if cipher.writes != 2 {
+		t.Errorf("re-encrypted %d sessions", cipher.writes)
+	}
+
+	if err := s.remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load("work"); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("expected errSessionNotFound, got %v", err)
+	}
+	if err := s.remove("work"); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("expected errSessionNotFound, got %v", err)
+	}
+
+	// a session file that doesn't open is an error, not an empty session
+	if err := os.WriteFile(filepath.Join(dir, "b.2.session"), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load("b.2"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/server"
+	"github.com/ollama/ollama/types/model"
+)
+
+// SignHandler signs the manifest of a local model with an ed25519 ssh key, by
+// default the one in ~/.ollama, and prints the public key to add to the trust
+// policy of the machines that load it
+func SignHandler(cmd *cobra.Command, args []string) error {
+	n := model.ParseName(args[0])
+	if !n.IsValid() {
+		return fmt.Errorf("invalid model name %q", args[0])
+	}
+
+	keyPath, _ := cmd.Flags().GetString("key")
+	signer, err := auth.LoadPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	sig, err := server.SignModel(n, signer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "signed %s with %s\n", n.DisplayShortest(), ssh.FingerprintSHA256(signer.PublicKey()))
+	fmt.Fprintf(cmd.OutOrStdout(), "public key: %s\n", sig.PublicKey)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/certs"
+)
+
+// TLSFingerprintHandler prints the fingerprints of the CA and the server
+// certificate the server uses over TLS, creating them if need be, for
+// clients to pin in SECLLAMA_TLS_FINGERPRINT
+func TLSFingerprintHandler(cmd *cobra.Command, _ []string) error {
+	dir := envconfig.TLSDir()
+	cert, err := certs.ServerCertificate(dir, certs.Hosts(envconfig.Host().Hostname()))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "ca      %s\n", certs.Fingerprint(cert.Certificate[len(cert.Certificate)-1]))
+	fmt.Fprintf(cmd.OutOrStdout(), "server  %s\n", certs.Fingerprint(cert.Certificate[0]))
+	return nil
+}
+
+// TLSClientHandler issues a client certificate for servers requiring one
+// (SECLLAMA_TLS_CLIENT_AUTH) and writes it, and its key, to NAME.pem and
+// NAME-key.pem
+func TLSClientHandler(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	ca, err := certs.LoadCA(envconfig.TLSDir())
+	if err != nil {
+		return err
+	}
+
+	cert, key, err := ca.IssueClient(name)
+	if err != nil {
+		return err
+	}
+
+	out, _ := cmd.Flags().GetString("out")
+	if err := os.MkdirAll(out, 0o700); err != nil {
+		return err
+	}
+
+	certPath, keyPath := filepath.Join(out, name+".pem"), filepath.Join(out, name+"-key.pem")
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certPath, cert, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "SECLLAMA_TLS_CLIENT_CERT=%s\nSECLLAMA_TLS_CLIENT_KEY=%s\n", certPath, keyPath)
+	return nil
+}
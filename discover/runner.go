@@ -446,12 +446,17 @@ func filterOverlapByLibrary(supported map[string]map[string]map[string]int, need
 }
 
 type bootstrapRunner struct {
-	port int
-	cmd  *exec.Cmd
+	socket string
+	secret string
+	cmd    *exec.Cmd
 }
 
-func (r *bootstrapRunner) GetPort() int {
-	return r.port
+func (r *bootstrapRunner) GetSocket() string {
+	return r.socket
+}
+
+func (r *bootstrapRunner) GetSecret() string {
+	return r.secret
 }
 
 func (r *bootstrapRunner) HasExited() bool {
@@ -472,9 +477,10 @@ func bootstrapDevices(ctx context.Context, ollamaLibDirs []string, extraEnvs map
 	}()
 
 	logutil.Trace("starting runner for device discovery", "libDirs", ollamaLibDirs, "extraEnvs", extraEnvs)
-	cmd, port, err := llm.StartRunner(
+	cmd, socket, secret, err := llm.StartRunner(
 		true, // ollama engine
 		"",   // no model
+		nil,  // no adapters or projectors
 		ollamaLibDirs,
 		out,
 		extraEnvs,
@@ -486,10 +492,11 @@ func bootstrapDevices(ctx context.Context, ollamaLibDirs []string, extraEnvs map
 
 	go func() {
 		cmd.Wait() // exit status ignored
+		llm.RemoveRunnerSocket(socket)
 	}()
 
 	defer cmd.Process.Kill()
-	devices, err := ml.GetDevicesFromRunner(ctx, &bootstrapRunner{port: port, cmd: cmd})
+	devices, err := ml.GetDevicesFromRunner(ctx, &bootstrapRunner{socket: socket, secret: secret, cmd: cmd})
 	if err != nil {
 		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() >= 0 {
 			// Expected during bootstrapping while we filter out unsupported AMD GPUs
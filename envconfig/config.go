@@ -14,14 +14,31 @@ import (
 	"time"
 )
 
-// Host returns the scheme and host. Host can be configured via the OLLAMA_HOST environment variable.
+// Host returns the scheme and host. Host can be configured via the SECLLAMA_HOST or OLLAMA_HOST environment variable.
+// An "https" scheme serves, and connects to, the API over TLS.
+// A "unix" scheme selects a Unix socket, whose path is returned as the URL path. An empty path selects $HOME/.secllama/secllama.sock.
 // Default is scheme "http" and host "127.0.0.1:11434"
 func Host() *url.URL {
 	defaultPort := "11434"
 
-	s := strings.TrimSpace(Var("OLLAMA_HOST"))
+	s := Var("SECLLAMA_HOST")
+	if s == "" {
+		s = Var("OLLAMA_HOST")
+	}
+
+	s = strings.TrimSpace(s)
 	scheme, hostport, ok := strings.Cut(s, "://")
 	switch {
+	case scheme == "unix":
+		path := hostport
+		if path == "" {
+			path = DefaultSocket()
+		} else if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, rest)
+			}
+		}
+		return &url.URL{Scheme: scheme, Path: path}
 	case !ok:
 		scheme, hostport = "http", s
 		if s == "ollama.com" {
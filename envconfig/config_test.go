@@ -38,6 +38,7 @@ func TestHost(t *testing.T) {
 		"https port":          {"https://1.2.3.4:4321", "https://1.2.3.4:4321"},
 		"proxy path":          {"https://example.com/ollama", "https://example.com:443/ollama"},
 		"ollama.com":          {"ollama.com", "https://ollama.com:443"},
+		"unix socket":         {"unix:///run/secllama.sock", "unix:///run/secllama.sock"},
 	}
 
 	for name, tt := range cases {
@@ -48,6 +49,14 @@ func TestHost(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("secllama host", func(t *testing.T) {
+		t.Setenv("OLLAMA_HOST", "1.2.3.4")
+		t.Setenv("SECLLAMA_HOST", "https://0.0.0.0:11434")
+		if host := Host(); host.String() != "https://0.0.0.0:11434" {
+			t.Errorf("expected SECLLAMA_HOST to take precedence, got %s", host.String())
+		}
+	})
 }
 
 func TestOrigins(t *testing.T) {
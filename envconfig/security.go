@@ -2,7 +2,10 @@ package envconfig
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // EnableEncryption returns whether message encryption is enabled
@@ -25,6 +28,17 @@ func EnableSandbox() bool {
 	return true
 }
 
+// Landlock returns whether runner filesystem access is confined with Landlock
+// on kernels that support it
+func Landlock() bool {
+	if enabled := os.Getenv("SECLLAMA_LANDLOCK"); enabled != "" {
+		val, _ := strconv.ParseBool(enabled)
+		return val
+	}
+	// Default to enabled for secllama
+	return true
+}
+
 // StrictNetworkIsolation returns whether strict network isolation is enforced
 func StrictNetworkIsolation() bool {
 	if enabled := os.Getenv("SECLLAMA_STRICT_NETWORK_ISOLATION"); enabled != "" {
@@ -35,3 +49,272 @@ func StrictNetworkIsolation() bool {
 	return true
 }
 
+// TransportEncryption returns whether api.Client opens an encrypted session
+// with the server: "auto" uses one when the server supports it, "required"
+// fails against servers that don't, and "off" never does. TransportEncryption
+// can be configured via the SECLLAMA_TRANSPORT_ENCRYPTION environment variable.
+// Default is "off", so clients keep working against any server.
+func TransportEncryption() string {
+	switch s := strings.ToLower(Var("SECLLAMA_TRANSPORT_ENCRYPTION")); s {
+	case "auto", "required":
+		return s
+	default:
+		return "off"
+	}
+}
+
+// DefaultSocket returns the path of the server's Unix socket when OLLAMA_HOST
+// is "unix://": $HOME/.secllama/secllama.sock
+func DefaultSocket() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".secllama", "secllama.sock")
+}
+
+// Socket returns the path of a Unix socket the server listens on in addition
+// to OLLAMA_HOST. Socket can be configured via the SECLLAMA_SOCKET environment
+// variable; "default" selects DefaultSocket. Default is no additional socket.
+func Socket() string {
+	switch s := Var("SECLLAMA_SOCKET"); s {
+	case "default":
+		return DefaultSocket()
+	default:
+		return s
+	}
+}
+
+// SocketUsers returns the users, by uid or name, allowed to connect to the
+// server's Unix socket besides the user running the server. SocketUsers can
+// be configured via the SECLLAMA_SOCKET_USERS environment variable as a comma
+// separated list.
+func SocketUsers() (users []string) {
+	for _, u := range strings.Split(Var("SECLLAMA_SOCKET_USERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// AuditLog returns the path of the server's audit log. AuditLog can be
+// configured via the SECLLAMA_AUDIT_LOG environment variable; "off" disables
+// auditing. Default is $HOME/.secllama/audit.log.
+func AuditLog() string {
+	switch s := Var("SECLLAMA_AUDIT_LOG"); s {
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		return filepath.Join(home, ".secllama", "audit.log")
+	case "off":
+		return ""
+	default:
+		return s
+	}
+}
+
+// TrustPolicy returns the path of the trust policy listing the keys models
+// must be signed with to be loaded. TrustPolicy can be configured via the
+// SECLLAMA_TRUST_POLICY environment variable; "off" disables the policy.
+// Default is $HOME/.secllama/trust.json. Without the file, models load unsigned.
+func TrustPolicy() string {
+	switch s := Var("SECLLAMA_TRUST_POLICY"); s {
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		return filepath.Join(home, ".secllama", "trust.json")
+	case "off":
+		return ""
+	default:
+		return s
+	}
+}
+
+// PIIPatterns returns the path of the file configuring the patterns PII
+// redaction uses. PIIPatterns can be configured via the SECLLAMA_PII_PATTERNS
+// environment variable. Default is $HOME/.secllama/pii.json. Without the file,
+// the built-in patterns are used.
+func PIIPatterns() string {
+	if s := Var("SECLLAMA_PII_PATTERNS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(home, ".secllama", "pii.json")
+}
+
+// OutputPolicy returns the path of the rules file of the output policy, which
+// masks, flags or aborts model output. OutputPolicy can be configured via the
+// SECLLAMA_OUTPUT_POLICY environment variable; "off" disables the policy.
+// Default is $HOME/.secllama/policy.json. Without the file, output is not
+// checked.
+func OutputPolicy() string {
+	switch s := Var("SECLLAMA_OUTPUT_POLICY"); s {
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		return filepath.Join(home, ".secllama", "policy.json")
+	case "off":
+		return ""
+	default:
+		return s
+	}
+}
+
+// APIKeys returns the path of the file of API keys clients authenticate to
+// the server with. APIKeys can be configured via the SECLLAMA_API_KEYS
+// environment variable; "off" disables API keys. Default is
+// $HOME/.secllama/api_keys.json. While the file holds no keys, the server
+// doesn't ask for one.
+func APIKeys() string {
+	switch s := Var("SECLLAMA_API_KEYS"); s {
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		return filepath.Join(home, ".secllama", "api_keys.json")
+	case "off":
+		return ""
+	default:
+		return s
+	}
+}
+
+// Limits returns the path of the file of per-caller rate limits and token
+// quotas. Limits can be configured via the SECLLAMA_LIMITS environment
+// variable; "off" disables limits. Default is $HOME/.secllama/limits.json.
+// Without the file, callers aren't limited.
+func Limits() string {
+	switch s := Var("SECLLAMA_LIMITS"); s {
+	case "":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		return filepath.Join(home, ".secllama", "limits.json")
+	case "off":
+		return ""
+	default:
+		return s
+	}
+}
+
+// TLSDir returns the directory of the CA and server certificate the server
+// uses when SECLLAMA_HOST has an "https" scheme. TLSDir can be configured via
+// the SECLLAMA_TLS_DIR environment variable. Default is $HOME/.secllama/tls.
+func TLSDir() string {
+	if s := Var("SECLLAMA_TLS_DIR"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(home, ".secllama", "tls")
+}
+
+// Sessions returns the directory of the encrypted chat sessions saved with
+// /session save. Sessions can be configured via the SECLLAMA_SESSIONS
+// environment variable. Default is $HOME/.secllama/sessions.
+func Sessions() string {
+	if s := Var("SECLLAMA_SESSIONS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(home, ".secllama", "sessions")
+}
+
+// KeyStoreBackends returns the KeyStore implementations to try, in order of
+// preference. SECLLAMA_KEYSTORE is a comma separated list of "native", "keyring"
+// and "file"; "auto" expands to the OS-native store followed by the file store.
+// Default is "auto".
+func KeyStoreBackends() []string {
+	s := Var("SECLLAMA_KEYSTORE")
+	if s == "" {
+		s = "auto"
+	}
+
+	var backends []string
+	for _, backend := range strings.Split(s, ",") {
+		switch backend = strings.ToLower(strings.TrimSpace(backend)); backend {
+		case "":
+		case "auto":
+			backends = append(backends, "native", "file")
+		default:
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// KeyringTimeout returns how long a key may sit unused in the kernel keyring
+// before it expires. KeyringTimeout can be configured via the SECLLAMA_KEYRING_TIMEOUT
+// environment variable. Zero or negative values disable expiry, which is the default.
+func KeyringTimeout() (timeout time.Duration) {
+	if s := Var("SECLLAMA_KEYRING_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			timeout = d
+		} else if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			timeout = time.Duration(n) * time.Second
+		}
+	}
+
+	return max(timeout, 0)
+}
+
+var (
+	// Keyring selects the kernel keyring keys are kept in: "user" (default) or "session"
+	Keyring = String("SECLLAMA_KEYRING")
+	// KeyStorePassphrase is the passphrase protecting the file keystore
+	KeyStorePassphrase = String("SECLLAMA_KEYSTORE_PASSPHRASE")
+	// KeyStorePassphraseFD is a file descriptor the file keystore passphrase is read from
+	KeyStorePassphraseFD = String("SECLLAMA_KEYSTORE_PASSPHRASE_FD")
+	// RequireEncryptedTransport refuses requests to prompt-carrying endpoints
+	// made outside an encrypted session, so plain clients stop working
+	RequireEncryptedTransport = Bool("SECLLAMA_REQUIRE_ENCRYPTED_TRANSPORT")
+	// PIIRedaction replaces personal data in chat and generate prompts with
+	// placeholders before they reach the model, and restores it in responses
+	PIIRedaction = Bool("SECLLAMA_PII_REDACTION")
+	// APIKey is the API key api.Client sends to servers that ask for one
+	APIKey = String("SECLLAMA_API_KEY")
+	// TLSClientAuth requires clients of a server over TLS to present a
+	// certificate issued by its CA
+	TLSClientAuth = Bool("SECLLAMA_TLS_CLIENT_AUTH")
+	// TLSFingerprint is the SHA-256 fingerprint of the server or CA
+	// certificate api.Client pins, instead of verifying the server against a CA
+	TLSFingerprint = String("SECLLAMA_TLS_FINGERPRINT")
+	// TLSCA is a file of CA certificates api.Client verifies servers against
+	// instead of the system's
+	TLSCA = String("SECLLAMA_TLS_CA")
+	// TLSClientCert and TLSClientKey are the files of the certificate
+	// api.Client presents to servers requiring one
+	TLSClientCert = String("SECLLAMA_TLS_CLIENT_CERT")
+	TLSClientKey  = String("SECLLAMA_TLS_CLIENT_KEY")
+)
+
+// Seccomp returns the seccomp mode for runner processes: "enforce", "log" or
+// "off". Seccomp can be configured via the SECLLAMA_SECCOMP environment variable.
+// Default is "enforce".
+func Seccomp() string {
+	if s := Var("SECLLAMA_SECCOMP"); s != "" {
+		return s
+	}
+	return "enforce"
+}
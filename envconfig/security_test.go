@@ -0,0 +1,48 @@
+package envconfig
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeyStoreBackends(t *testing.T) {
+	cases := map[string][]string{
+		"":                     {"native", "file"},
+		"auto":                 {"native", "file"},
+		"file":                 {"file"},
+		"keyring,file":         {"keyring", "file"},
+		" Keyring , auto ":     {"keyring", "native", "file"},
+		"native,,file":         {"native", "file"},
+		"keyring,native,file,": {"keyring", "native", "file"},
+	}
+
+	for tt, expect := range cases {
+		t.Run(tt, func(t *testing.T) {
+			t.Setenv("SECLLAMA_KEYSTORE", tt)
+			if actual := KeyStoreBackends(); !slices.Equal(actual, expect) {
+				t.Errorf("%s: expected %v, got %v", tt, expect, actual)
+			}
+		})
+	}
+}
+
+func TestKeyringTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":    0,
+		"30m": 30 * time.Minute,
+		"60":  time.Minute,
+		"0":   0,
+		"-1m": 0,
+		"???": 0,
+	}
+
+	for tt, expect := range cases {
+		t.Run(tt, func(t *testing.T) {
+			t.Setenv("SECLLAMA_KEYRING_TIMEOUT", tt)
+			if actual := KeyringTimeout(); actual != expect {
+				t.Errorf("%s: expected %s, got %s", tt, expect, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ollama/ollama/security"
+)
+
+// ProbeSandbox starts a runner exactly as model runners are started, sandbox
+// included, and has it try to reach targets instead of serving. The report is
+// what the runner observed from inside its sandbox.
+func ProbeSandbox(ctx context.Context, targets security.ProbeTargets) (*security.ProbeReport, error) {
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	status := NewStatusWriter(os.Stderr)
+	cmd, socket, _, err := StartRunner(true, "", nil, nil, status, map[string]string{security.SandboxProbeEnv: string(data)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start probe runner: %w", err)
+	}
+	defer RemoveRunnerSocket(socket)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		<-done
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		if status.LastErrMsg != "" {
+			err = fmt.Errorf("%w: %s", err, status.LastErrMsg)
+		}
+		return nil, fmt.Errorf("probe runner failed: %w", err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(filepath.Dir(socket), security.SandboxProbeReportFile))
+	if err != nil {
+		return nil, fmt.Errorf("probe runner did not report: %w", err)
+	}
+
+	var report security.ProbeReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
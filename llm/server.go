@@ -10,8 +10,6 @@ import (
 	"io"
 	"log"
 	"log/slog"
-	"math/rand"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -19,9 +17,9 @@ import (
 	"runtime"
 	"slices"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"golang.org/x/sync/semaphore"
@@ -78,14 +76,17 @@ type LlamaServer interface {
 	TotalSize() uint64
 	VRAMByGPU(id ml.DeviceID) uint64
 	Pid() int
-	GetPort() int
+	GetSocket() string
+	GetSecret() string
 	GetDeviceInfos(ctx context.Context) []ml.DeviceInfo
 	HasExited() bool
 }
 
 // llmServer is an instance of a runner hosting a single model
 type llmServer struct {
-	port        int
+	socket      string       // Unix socket the runner serves its API on
+	secret      string       // Secret the runner requires on every request
+	client      *http.Client // HTTP client bound to socket, authenticated with secret
 	cmd         *exec.Cmd
 	done        chan error // Channel to signal when the process exits
 	status      *StatusWriter
@@ -229,16 +230,19 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 
 	gpuLibs := ml.LibraryPaths(gpus)
 	status := NewStatusWriter(os.Stderr)
-	cmd, port, err := StartRunner(
+	cmd, socket, secret, err := StartRunner(
 		textProcessor != nil,
 		modelPath,
+		append(append([]string{}, adapters...), projectors...),
 		gpuLibs,
 		status,
 		ml.GetVisibleDevicesEnv(gpus),
 	)
 
 	s := llmServer{
-		port:           port,
+		socket:         socket,
+		secret:         secret,
+		client:         security.NewRunnerClient(socket, secret),
 		cmd:            cmd,
 		status:         status,
 		options:        opts,
@@ -269,6 +273,7 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 	// reap subprocess when it exits
 	go func() {
 		err := s.cmd.Wait()
+		RemoveRunnerSocket(s.socket)
 		// Favor a more detailed message over the process exit status
 		if err != nil && s.status != nil && s.status.LastErrMsg != "" {
 			slog.Error("llama runner terminated", "error", err)
@@ -288,29 +293,33 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 	}
 }
 
-func StartRunner(ollamaEngine bool, modelPath string, gpuLibs []string, out io.Writer, extraEnvs map[string]string) (cmd *exec.Cmd, port int, err error) {
+// StartRunner launches a runner subprocess serving its API on a Unix socket in
+// a private temporary directory. The runner requires a per-runner secret on
+// every request, which it reads from its stdin. The socket and secret are
+// returned so callers can reach the runner with security.NewRunnerClient; the
+// socket must be cleaned up with RemoveRunnerSocket once the runner exits.
+func StartRunner(ollamaEngine bool, modelPath string, modelFiles, gpuLibs []string, out io.Writer, extraEnvs map[string]string) (cmd *exec.Cmd, socket, secret string, err error) {
 	var exe string
 	exe, err = os.Executable()
 	if err != nil {
-		return nil, 0, fmt.Errorf("unable to lookup executable path: %w", err)
+		return nil, "", "", fmt.Errorf("unable to lookup executable path: %w", err)
 	}
 
 	if eval, err := filepath.EvalSymlinks(exe); err == nil {
 		exe = eval
 	}
 
-	port = 0
-	if a, err := net.ResolveTCPAddr("tcp", "localhost:0"); err == nil {
-		var l *net.TCPListener
-		if l, err = net.ListenTCP("tcp", a); err == nil {
-			port = l.Addr().(*net.TCPAddr).Port
-			l.Close()
-		}
-	}
-	if port == 0 {
-		slog.Debug("ResolveTCPAddr failed, using random port")
-		port = rand.Intn(65535-49152) + 49152 // get a random port in the ephemeral range
+	dir, err := os.MkdirTemp("", "secllama-runner-")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("unable to create runner socket directory: %w", err)
 	}
+	socket = filepath.Join(dir, "runner.sock")
+	defer func() {
+		if err != nil {
+			RemoveRunnerSocket(socket)
+		}
+	}()
+
 	params := []string{"runner"}
 	if ollamaEngine {
 		params = append(params, "--ollama-engine")
@@ -318,7 +327,12 @@ func StartRunner(ollamaEngine bool, modelPath string, gpuLibs []string, out io.W
 	if modelPath != "" {
 		params = append(params, "--model", modelPath)
 	}
-	params = append(params, "--port", strconv.Itoa(port))
+	params = append(params, "--socket", socket, "--auth-stdin")
+
+	secret, err = security.GenerateRunnerSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
 
 	var pathEnv string
 	switch runtime.GOOS {
@@ -340,15 +354,18 @@ func StartRunner(ollamaEngine bool, modelPath string, gpuLibs []string, out io.W
 	cmd = exec.Command(exe, params...)
 
 	cmd.Env = os.Environ()
+	// argv and the environment are visible to other users through /proc; the
+	// secret is only written to a pipe the runner alone holds
+	cmd.Stdin = strings.NewReader(secret + "\n")
 
 	if out != nil {
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to spawn server stdout pipe: %w", err)
+			return nil, "", "", fmt.Errorf("failed to spawn server stdout pipe: %w", err)
 		}
 		stderr, err := cmd.StderrPipe()
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to spawn server stderr pipe: %w", err)
+			return nil, "", "", fmt.Errorf("failed to spawn server stderr pipe: %w", err)
 		}
 		go func() {
 			io.Copy(out, stdout) //nolint:errcheck
@@ -398,29 +415,68 @@ func StartRunner(ollamaEngine bool, modelPath string, gpuLibs []string, out io.W
 		}
 	}
 
+	// the socket directory is also the runner's scratch space, and the only
+	// place a sandboxed runner may write
+	cmd.Env = append(cmd.Env, "TMPDIR="+dir)
+
 	slog.Info("starting runner", "cmd", cmd)
 	slog.Debug("subprocess", "", filteredEnv(cmd.Env))
 
-	// Apply security sandbox to the runner process
-	secMgr, secErr := security.GetManager()
-	if secErr == nil {
-		sandboxConfig := secMgr.GetSandboxConfig(port)
-		if sandboxErr := security.ApplySandbox(cmd, sandboxConfig); sandboxErr != nil {
-			slog.Warn("failed to apply sandbox to runner", "error", sandboxErr)
-		} else {
-			slog.Info("sandbox applied successfully to runner process")
+	// Apply security sandbox to the runner process. When sandboxing is enabled
+	// a runner is never started without it.
+	if envconfig.EnableSandbox() {
+		sandboxConfig := security.DefaultSandboxConfig(socket, runnerReadPaths(exe, modelPath, modelFiles, libraryPaths)...)
+		if err = security.ApplySandbox(cmd, sandboxConfig); err != nil {
+			return nil, "", "", fmt.Errorf("failed to sandbox runner (set SECLLAMA_ENABLE_SANDBOX=false to run without the sandbox): %w", err)
 		}
 	} else {
-		slog.Warn("security manager not available, running without sandbox", "error", secErr)
+		slog.Warn("runner sandbox disabled by SECLLAMA_ENABLE_SANDBOX")
 	}
 
 	if err = cmd.Start(); err != nil {
-		return nil, 0, err
+		if envconfig.EnableSandbox() {
+			return nil, "", "", fmt.Errorf("failed to start sandboxed runner (set SECLLAMA_ENABLE_SANDBOX=false to run without the sandbox): %w", err)
+		}
+		return nil, "", "", err
 	}
 	err = nil
 	return
 }
 
+// runnerReadPaths lists the files and directories a sandboxed runner may read:
+// its own executable, the model and the adapters and projectors loaded with it,
+// and its library search path
+func runnerReadPaths(exe, modelPath string, modelFiles, libraryPaths []string) []string {
+	paths := []string{exe}
+	if modelPath != "" {
+		paths = append(paths, modelPath)
+	}
+	paths = append(paths, modelFiles...)
+	for _, p := range libraryPaths {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// RemoveRunnerSocket removes the private directory holding a runner's socket
+func RemoveRunnerSocket(socket string) {
+	if socket == "" {
+		return
+	}
+
+	if err := os.RemoveAll(filepath.Dir(socket)); err != nil {
+		slog.Warn("failed to remove runner socket", "socket", socket, "error", err)
+	}
+}
+
+// runnerURL returns the URL of a runner API endpoint. The host is ignored by
+// the Unix socket client.
+func runnerURL(path string) string {
+	return "http://runner" + path
+}
+
 func (s *llmServer) ModelPath() string {
 	return s.modelPath
 }
@@ -1110,15 +1166,13 @@ func (s *llmServer) initModel(ctx context.Context, req LoadRequest, operation Lo
 		return nil, fmt.Errorf("error marshaling load data: %w", err)
 	}
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/load", s.port), bytes.NewBuffer(data))
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, runnerURL("/load"), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, fmt.Errorf("error creating load request: %w", err)
 	}
 	r.Header.Set("Content-Type", "application/json")
 
-	// Use localhost-only HTTP client for security
-	client := security.NewLocalhostOnlyClient()
-	resp, err := client.Do(r)
+	resp, err := s.client.Do(r)
 	if err != nil {
 		return nil, fmt.Errorf("do load request: %w", err)
 	}
@@ -1189,18 +1243,19 @@ func (s *llmServer) getServerStatus(ctx context.Context) (ServerStatus, error) {
 		return ServerStatusError, fmt.Errorf("llama runner process no longer running: %d %s", s.cmd.ProcessState.ExitCode(), msg)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/health", s.port), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, runnerURL("/health"), nil)
 	if err != nil {
 		return ServerStatusError, fmt.Errorf("error creating GET request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return ServerStatusNotResponding, errors.New("server not responding")
 		}
-		if strings.Contains(err.Error(), "connection refused") {
+		if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrNotExist) {
+			// the runner hasn't created its socket or isn't accepting yet
 			return ServerStatusNotResponding, errors.New("connection refused")
 		}
 		return ServerStatusError, fmt.Errorf("health resp: %w", err)
@@ -1328,8 +1383,12 @@ func (s *llmServer) Pid() int {
 	return -1
 }
 
-func (s *llmServer) GetPort() int {
-	return s.port
+func (s *llmServer) GetSocket() string {
+	return s.socket
+}
+
+func (s *llmServer) GetSecret() string {
+	return s.secret
 }
 
 func (s *llmServer) HasExited() bool {
@@ -1476,16 +1535,14 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		return fmt.Errorf("failed to marshal data: %v", err)
 	}
 
-	endpoint := fmt.Sprintf("http://127.0.0.1:%d/completion", s.port)
+	endpoint := runnerURL("/completion")
 	serverReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, buffer)
 	if err != nil {
 		return fmt.Errorf("error creating POST request: %v", err)
 	}
 	serverReq.Header.Set("Content-Type", "application/json")
 
-	// Use localhost-only HTTP client for security
-	client := security.NewLocalhostOnlyClient()
-	res, err := client.Do(serverReq)
+	res, err := s.client.Do(serverReq)
 	if err != nil && errors.Is(err, context.Canceled) {
 		// client closed connection
 		return err
@@ -1611,13 +1668,13 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 		return nil, fmt.Errorf("error marshaling embed data: %w", err)
 	}
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/embedding", s.port), bytes.NewBuffer(data))
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, runnerURL("/embedding"), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, fmt.Errorf("error creating embed request: %w", err)
 	}
 	r.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(r)
+	resp, err := s.client.Do(r)
 	if err != nil {
 		return nil, fmt.Errorf("do embedding request: %w", err)
 	}
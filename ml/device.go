@@ -18,6 +18,7 @@ import (
 
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/logutil"
+	"github.com/ollama/ollama/security"
 )
 
 // GPULayers is a set of layers to be allocated on a single GPU
@@ -480,8 +481,11 @@ func (d DeviceInfo) updateVisibleDevicesEnv(env map[string]string) {
 }
 
 type BaseRunner interface {
-	// GetPort returns the localhost port number the runner is running on
-	GetPort() int
+	// GetSocket returns the path of the Unix socket the runner is listening on
+	GetSocket() string
+
+	// GetSecret returns the secret the runner requires on every request
+	GetSecret() string
 
 	// HasExited indicates if the runner is no longer running.  This can be used during
 	// bootstrap to detect if a given filtered device is incompatible and triggered an assert
@@ -509,22 +513,20 @@ type FilteredRunnerDiscovery interface {
 
 func GetDevicesFromRunner(ctx context.Context, runner BaseRunner) ([]DeviceInfo, error) {
 	var moreDevices []DeviceInfo
-	port := runner.GetPort()
+	client := security.NewRunnerClient(runner.GetSocket(), runner.GetSecret())
 	tick := time.Tick(10 * time.Millisecond)
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, fmt.Errorf("failed to finish discovery before timeout")
 		case <-tick:
-			r, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/info", port), nil)
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://runner/info", nil)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create request: %w", err)
 			}
 			r.Header.Set("Content-Type", "application/json")
 
-			// Import security package for localhost-only client
-			// Use http.DefaultClient for now as this package can't import security
-			resp, err := http.DefaultClient.Do(r)
+			resp, err := client.Do(r)
 			if err != nil {
 				// slog.Warn("failed to send request", "error", err)
 				if runner.HasExited() {
@@ -1,15 +1,15 @@
 package readline
 
 import (
-	"bufio"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 
 	"github.com/emirpasic/gods/v2/lists/arraylist"
 	"github.com/ollama/ollama/security"
@@ -24,6 +24,30 @@ type History struct {
 	Enabled  bool
 }
 
+// historyFormat identifies history files, which are sealed record files:
+// every line is sealed on its own, bound to its position, and the file
+// carries a MAC, so lines can't be changed, removed or reordered unnoticed
+const historyFormat = "secllama-history"
+
+// historySealed is set once the keystore records that the history has been
+// written in historyFormat, from when on legacy files are refused
+var historySealed atomic.Bool
+
+func init() {
+	security.RegisterReEncrypter("history", reEncryptHistory)
+	security.RegisterEncryptedStore("history", hasEncryptedHistory)
+}
+
+// historyPath returns the location of the history file
+func historyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".secllama", "history"), nil
+}
+
 func NewHistory() (*History, error) {
 	h := &History{
 		Buf:      arraylist.New[string](),
@@ -41,84 +65,193 @@ func NewHistory() (*History, error) {
 }
 
 func (h *History) Init() error {
-	home, err := os.UserHomeDir()
+	path, err := historyPath()
 	if err != nil {
 		return err
 	}
 
-	path := filepath.Join(home, ".secllama", "history")
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
 
 	h.Filename = path
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	mgr, err := security.GetManager()
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
+		slog.Warn("history can't be read or saved without the encryption key", "error", err)
+		mgr = nil
+	}
+
+	lines, legacy, err := decodeHistory(mgr, data)
+	if errors.Is(err, security.ErrIntegrity) {
+		return fmt.Errorf("history %s failed its integrity check and may have been tampered with; move it aside to start a new history: %w", path, err)
+	} else if err != nil {
+		slog.Warn("failed to read history", "error", err)
+		return nil
+	}
+
+	for _, line := range lines {
+		h.Buf.Add(line)
+	}
+	h.Compact()
+	h.Pos = h.Size()
+
+	if legacy && mgr != nil {
+		if err := h.Save(); err != nil {
+			return fmt.Errorf("migrating history: %w", err)
 		}
-		return err
+		slog.Debug("migrated history to the authenticated format", "path", path)
+	} else if mgr != nil {
+		markHistorySealed(mgr)
 	}
-	defer f.Close()
 
-	r := bufio.NewReader(f)
-	for {
-		line, err := r.ReadString('\n')
+	return nil
+}
+
+// decodeHistory returns the lines of a history file. legacy reports whether
+// it is in the format from before historyFormat, one line per line encrypted
+// on its own, which is read the way it was: lines that look like base64 are
+// decrypted, and kept as they are if that fails. Once the history has been
+// written in historyFormat, a legacy file can only be a replacement, and
+// fails with security.ErrIntegrity. Without mgr, only unencrypted lines of
+// that format can be read.
+func decodeHistory(mgr *security.Manager, data []byte) (lines []string, legacy bool, err error) {
+	if security.IsRecordFile(data, historyFormat) {
+		if mgr == nil {
+			return nil, false, errors.New("history is encrypted")
+		}
+
+		records, err := mgr.ReadRecords(data, historyFormat)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return err
+			return nil, false, err
+		}
+
+		for _, record := range records {
+			lines = append(lines, string(record))
+			security.Wipe(record)
 		}
+		return lines, false, nil
+	}
+
+	if mgr != nil && (historySealed.Load() || mgr.IsSealed(historyFormat)) {
+		return nil, false, fmt.Errorf("%w: history was replaced with one in an unauthenticated format", security.ErrIntegrity)
+	}
 
+	for _, line := range strings.Split(string(data), "\n") {
 		line = strings.TrimSpace(line)
 		if len(line) == 0 {
 			continue
 		}
 
-		// Decrypt line if it appears to be encrypted (base64)
-		decrypted := h.decryptLine(line)
-		h.Add(decrypted)
+		if mgr != nil && isBase64(line) {
+			if decrypted, err := mgr.DecryptMessageBytes(line); err == nil {
+				line = string(decrypted)
+				security.Wipe(decrypted)
+			}
+		}
+		lines = append(lines, line)
 	}
 
-	return nil
+	return lines, true, nil
 }
 
-// decryptLine attempts to decrypt a history line
-func (h *History) decryptLine(line string) string {
-	// Check if line looks like base64 (encrypted)
-	if len(line) > 0 && isBase64(line) {
-		mgr, err := security.GetManager()
-		if err != nil {
-			slog.Warn("failed to get security manager for history decryption", "error", err)
-			return line // Return as-is if can't decrypt
-		}
-		
-		decrypted, err := mgr.DecryptMessage(line)
-		if err != nil {
-			// Not encrypted or corrupted, return original
-			return line
+// hasEncryptedHistory reports whether the history file holds lines encrypted
+// with the message encryption key
+func hasEncryptedHistory() bool {
+	path, err := historyPath()
+	if err != nil {
+		return false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	if security.IsRecordFile(data, historyFormat) {
+		return true
+	}
+	return slices.ContainsFunc(strings.Split(string(data), "\n"), func(line string) bool {
+		return security.LooksEncrypted(strings.TrimSpace(line))
+	})
+}
+
+// writeHistory atomically replaces the history file at path with lines,
+// sealed with the active key in historyFormat
+func writeHistory(mgr *security.Manager, path string, lines []string) error {
+	records := make([][]byte, len(lines))
+	for i, line := range lines {
+		records[i] = []byte(line)
+	}
+	defer func() {
+		for _, record := range records {
+			security.Wipe(record)
 		}
-		return decrypted
+	}()
+
+	tmpFile := path + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
 	}
-	return line
+	defer f.Close()
+
+	if err := mgr.WriteRecords(f, historyFormat, records); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		return err
+	}
+
+	markHistorySealed(mgr)
+	return nil
 }
 
-// encryptLine encrypts a history line
-func (h *History) encryptLine(line string) string {
-	mgr, err := security.GetManager()
+// markHistorySealed records that the history is kept in historyFormat
+func markHistorySealed(mgr *security.Manager) {
+	if historySealed.Load() {
+		return
+	}
+
+	if err := mgr.MarkSealed(historyFormat); err != nil {
+		slog.Warn("failed to record that the history is authenticated", "error", err)
+		return
+	}
+	historySealed.Store(true)
+}
+
+// reEncryptHistory rewrites the history file so that it is sealed with the
+// active key, migrating it from the previous format if need be
+func reEncryptHistory(mgr *security.Manager) error {
+	path, err := historyPath()
 	if err != nil {
-		slog.Warn("failed to get security manager for history encryption", "error", err)
-		return line // Store unencrypted if encryption unavailable
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
 	}
-	
-	encrypted, err := mgr.EncryptMessage(line)
+
+	lines, _, err := decodeHistory(mgr, data)
 	if err != nil {
-		slog.Warn("failed to encrypt history line", "error", err)
-		return line // Store unencrypted on error
+		return err
 	}
-	return encrypted
+
+	return writeHistory(mgr, path, lines)
 }
 
 // isBase64 checks if a string is valid base64
@@ -174,27 +307,16 @@ func (h *History) Save() error {
 		return nil
 	}
 
-	tmpFile := h.Filename + ".tmp"
-
-	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o600)
+	mgr, err := security.GetManager()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	buf := bufio.NewWriter(f)
+	lines := make([]string, 0, h.Size())
 	for cnt := range h.Size() {
 		line, _ := h.Buf.Get(cnt)
-		// Encrypt each line before saving
-		encrypted := h.encryptLine(line)
-		fmt.Fprintln(buf, encrypted)
+		lines = append(lines, line)
 	}
-	buf.Flush()
-	f.Close()
 
-	if err = os.Rename(tmpFile, h.Filename); err != nil {
-		return err
-	}
-
-	return nil
+	return writeHistory(mgr, h.Filename, lines)
 }
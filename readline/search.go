@@ -0,0 +1,179 @@
+package readline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// historySearch is an incremental search through the history, started with
+// Ctrl-R (reverse) or Ctrl-S (forward). It only looks at the decrypted lines
+// History holds in memory; nothing about the search is written to disk.
+type historySearch struct {
+	history *History
+	query   []rune
+	reverse bool
+	failed  bool
+
+	// pos is the index of the matching line in history, and start the offset
+	// of the match in it, in runes. Before the first match pos is where the
+	// search started and start is -1.
+	pos   int
+	start int
+
+	// original is the line being edited when the search started
+	original []rune
+}
+
+func newHistorySearch(h *History, original []rune, reverse bool) *historySearch {
+	return &historySearch{
+		history:  h,
+		reverse:  reverse,
+		pos:      h.Pos,
+		start:    -1,
+		original: original,
+	}
+}
+
+// find moves to the first line matching the query from index from onwards,
+// in the direction of the search. Without one the search fails and stays on
+// its last match.
+func (s *historySearch) find(from int) {
+	step := 1
+	if s.reverse {
+		step = -1
+		from = min(from, s.history.Size()-1)
+	} else {
+		from = max(from, 0)
+	}
+
+	for i := from; i >= 0 && i < s.history.Size(); i += step {
+		line, _ := s.history.Buf.Get(i)
+		if start := indexRunes([]rune(line), s.query); start >= 0 {
+			s.pos, s.start, s.failed = i, start, false
+			return
+		}
+	}
+
+	s.failed = true
+}
+
+// next moves to the next match in the direction of reverse, for repeated
+// Ctrl-R and Ctrl-S
+func (s *historySearch) next(reverse bool) {
+	s.reverse = reverse
+	if len(s.query) == 0 {
+		return
+	}
+
+	step := 1
+	if reverse {
+		step = -1
+	}
+	s.find(s.pos + step)
+}
+
+// add extends the query, looking for it from the current match onwards
+func (s *historySearch) add(r rune) {
+	s.query = append(s.query, r)
+	s.find(s.pos)
+}
+
+// remove shortens the query. The current match always matches the shorter
+// query, since it matched a longer one.
+func (s *historySearch) remove() {
+	if len(s.query) == 0 {
+		return
+	}
+
+	s.query = s.query[:len(s.query)-1]
+	if len(s.query) == 0 {
+		s.failed = false
+		return
+	}
+	s.find(s.pos)
+}
+
+// match returns the matching line, or false before the first match
+func (s *historySearch) match() (string, bool) {
+	if s.start < 0 {
+		return "", false
+	}
+
+	line, ok := s.history.Buf.Get(s.pos)
+	return line, ok
+}
+
+// draw renders the search over the prompt line, the match highlighted and
+// scrolled into view within width columns
+func (s *historySearch) draw(width int) {
+	label := "i-search"
+	if s.reverse {
+		label = "reverse-" + label
+	}
+	if s.failed {
+		label = "failed " + label
+	}
+	label = fmt.Sprintf("(%s)`%s': ", label, string(s.query))
+
+	line, _ := s.match()
+	runes := []rune(strings.ReplaceAll(line, "\n", " "))
+
+	start, end := s.start, s.start
+	if len(s.query) > 0 && s.start >= 0 {
+		// a failed search keeps showing the last match, which may end before
+		// the query does
+		end = min(s.start+len(s.query), len(runes))
+	}
+
+	avail := max(width-runewidth.StringWidth(label)-1, 1)
+
+	from := 0
+	for from < start && runewidth.StringWidth(string(runes[from:end])) > avail {
+		from++
+	}
+
+	to := from
+	for to < len(runes) && runewidth.StringWidth(string(runes[from:to+1])) <= avail {
+		to++
+	}
+
+	var sb strings.Builder
+	sb.WriteString(CursorBOL + ClearToEOL + label)
+	for i := from; i < to; i++ {
+		if i == start && start < end {
+			sb.WriteString(ColorInverse)
+		}
+		sb.WriteRune(runes[i])
+		if i == end-1 {
+			sb.WriteString(ColorDefault)
+		}
+	}
+	if end > to {
+		sb.WriteString(ColorDefault)
+	}
+
+	fmt.Print(sb.String())
+}
+
+// indexRunes returns the offset of query in line, or -1. Like smartcase in
+// vim, it ignores case unless query has upper case letters.
+func indexRunes(line, query []rune) int {
+	if len(query) == 0 {
+		return -1
+	}
+
+	fold := !slices.ContainsFunc(query, unicode.IsUpper)
+	for i := 0; i+len(query) <= len(line); i++ {
+		if slices.EqualFunc(line[i:i+len(query)], query, func(a, b rune) bool {
+			return a == b || fold && unicode.ToLower(a) == b
+		}) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,134 @@
+package readline
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/emirpasic/gods/v2/lists/arraylist"
+)
+
+func testHistory(lines ...string) *History {
+	h := &History{Buf: arraylist.New(lines...), Limit: 100}
+	h.Pos = h.Size()
+	return h
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := testHistory("git status", "go test ./...", "Go build", "go vet ./...", "ls")
+
+	expect := func(s *historySearch, line string, start int, failed bool) {
+		t.Helper()
+		got, _ := s.match()
+		if got != line || s.start != start || s.failed != failed {
+			t.Errorf("got %q at %d (failed %v), want %q at %d (failed %v)", got, s.start, s.failed, line, start, failed)
+		}
+	}
+
+	s := newHistorySearch(h, []rune("draft"), true)
+	expect(s, "", -1, false)
+
+	s.add('g')
+	s.add('o')
+	expect(s, "go vet ./...", 0, false)
+
+	// repeated Ctrl-R cycles through older matches, ignoring case
+	s.next(true)
+	expect(s, "Go build", 0, false)
+	s.next(true)
+	expect(s, "go test ./...", 0, false)
+
+	// there are no more; the last match stays
+	s.next(true)
+	expect(s, "go test ./...", 0, true)
+
+	// Ctrl-S goes the other way
+	s.next(false)
+	expect(s, "Go build", 0, false)
+
+	s.add(' ')
+	s.add('b')
+	expect(s, "Go build", 0, false)
+
+	s.add('x')
+	expect(s, "Go build", 0, true)
+
+	s.remove()
+	expect(s, "Go build", 0, false)
+
+	// upper case letters make the search case sensitive
+	s = newHistorySearch(h, nil, true)
+	for _, r := range "Go" {
+		s.add(r)
+	}
+	expect(s, "Go build", 0, false)
+	s.next(true)
+	expect(s, "Go build", 0, true)
+
+	s = newHistorySearch(h, nil, true)
+	for _, r := range "./" {
+		s.add(r)
+	}
+	expect(s, "go vet ./...", 7, false)
+}
+
+func TestHistorySearchDraw(t *testing.T) {
+	line := strings.Repeat("x", 38) + "ab"
+	s := newHistorySearch(testHistory(line), nil, true)
+	for _, r := range "abc" {
+		s.add(r)
+	}
+	if got, _ := s.match(); got != line || !s.failed {
+		t.Fatalf("got %q (failed %v), want the last match after a failed search", got, s.failed)
+	}
+
+	for _, width := range []int{80, 40} {
+		out := captureStdout(t, func() { s.draw(width) })
+		if !strings.Contains(out, ColorInverse+"ab"+ColorDefault) {
+			t.Errorf("width %d: expected the match highlighted, got %q", width, out)
+		}
+	}
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestIndexRunes(t *testing.T) {
+	cases := []struct {
+		line, query string
+		want        int
+	}{
+		{"héllo wörld", "wö", 6},
+		{"HÉLLO", "é", 1},
+		{"héllo", "É", -1},
+		{"abc", "", -1},
+		{"ab", "abc", -1},
+	}
+
+	for _, tt := range cases {
+		if got := indexRunes([]rune(tt.line), []rune(tt.query)); got != tt.want {
+			t.Errorf("indexRunes(%q, %q) = %d, want %d", tt.line, tt.query, got, tt.want)
+		}
+	}
+}
@@ -61,7 +61,8 @@ const (
 	ColorGrey    = Esc + "[38;5;245m"
 	ColorDefault = Esc + "[0m"
 
-	ColorBold = Esc + "[1m"
+	ColorBold    = Esc + "[1m"
+	ColorInverse = Esc + "[7m"
 
 	StartBracketedPaste = Esc + "[?2004h"
 	EndBracketedPaste   = Esc + "[?2004l"
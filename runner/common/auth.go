@@ -0,0 +1,27 @@
+package common
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/ollama/ollama/security"
+)
+
+// Authenticate wraps the runner's API so every request must carry the secret
+// the server wrote to the runner's stdin. Without a secret, any process that
+// can reach the runner could read prompts or drive the model, so a runner
+// started by hand is served unauthenticated with a warning.
+func Authenticate(fromStdin bool, h http.Handler) (http.Handler, error) {
+	if !fromStdin {
+		slog.Warn("runner API is unauthenticated; the server always passes --auth-stdin")
+		return h, nil
+	}
+
+	secret, err := security.ReadRunnerSecret(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	return security.RunnerAuthHandler(secret, h), nil
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// Listen opens the listener the runner serves its API on. The server passes a
+// Unix socket path, which keeps working when the runner has no network
+// interfaces at all; a localhost TCP port is only used when no socket is given.
+func Listen(socket string, port int) (net.Listener, error) {
+	if socket == "" {
+		return net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	}
+
+	// a stale socket from a previous runner would make bind fail
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socket, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
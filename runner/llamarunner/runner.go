@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"regexp"
@@ -897,6 +896,8 @@ func Execute(args []string) error {
 	fs := flag.NewFlagSet("runner", flag.ExitOnError)
 	mpath := fs.String("model", "", "Path to model binary file")
 	port := fs.Int("port", 8080, "Port to expose the server on")
+	socket := fs.String("socket", "", "Path of the Unix socket to expose the server on (overrides --port)")
+	authStdin := fs.Bool("auth-stdin", false, "Read the API secret from stdin and require it on every request")
 	_ = fs.Bool("verbose", false, "verbose output (default: disabled)")
 
 	fs.Usage = func() {
@@ -925,8 +926,7 @@ func Execute(args []string) error {
 
 	go server.run(ctx)
 
-	addr := "127.0.0.1:" + strconv.Itoa(*port)
-	listener, err := net.Listen("tcp", addr)
+	listener, err := common.Listen(*socket, *port)
 	if err != nil {
 		fmt.Println("Listen error:", err)
 		return err
@@ -939,11 +939,16 @@ func Execute(args []string) error {
 	mux.HandleFunc("/completion", server.completion)
 	mux.HandleFunc("/health", server.health)
 
+	handler, err := common.Authenticate(*authStdin, mux)
+	if err != nil {
+		return err
+	}
+
 	httpServer := http.Server{
-		Handler: mux,
+		Handler: handler,
 	}
 
-	log.Println("Server listening on", addr)
+	log.Println("Server listening on", listener.Addr())
 	if err := httpServer.Serve(listener); err != nil {
 		log.Fatal("server error:", err)
 		return err
@@ -3,6 +3,7 @@ package runner
 import (
 	"github.com/ollama/ollama/runner/llamarunner"
 	"github.com/ollama/ollama/runner/ollamarunner"
+	"github.com/ollama/ollama/security"
 )
 
 func Execute(args []string) error {
@@ -10,6 +11,21 @@ func Execute(args []string) error {
 		args = args[1:]
 	}
 
+	// confine filesystem access first: on success this re-executes the runner
+	if err := security.ApplyRunnerLandlock(); err != nil {
+		return err
+	}
+
+	// restrict the runner's syscalls before it touches the model or the network
+	if err := security.InstallRunnerSeccompFilter(); err != nil {
+		return err
+	}
+
+	// a probe runner checks the sandbox it was started in, then exits
+	if probed, err := security.RunRunnerSandboxProbe(); probed {
+		return err
+	}
+
 	var newRunner bool
 	if args[0] == "--ollama-engine" {
 		args = args[1:]
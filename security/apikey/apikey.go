@@ -0,0 +1,272 @@
+// Package apikey manages the API keys clients authenticate to the server with.
+//
+// Keys look like "secllama_<id>_<secret>". Only the SHA-256 hash of a key is
+// stored, next to its ID, name and scope, in a JSON file readable by its owner
+// only. A key is shown once, when it is created.
+//
+// Scopes are ordered: a key with the admin scope can do everything a key with
+// the generate scope can, which can do everything a key with the read scope
+// can.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is what a key may do
+type Scope string
+
+const (
+	// Read lists and shows models and what is running
+	Read Scope = "read"
+	// Generate runs models: chat, generate and embeddings
+	Generate Scope = "generate"
+	// Admin manages models: pull, push, create, copy and delete
+	Admin Scope = "admin"
+)
+
+var scopes = []Scope{Read, Generate, Admin}
+
+// ParseScope returns the scope named s
+func ParseScope(s string) (Scope, error) {
+	if i := slices.Index(scopes, Scope(s)); i >= 0 {
+		return scopes[i], nil
+	}
+	return "", fmt.Errorf("unknown scope %q: expected read, generate or admin", s)
+}
+
+// Allows reports whether a key with scope s may do what needs scope need
+func (s Scope) Allows(need Scope) bool {
+	have, want := slices.Index(scopes, s), slices.Index(scopes, need)
+	return have >= 0 && want >= 0 && have >= want
+}
+
+const prefix = "secllama_"
+
+// ErrInvalid is returned for keys that are malformed, unknown or revoked
+var ErrInvalid = errors.New("invalid API key")
+
+// Key is a stored API key
+type Key struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Scope     Scope     `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Hash is the hex encoded SHA-256 hash of the key
+	Hash string `json:"hash"`
+}
+
+// Store is a file of API keys. It reloads the file when it changes, so keys
+// created or revoked while the server runs take effect on the next request.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	keys    []Key
+	modTime time.Time
+	size    int64
+}
+
+// Open returns the store of keys in the file at path. The file need not
+// exist.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// load reads the file if it changed since it was last read
+func (s *Store) load() error {
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.keys, s.modTime, s.size = nil, time.Time{}, 0
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.keys, s.modTime, s.size = keys, fi.ModTime(), fi.Size()
+	return nil
+}
+
+// save writes keys to the file, replacing it atomically
+func (s *Store) save(keys []Key) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return err
+	}
+
+	// the next load picks up the new file
+	s.modTime = time.Time{}
+	return nil
+}
+
+// List returns the stored keys, oldest first
+func (s *Store) List() ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(s.keys), nil
+}
+
+// Create stores a new key with scope and returns it. The key itself can't be
+// recovered later.
+func (s *Store) Create(name string, scope Scope) (string, Key, error) {
+	if _, err := ParseScope(string(scope)); err != nil {
+		return "", Key{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return "", Key{}, err
+	}
+
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, err
+	}
+
+	k := Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: time.Now().UTC(),
+	}
+	token := prefix + k.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hash(token)
+
+	if err := s.save(append(slices.Clone(s.keys), k)); err != nil {
+		return "", Key{}, err
+	}
+
+	return token, k, nil
+}
+
+// Revoke deletes the key with the given ID, or name if no key has that ID
+func (s *Store) Revoke(idOrName string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return Key{}, err
+	}
+
+	i := slices.IndexFunc(s.keys, func(k Key) bool { return k.ID == idOrName })
+	if i < 0 {
+		i = slices.IndexFunc(s.keys, func(k Key) bool { return k.Name == idOrName })
+	}
+	if i < 0 {
+		return Key{}, fmt.Errorf("no API key %q", idOrName)
+	}
+
+	k := s.keys[i]
+	if err := s.save(slices.Delete(slices.Clone(s.keys), i, i+1)); err != nil {
+		return Key{}, err
+	}
+
+	return k, nil
+}
+
+// Enabled reports whether the store has any keys. Servers without keys don't
+// ask for them.
+func (s *Store) Enabled() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	return len(s.keys) > 0, nil
+}
+
+// Verify returns the stored key token is
+func (s *Store) Verify(token string) (Key, error) {
+	rest, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return Key{}, ErrInvalid
+	}
+
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return Key{}, ErrInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return Key{}, err
+	}
+
+	h := hash(token)
+	for _, k := range s.keys {
+		if k.ID == id && subtle.ConstantTimeCompare([]byte(k.Hash), []byte(h)) == 1 {
+			return k, nil
+		}
+	}
+
+	return Key{}, ErrInvalid
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package apikey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	cases := []struct {
+		have, need Scope
+		want       bool
+	}{
+		{Read, Read, true},
+		{Read, Generate, false},
+		{Read, Admin, false},
+		{Generate, Read, true},
+		{Generate, Generate, true},
+		{Generate, Admin, false},
+		{Admin, Read, true},
+		{Admin, Admin, true},
+		{"", Read, false},
+	}
+
+	for _, tt := range cases {
+		if got := tt.have.Allows(tt.need); got != tt.want {
+			t.Errorf("%q allows %q: got %v, want %v", tt.have, tt.need, got, tt.want)
+		}
+	}
+
+	if _, err := ParseScope("write"); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "api_keys.json")
+	s := Open(path)
+
+	if enabled, err := s.Enabled(); err != nil || enabled {
+		t.Fatalf("empty store: %v, %v", enabled, err)
+	}
+
+	token, key, err := s.Create("ci", Generate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token, prefix+key.ID+"_") {
+		t.Errorf("unexpected key format %q", token)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token[len(prefix+key.ID+"_"):]) {
+		t.Error("the key is stored in the clear")
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode %v", fi.Mode().Perm())
+	}
+
+	// another process reading the same file sees the key
+	other := Open(path)
+	got, err := other.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID || got.Scope != Generate || got.Name != "ci" {
+		t.Errorf("got %+v, want %+v", got, key)
+	}
+
+	for _, bad := range []string{"", "secllama_", token + "x", token[:len(token)-1], strings.Replace(token, key.ID, "000000000000", 1)} {
+		if _, err := other.Verify(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: got %v, want ErrInvalid", bad, err)
+		}
+	}
+
+	if _, err := s.Revoke("missing"); err == nil {
+		t.Error("expected an error revoking a missing key")
+	}
+
+	if _, err := s.Revoke("ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.Verify(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("revoked key: got %v, want ErrInvalid", err)
+	}
+}
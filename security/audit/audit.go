@@ -0,0 +1,397 @@
+// Package audit keeps a tamper-evident log of server operations.
+//
+// Each record is a JSON object sealed with the message encryption key and
+// written as one line of the log. Records are numbered, and each one carries
+// the SHA-256 hash of the plaintext of the record before it, so removing,
+// reordering or editing a record breaks the chain. The number and hash of the
+// newest record are also kept, sealed, in a head file next to the log, which
+// exposes records cut off the end of the log.
+//
+// Records only ever hold metadata: which operation ran on which model, who
+// asked for it, how long it took and how many tokens it used. Prompts and
+// model output are never logged.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security"
+)
+
+// Events recorded in the audit log
+const (
+	EventPull     = "pull"
+	EventPush     = "push"
+	EventCreate   = "create"
+	EventCopy     = "copy"
+	EventDelete   = "delete"
+	EventLoad     = "load"
+	EventUnload   = "unload"
+	EventGenerate = "generate"
+	EventChat     = "chat"
+)
+
+// Record is one entry of the audit log
+type Record struct {
+	Seq          uint64        `json:"seq"`
+	Time         time.Time     `json:"time"`
+	Event        string        `json:"event"`
+	Model        string        `json:"model,omitempty"`
+	Digest       string        `json:"digest,omitempty"`
+	Target       string        `json:"target,omitempty"`
+	Caller       string        `json:"caller,omitempty"`
+	PromptTokens int           `json:"prompt_tokens,omitempty"`
+	EvalTokens   int           `json:"eval_tokens,omitempty"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	// Prev is the hex encoded hash of the previous record, empty for the first
+	Prev string `json:"prev"`
+}
+
+// Cipher seals and opens records. security.Manager implements it.
+type Cipher interface {
+	EncryptMessage(plaintext string) (string, error)
+	DecryptMessage(ciphertext string) (string, error)
+}
+
+// head is the position of the newest record, stored in the head file
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+func init() {
+	security.RegisterReEncrypter("audit", func(m *security.Manager) error {
+		path := envconfig.AuditLog()
+		if path == "" {
+			return nil
+		}
+		return reEncrypt(path, m.ReEncryptMessage)
+	})
+	security.RegisterEncryptedStore("audit", func() bool {
+		path := envconfig.AuditLog()
+		if path == "" {
+			return false
+		}
+		fi, err := os.Stat(path)
+		return err == nil && fi.Size() > 0
+	})
+}
+
+// ErrTampered is returned when the log fails verification
+var ErrTampered = errors.New("audit log integrity check failed")
+
+// HeadPath returns the path of the head file of the log at path
+func HeadPath(path string) string {
+	return path + ".head"
+}
+
+// LockPath returns the path of the lock file that serializes writers of the
+// log at path. It is separate from the log because rewriting the log replaces
+// its file.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// Log appends records to an audit log file
+type Log struct {
+	mu     sync.Mutex
+	path   string
+	cipher Cipher
+
+	next uint64
+	prev string
+}
+
+// Open opens the audit log at path for appending, continuing its hash chain.
+// A log that fails verification is still appended to, and the failure logged.
+func Open(path string, cipher Cipher) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	l := &Log{path: path, cipher: cipher}
+
+	var last *Record
+	var lastHash string
+	err := Read(path, cipher, func(r Record, hash string) error {
+		last, lastHash = &r, hash
+		return nil
+	})
+	if errors.Is(err, ErrTampered) {
+		slog.Error("audit log failed verification, appending anyway", "path", path, "error", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if last != nil {
+		l.next, l.prev = last.Seq+1, lastHash
+	}
+
+	return l, nil
+}
+
+// Append seals r and appends it to the log, filling in its sequence number,
+// time and the hash of the previous record. A nil Log discards r.
+func (l *Log) Append(r Record) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r.Seq, r.Prev = l.next, l.prev
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	// another process may be re-encrypting the log after a key rotation, so
+	// seal the record only once it's done and the new key is active
+	unlock, err := lock(l.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sealed, err := l.cipher.EncryptMessage(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to seal audit record: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, sealed); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	hash := hashRecord(data)
+	if err := writeHead(l.path, l.cipher, head{Seq: r.Seq, Hash: hash}); err != nil {
+		return err
+	}
+
+	l.next, l.prev = r.Seq+1, hash
+	return nil
+}
+
+func hashRecord(plaintext []byte) string {
+	sum := sha256.Sum256(plaintext)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeHead(path string, cipher Cipher, h head) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := cipher.EncryptMessage(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to seal audit log head: %w", err)
+	}
+
+	tmp := HeadPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sealed+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, HeadPath(path))
+}
+
+func readHead(path string, cipher Cipher) (*head, error) {
+	data, err := os.ReadFile(HeadPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := cipher.DecryptMessage(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: head: %v", ErrTampered, err)
+	}
+
+	var h head
+	if err := json.Unmarshal([]byte(plaintext), &h); err != nil {
+		return nil, fmt.Errorf("%w: head: %v", ErrTampered, err)
+	}
+
+	return &h, nil
+}
+
+// Read opens every record of the log at path in order, verifying the hash
+// chain, and calls fn with each record and its hash. It returns an error
+// wrapping ErrTampered as soon as a record doesn't decrypt or doesn't follow
+// from the previous one, and after the last record if the log is shorter than
+// its head file says. A log that never existed is empty.
+func Read(path string, cipher Cipher, fn func(r Record, hash string) error) error {
+	h, err := readHead(path, cipher)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if h != nil {
+			return fmt.Errorf("%w: log is missing", ErrTampered)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var n uint64
+	var prev string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for ; scanner.Scan(); n++ {
+		plaintext, err := cipher.DecryptMessage(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%w: record %d: %v", ErrTampered, n, err)
+		}
+
+		var r Record
+		if err := json.Unmarshal([]byte(plaintext), &r); err != nil {
+			return fmt.Errorf("%w: record %d: %v", ErrTampered, n, err)
+		}
+
+		if r.Seq != n {
+			return fmt.Errorf("%w: record %d has sequence number %d", ErrTampered, n, r.Seq)
+		} else if r.Prev != prev {
+			return fmt.Errorf("%w: record %d does not follow the record before it", ErrTampered, n)
+		}
+
+		prev = hashRecord([]byte(plaintext))
+		if h != nil && h.Seq == n && h.Hash != prev {
+			return fmt.Errorf("%w: record %d does not match head", ErrTampered, n)
+		}
+
+		if err := fn(r, prev); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// a crash between writing a record and its head leaves the head one
+	// record behind, which is harmless; a head past the end of the log is not
+	switch {
+	case h == nil && n > 0:
+		return fmt.Errorf("%w: head file is missing", ErrTampered)
+	case h != nil && h.Seq >= n:
+		return fmt.Errorf("%w: log has %d records but head is at record %d", ErrTampered, n, h.Seq)
+	}
+
+	return nil
+}
+
+// Summary describes a verified audit log
+type Summary struct {
+	Records uint64
+	First   time.Time
+	Last    time.Time
+}
+
+// Verify checks the integrity of the whole log at path
+func Verify(path string, cipher Cipher) (Summary, error) {
+	var s Summary
+	err := Read(path, cipher, func(r Record, _ string) error {
+		if s.Records == 0 {
+			s.First = r.Time
+		}
+		s.Last = r.Time
+		s.Records++
+		return nil
+	})
+	return s, err
+}
+
+// reEncrypt rewrites the log at path and its head with every line re-sealed
+// under the active key. The plaintext of each record, and so its hash, is
+// unchanged. It holds the log's lock so no record is appended to the file
+// being replaced.
+func reEncrypt(path string, reseal func(string) (string, error)) error {
+	unlock, err := lock(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// the log's directory doesn't exist, so neither does the log
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, p := range []string{path, HeadPath(path)} {
+		data, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		for line := range bytes.Lines(data) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+
+			sealed, err := reseal(string(line))
+			if err != nil {
+				return err
+			}
+			buf.WriteString(sealed + "\n")
+		}
+
+		if err := writeFileAtomic(p, &buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFileAtomic(path string, r io.Reader) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,279 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/security"
+)
+
+type testCipher struct {
+	*security.MessageEncryptor
+}
+
+func (c testCipher) EncryptMessage(plaintext string) (string, error) {
+	return c.EncryptString(plaintext)
+}
+
+func (c testCipher) DecryptMessage(ciphertext string) (string, error) {
+	return c.DecryptString(ciphertext)
+}
+
+func newTestCipher(t *testing.T) testCipher {
+	t.Helper()
+
+	key, err := security.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := security.NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCipher{e}
+}
+
+// writeTestLog appends n records to a new log and returns its path
+func writeTestLog(t *testing.T, cipher Cipher, n int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range n {
+		if err := l.Append(Record{Event: EventGenerate, Model: "test", PromptTokens: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendVerify(t *testing.T) {
+	cipher := newTestCipher(t)
+	path := writeTestLog(t, cipher, 3)
+
+	// reopening continues the chain
+	l, err := Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{Event: EventUnload, Model: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := Verify(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Records != 4 {
+		t.Errorf("expected 4 records, got %d", summary.Records)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "generate") {
+		t.Error("audit log contains plaintext")
+	}
+
+	var events []string
+	if err := Read(path, cipher, func(r Record, _ string) error {
+		events = append(events, r.Event)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(events, ","); got != "generate,generate,generate,unload" {
+		t.Errorf("unexpected events %s", got)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	cipher := newTestCipher(t)
+
+	cases := map[string]func(t *testing.T, path string){
+		"deleted record": func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			writeLines(t, path, append(lines[:1], lines[2:]...))
+		},
+		"reordered records": func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			lines[1], lines[2] = lines[2], lines[1]
+			writeLines(t, path, lines)
+		},
+		"truncated": func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			writeLines(t, path, lines[:2])
+		},
+		"edited record": func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			lines[1] = strings.Replace(lines[1], lines[1][20:24], "AAAA", 1)
+			writeLines(t, path, lines)
+		},
+		"replaced record": func(t *testing.T, path string) {
+			lines := readLines(t, path)
+			forged, err := cipher.EncryptMessage(`{"seq":1,"event":"pull","prev":""}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines[1] = forged + "\n"
+			writeLines(t, path, lines)
+		},
+		"missing head": func(t *testing.T, path string) {
+			if err := os.Remove(HeadPath(path)); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"missing log": func(t *testing.T, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeTestLog(t, cipher, 4)
+			tamper(t, path)
+
+			if _, err := Verify(path, cipher); !errors.Is(err, ErrTampered) {
+				t.Fatalf("expected ErrTampered, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyHeadBehind(t *testing.T) {
+	cipher := newTestCipher(t)
+	path := writeTestLog(t, cipher, 2)
+
+	head, err := os.ReadFile(HeadPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{Event: EventLoad}); err != nil {
+		t.Fatal(err)
+	}
+
+	// as if the server crashed after writing the record but before its head
+	if err := os.WriteFile(HeadPath(path), head, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(path, cipher); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	cipher := newTestCipher(t)
+	path := writeTestLog(t, cipher, 3)
+
+	key, err := security.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := security.NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reEncrypt(path, func(line string) (string, error) {
+		plaintext, err := cipher.DecryptMessage(line)
+		if err != nil {
+			return "", err
+		}
+		return rotated.EncryptString(plaintext)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(path, testCipher{rotated}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(path, cipher); !errors.Is(err, ErrTampered) {
+		t.Fatalf("expected the old key to no longer open the log, got %v", err)
+	}
+}
+
+func TestReEncryptWhileAppending(t *testing.T) {
+	cipher := newTestCipher(t)
+	path := writeTestLog(t, cipher, 3)
+
+	l, err := Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const appends = 50
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range appends {
+			if err := l.Append(Record{Event: EventGenerate, Model: "test", PromptTokens: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for range 10 {
+		if err := reEncrypt(path, func(line string) (string, error) {
+			plaintext, err := cipher.DecryptMessage(line)
+			if err != nil {
+				return "", err
+			}
+			return cipher.EncryptMessage(plaintext)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	s, err := Verify(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Records != 3+appends {
+		t.Fatalf("expected %d records, got %d", 3+appends, s.Records)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package audit
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock takes an exclusive lock on the lock file of the log at path, blocking
+// until it is free, and returns the function that releases it. The lock is
+// advisory and shared by every process appending to or rewriting the log.
+func lock(path string) (func() error, error) {
+	f, err := os.OpenFile(LockPath(path), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// closing the file releases the lock
+	return f.Close, nil
+}
@@ -0,0 +1,416 @@
+// Package certs provides the certificates for serving the API over TLS, and
+// the TLS configuration of clients connecting to it.
+//
+// The server's certificates live in one directory: a self-signed CA
+// (ca.pem, ca-key.pem), created on first use, and a server certificate it
+// issued (server.pem, server-key.pem), reissued when it is about to expire or
+// doesn't cover the names the server is reached by. The same CA issues client
+// certificates for mutual TLS.
+//
+// Clients either trust the CA, or pin the SHA-256 fingerprint of the CA or
+// server certificate, which needs no CA file on the client.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// File names in the certificate directory
+const (
+	CAFile        = "ca.pem"
+	CAKeyFile     = "ca-key.pem"
+	ServerFile    = "server.pem"
+	ServerKeyFile = "server-key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+	renewBefore  = 30 * 24 * time.Hour
+)
+
+// Fingerprint returns the hex encoded SHA-256 hash of a DER encoded
+// certificate
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseFingerprint accepts fingerprints in upper or lower case, with or
+// without colons and a "sha256:" prefix
+func parseFingerprint(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "sha256:")
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate fingerprint %q: expected a SHA-256 hash in hex", s)
+	}
+	return b, nil
+}
+
+// CA is the certificate authority of a certificate directory
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// LoadCA returns the CA in dir, creating it if there is none
+func LoadCA(dir string) (*CA, error) {
+	certPath, keyPath := filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile)
+
+	ca, err := loadPair(certPath, keyPath)
+	if err == nil {
+		key, ok := ca.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an ECDSA key", keyPath)
+		}
+		return &CA{Cert: ca.Leaf, Key: key}, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newTemplate("SecLlama CA", caValidity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePair(dir, certPath, keyPath, [][]byte{der}, key); err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// issue returns a certificate for name signed by the CA, DER encoded, and its
+// key
+func (ca *CA) issue(name string, usage x509.ExtKeyUsage, hosts []string) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate(name, certValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return der, key, nil
+}
+
+// IssueClient returns a PEM encoded client certificate for name, signed by
+// the CA, and its key
+func (ca *CA) IssueClient(name string) (cert, key []byte, err error) {
+	der, k, err := ca.issue(name, x509.ExtKeyUsageClientAuth, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// ServerCertificate returns the server certificate in dir, followed by the CA
+// certificate. It is issued, along with the CA if need be, when there is none,
+// when it expires within 30 days, or when it doesn't cover all of hosts.
+func ServerCertificate(dir string, hosts []string) (*tls.Certificate, error) {
+	ca, err := LoadCA(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	certPath, keyPath := filepath.Join(dir, ServerFile), filepath.Join(dir, ServerKeyFile)
+	cert, err := loadPair(certPath, keyPath)
+	if err == nil && covers(cert.Leaf, hosts) && time.Until(cert.Leaf.NotAfter) > renewBefore && cert.Leaf.CheckSignatureFrom(ca.Cert) == nil {
+		return cert, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	der, key, err := ca.issue("SecLlama server", x509.ExtKeyUsageServerAuth, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := [][]byte{der, ca.Cert.Raw}
+	if err := writePair(dir, certPath, keyPath, chain, key); err != nil {
+		return nil, err
+	}
+
+	return loadPair(certPath, keyPath)
+}
+
+// covers reports whether cert is valid for every one of hosts
+func covers(cert *x509.Certificate, hosts []string) bool {
+	for _, h := range hosts {
+		if cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerConfig returns the TLS configuration of a server with the server
+// certificate in dir, valid for hosts. With clientAuth, clients must present
+// a certificate issued by the CA in dir.
+func ServerConfig(dir string, hosts []string, clientAuth bool) (*tls.Config, error) {
+	cert, err := ServerCertificate(dir, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cert},
+	}
+
+	if clientAuth {
+		ca, err := LoadCA(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = x509.NewCertPool()
+		cfg.ClientCAs.AddCert(ca.Cert)
+	}
+
+	return cfg, nil
+}
+
+// ClientConfig returns the TLS configuration of a client. With pin, the
+// server's certificate must have that fingerprint or be issued by the CA
+// certificate with that fingerprint, which the server must send along, and is
+// otherwise not verified. With caFile, servers are verified
+// against the CA certificates in it instead of the system's. certFile and
+// keyFile hold the client certificate for servers asking for one. It returns
+// nil if all are empty.
+func ClientConfig(pin, caFile, certFile, keyFile string) (*tls.Config, error) {
+	if pin == "" && caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no certificates found", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if pin != "" {
+		want, err := parseFingerprint(pin)
+		if err != nil {
+			return nil, err
+		}
+
+		// the pin replaces verification against a CA, so the server's
+		// certificate needn't be trusted or match its name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPin(cs.PeerCertificates, want)
+		}
+	}
+
+	return cfg, nil
+}
+
+// verifyPin checks that chain, as presented by a server, is pinned by want:
+// either its leaf has that fingerprint, or the leaf is issued, possibly
+// through the other certificates of chain, by the CA certificate with that
+// fingerprint. Any other certificate in chain matching want proves nothing,
+// since certificates are public and anyone can append them to their own.
+func verifyPin(chain []*x509.Certificate, want []byte) error {
+	errMismatch := errors.New("server certificate doesn't match the pinned fingerprint (SECLLAMA_TLS_FINGERPRINT)")
+	if len(chain) == 0 {
+		return errMismatch
+	}
+
+	matches := func(cert *x509.Certificate) bool {
+		sum := sha256.Sum256(cert.Raw)
+		return subtle.ConstantTimeCompare(sum[:], want) == 1
+	}
+
+	if matches(chain[0]) {
+		return nil
+	}
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	var pinned bool
+	for _, cert := range chain[1:] {
+		if matches(cert) && cert.IsCA {
+			roots.AddCert(cert)
+			pinned = true
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if !pinned {
+		return errMismatch
+	}
+
+	if _, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return fmt.Errorf("%w: %v", errMismatch, err)
+	}
+	return nil
+}
+
+func newTemplate(name string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"SecLlama"}, CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+// loadPair loads a certificate chain and its key, with Leaf set
+func loadPair(certPath, keyPath string) (*tls.Certificate, error) {
+	for _, path := range []string{certPath, keyPath} {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cert, nil
+}
+
+// writePair writes a certificate chain and its key, the key readable by its
+// owner only
+func writePair(dir, certPath, keyPath string, chain [][]byte, key *ecdsa.PrivateKey) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	return os.WriteFile(certPath, certPEM, 0o644)
+}
+
+// Hosts returns the names a server listening on host is reached by: host
+// itself, unless it is unspecified, the loopback names, and for unspecified
+// addresses also the machine's hostname and the addresses of its interfaces
+func Hosts(host string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	switch ip := net.ParseIP(host); {
+	case host == "":
+	case ip == nil || !ip.IsUnspecified():
+		hosts = append(hosts, host)
+	default:
+		if name, err := os.Hostname(); err == nil {
+			hosts = append(hosts, name)
+		}
+
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+					hosts = append(hosts, ipnet.IP.String())
+				}
+			}
+		}
+	}
+
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
@@ -0,0 +1,255 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServerCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	cert, err := ServerCertificate(dir, Hosts("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("expected the server and CA certificates, got %d", len(cert.Certificate))
+	}
+
+	for _, h := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.Leaf.VerifyHostname(h); err != nil {
+			t.Error(err)
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, ServerKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("key mode %v", fi.Mode().Perm())
+	}
+
+	again, err := ServerCertificate(dir, Hosts("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Leaf.Equal(cert.Leaf) {
+		t.Error("expected the certificate to be reused")
+	}
+
+	other, err := ServerCertificate(dir, Hosts("llama.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Leaf.Equal(cert.Leaf) {
+		t.Error("expected a new certificate for new hosts")
+	}
+	if err := other.Leaf.VerifyHostname("llama.example"); err != nil {
+		t.Error(err)
+	}
+	if Fingerprint(other.Certificate[1]) != Fingerprint(cert.Certificate[1]) {
+		t.Error("expected the CA to be reused")
+	}
+}
+
+func TestHosts(t *testing.T) {
+	if got := Hosts(""); strings.Join(got, ",") != "127.0.0.1,::1,localhost" {
+		t.Errorf("got %v", got)
+	}
+
+	if got := Hosts("llama.example"); strings.Join(got, ",") != "127.0.0.1,::1,llama.example,localhost" {
+		t.Errorf("got %v", got)
+	}
+}
+
+// serve accepts a single TLS connection on a loopback address and echoes
+// what it reads
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	return ln.Addr().String()
+}
+
+func dial(addr string, cfg *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// with TLS 1.3 the server only rejects a client certificate after the
+	// client's side of the handshake is done
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	_, err = io.ReadFull(conn, make([]byte, 4))
+	return err
+}
+
+func TestPin(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := ServerConfig(dir, Hosts("127.0.0.1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := cfg.Certificates[0].Certificate
+
+	cases := []struct {
+		name string
+		pin  string
+		ok   bool
+	}{
+		{"server", Fingerprint(chain[0]), true},
+		{"ca", "sha256:" + strings.ToUpper(Fingerprint(chain[1])), true},
+		{"other", Fingerprint([]byte("other")), false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := ClientConfig(tt.pin, "", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = dial(serve(t, cfg), client)
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			} else if !tt.ok && (err == nil || !strings.Contains(err.Error(), "pinned fingerprint")) {
+				t.Fatalf("expected a pin mismatch, got %v", err)
+			}
+		})
+	}
+
+	if _, err := ClientConfig("abc", "", "", ""); err == nil {
+		t.Error("expected an invalid fingerprint to be refused")
+	}
+}
+
+func TestPinForeignLeaf(t *testing.T) {
+	cfg, err := ServerConfig(t.TempDir(), Hosts("127.0.0.1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genuine := cfg.Certificates[0].Certificate
+
+	foreign, err := ServerConfig(t.TempDir(), Hosts("127.0.0.1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the genuine certificates are public, so anyone can send them along
+	// with a leaf of their own
+	cases := []struct {
+		name string
+		pin  string
+		sent []byte
+	}{
+		{"server", Fingerprint(genuine[0]), genuine[0]},
+		{"ca", Fingerprint(genuine[1]), genuine[1]},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			mitm := foreign.Clone()
+			mitm.Certificates = []tls.Certificate{{
+				Certificate: [][]byte{foreign.Certificates[0].Certificate[0], tt.sent},
+				PrivateKey:  foreign.Certificates[0].PrivateKey,
+			}}
+
+			client, err := ClientConfig(tt.pin, "", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dial(serve(t, mitm), client); err == nil || !strings.Contains(err.Error(), "pinned fingerprint") {
+				t.Fatalf("expected a pin mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := ServerConfig(dir, Hosts("127.0.0.1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := LoadCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, err := ca.IssueClient("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := t.TempDir()
+	certFile, keyFile := filepath.Join(client, "laptop.pem"), filepath.Join(client, "laptop-key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// verified against the CA file rather than pinned
+	with, err := ClientConfig("", filepath.Join(dir, CAFile), certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dial(serve(t, cfg), with); err != nil {
+		t.Fatal(err)
+	}
+
+	without := &tls.Config{RootCAs: x509.NewCertPool()}
+	without.RootCAs.AddCert(ca.Cert)
+	if err := dial(serve(t, cfg), without); err == nil {
+		t.Fatal("expected a client without a certificate to be refused")
+	}
+
+	// a certificate from another CA isn't accepted either
+	other, err := LoadCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, err = other.IssueClient("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	without.Certificates = []tls.Certificate{stranger}
+	if err := dial(serve(t, cfg), without); err == nil {
+		t.Fatal("expected a certificate from another CA to be refused")
+	}
+}
@@ -1,11 +1,15 @@
 package security
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -14,23 +18,133 @@ import (
 )
 
 const (
-	keySize   = 32 // AES-256
-	nonceSize = 12 // GCM standard nonce size
-	saltSize  = 32
+	keySize    = 32 // AES-256
+	nonceSize  = 12 // GCM standard nonce size
+	tagSize    = 16 // GCM authentication tag size
+	saltSize   = 32
 	iterations = 100000
+
+	// envelopeVersion identifies the versioned ciphertext format:
+	// version (1 byte) | key ID (8 bytes) | nonce (12 bytes) | sealed data.
+	// The version and key ID are authenticated as associated data.
+	envelopeVersion = 0x01
+	keyIDSize       = 8
+	headerSize      = 1 + keyIDSize
+)
+
+var (
+	// ErrUnknownKey is returned when a ciphertext was sealed with a key that
+	// is neither the active key nor one of the retired keys
+	ErrUnknownKey = errors.New("ciphertext was encrypted with an unknown key")
+
+	keyIDContext = []byte("secllama key id v1")
+	macContext   = []byte("secllama mac v1")
 )
 
-// MessageEncryptor handles encryption/decryption of messages between user and model
+// MessageEncryptor handles encryption/decryption of messages between user and model.
+// New ciphertexts are always sealed with the active key; retired keys are kept
+// only so that data written before a rotation can still be decrypted.
 type MessageEncryptor struct {
-	key []byte
+	key     *Secret
+	keyID   [keyIDSize]byte
+	retired map[[keyIDSize]byte]*Secret
 }
 
-// NewMessageEncryptor creates a new encryptor with the provided key
-func NewMessageEncryptor(key []byte) (*MessageEncryptor, error) {
-	if len(key) != keySize {
+// NewMessageEncryptor creates a new encryptor with the provided key. The
+// encryptor owns the key from then on and destroys it in Destroy.
+func NewMessageEncryptor(key *Secret) (*MessageEncryptor, error) {
+	if key.Len() != keySize {
 		return nil, fmt.Errorf("key must be %d bytes", keySize)
 	}
-	return &MessageEncryptor{key: key}, nil
+	return &MessageEncryptor{
+		key:     key,
+		keyID:   keyIDOf(key.Bytes()),
+		retired: make(map[[keyIDSize]byte]*Secret),
+	}, nil
+}
+
+// Destroy wipes the active and retired keys. The encryptor can't be used
+// afterwards.
+func (e *MessageEncryptor) Destroy() {
+	e.key.Destroy()
+	e.clearRetired("")
+}
+
+// clearRetired wipes and forgets the retired keys but the one with the ID
+// keep, if any
+func (e *MessageEncryptor) clearRetired(keep string) {
+	for id, key := range e.retired {
+		if hex.EncodeToString(id[:]) != keep {
+			key.Destroy()
+			delete(e.retired, id)
+		}
+	}
+}
+
+// keyIDOf derives a stable, non-secret identifier for a key
+func keyIDOf(key []byte) [keyIDSize]byte {
+	h := sha256.New()
+	h.Write(keyIDContext)
+	h.Write(key)
+
+	var id [keyIDSize]byte
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// KeyID returns the hex-encoded identifier of a key as it appears in ciphertext envelopes
+func KeyID(key []byte) string {
+	id := keyIDOf(key)
+	return hex.EncodeToString(id[:])
+}
+
+// KeyID returns the identifier of the active key
+func (e *MessageEncryptor) KeyID() string {
+	return hex.EncodeToString(e.keyID[:])
+}
+
+// AddRetiredKey registers a previous key so ciphertexts sealed with it can
+// still be decrypted. The encryptor owns the key from then on.
+func (e *MessageEncryptor) AddRetiredKey(key *Secret) error {
+	if key.Len() != keySize {
+		key.Destroy()
+		return fmt.Errorf("key must be %d bytes", keySize)
+	}
+
+	id := keyIDOf(key.Bytes())
+	if _, ok := e.retired[id]; ok || id == e.keyID {
+		key.Destroy()
+		return nil
+	}
+
+	e.retired[id] = key
+	return nil
+}
+
+// RetiredKeyIDs returns the identifiers of all retired keys known to the encryptor
+func (e *MessageEncryptor) RetiredKeyIDs() []string {
+	ids := make([]string, 0, len(e.retired))
+	for id := range e.retired {
+		ids = append(ids, hex.EncodeToString(id[:]))
+	}
+	return ids
+}
+
+// CiphertextKeyID returns the key ID recorded in a versioned ciphertext
+func CiphertextKeyID(ciphertext []byte) (string, error) {
+	if len(ciphertext) < headerSize+nonceSize || ciphertext[0] != envelopeVersion {
+		return "", errors.New("not a versioned ciphertext")
+	}
+	return hex.EncodeToString(ciphertext[1:headerSize]), nil
+}
+
+// LooksEncrypted reports whether s could be a ciphertext from EncryptString:
+// base64 long enough for a nonce and an authentication tag, which a versioned
+// envelope and one from before key IDs both hold. Short words that happen to
+// be base64, such as "test" or "/bye", don't qualify.
+func LooksEncrypted(s string) bool {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return err == nil && len(data) >= nonceSize+tagSize
 }
 
 // DeriveKeyFromPassword derives an encryption key from a password using PBKDF2
@@ -51,63 +165,186 @@ func GenerateSalt() ([]byte, error) {
 }
 
 // GenerateKey generates a random encryption key
-func GenerateKey() ([]byte, error) {
-	key := make([]byte, keySize)
-	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+func GenerateKey() (*Secret, error) {
+	key, err := NewSecret(keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
 		return nil, err
 	}
 	return key, nil
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM
-func (e *MessageEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// Encrypt encrypts plaintext using AES-256-GCM with the active key and
+// returns a versioned envelope carrying the key ID
+func (e *MessageEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	return e.Seal(plaintext, nil)
+}
+
+// Seal is Encrypt, also authenticating additionalData, which Open must be
+// given again. It binds a ciphertext to where it belongs, such as its
+// position in a file.
+func (e *MessageEncryptor) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(e.key.Bytes())
 	if err != nil {
 		return nil, err
 	}
 
+	header := make([]byte, headerSize, headerSize+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	header[0] = envelopeVersion
+	copy(header[1:], e.keyID[:])
+
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, append(out[:headerSize:headerSize], additionalData...)), nil
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM
-func (e *MessageEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
+// Open decrypts a ciphertext from Seal with the key named in its envelope
+func (e *MessageEncryptor) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < headerSize+nonceSize || ciphertext[0] != envelopeVersion {
+		return nil, errors.New("not a versioned ciphertext")
+	}
+
+	var id [keyIDSize]byte
+	copy(id[:], ciphertext[1:headerSize])
+	key := e.lookup(id)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	return openEnvelope(key.Bytes(), ciphertext, additionalData)
+}
+
+// MAC returns the HMAC-SHA256 of data under a key derived from the key
+// with ID keyID, the active key or a retired one
+func (e *MessageEncryptor) MAC(keyID string, data []byte) ([]byte, error) {
+	b, err := hex.DecodeString(keyID)
+	if err != nil || len(b) != keyIDSize {
+		return nil, fmt.Errorf("invalid key id %q", keyID)
+	}
+
+	key := e.lookup([keyIDSize]byte(b))
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	macKey, err := hkdf.Key(sha256.New, key.Bytes(), nil, string(macContext), sha256.Size)
 	if err != nil {
 		return nil, err
 	}
+	defer Wipe(macKey)
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// Decrypt decrypts ciphertext using AES-256-GCM. Versioned envelopes are
+// opened with the key named in their header; unversioned ciphertexts written
+// before key IDs were introduced are tried against every known key.
+func (e *MessageEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	var id [keyIDSize]byte
+	versioned := len(ciphertext) >= headerSize+nonceSize && ciphertext[0] == envelopeVersion
+	if versioned {
+		copy(id[:], ciphertext[1:headerSize])
+		if key := e.lookup(id); key != nil {
+			if plaintext, err := openEnvelope(key.Bytes(), ciphertext, nil); err == nil {
+				return plaintext, nil
+			}
+		}
+	}
+
+	// legacy format: nonce | sealed data
+	for _, key := range e.keys() {
+		if plaintext, err := openLegacy(key.Bytes(), ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	if versioned && e.lookup(id) == nil {
+		return nil, ErrUnknownKey
+	}
+	return nil, errors.New("message authentication failed")
+}
+
+// NeedsReEncrypt reports whether ciphertext is not sealed with the active key
+func (e *MessageEncryptor) NeedsReEncrypt(ciphertext []byte) bool {
+	if len(ciphertext) < headerSize+nonceSize || ciphertext[0] != envelopeVersion {
+		return true
+	}
+	return !bytes.Equal(ciphertext[1:headerSize], e.keyID[:])
+}
+
+func (e *MessageEncryptor) lookup(id [keyIDSize]byte) *Secret {
+	if id == e.keyID {
+		return e.key
+	}
+	return e.retired[id]
+}
+
+// keys returns the active key followed by all retired keys
+func (e *MessageEncryptor) keys() []*Secret {
+	keys := []*Secret{e.key}
+	for _, key := range e.retired {
+		keys = append(keys, key)
+	}
+	return keys
+}
 
-	gcm, err := cipher.NewGCM(block)
+func openEnvelope(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(ciphertext) < gcm.NonceSize() {
+	header, rest := ciphertext[:headerSize], ciphertext[headerSize:]
+	if len(rest) < gcm.NonceSize() {
 		return nil, errors.New("ciphertext too short")
 	}
 
-	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	nonce, sealed := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, append(header[:headerSize:headerSize], additionalData...))
+}
+
+func openLegacy(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return plaintext, nil
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
 }
 
 // EncryptString encrypts a string and returns base64-encoded ciphertext
 func (e *MessageEncryptor) EncryptString(plaintext string) (string, error) {
-	encrypted, err := e.Encrypt([]byte(plaintext))
+	return e.EncryptBytes([]byte(plaintext))
+}
+
+// EncryptBytes encrypts plaintext and returns base64-encoded ciphertext.
+// Unlike EncryptString, it leaves no copy of plaintext behind, so the caller
+// can wipe it afterwards.
+func (e *MessageEncryptor) EncryptBytes(plaintext []byte) (string, error) {
+	encrypted, err := e.Encrypt(plaintext)
 	if err != nil {
 		return "", err
 	}
@@ -116,14 +353,41 @@ func (e *MessageEncryptor) EncryptString(plaintext string) (string, error) {
 
 // DecryptString decrypts a base64-encoded ciphertext string
 func (e *MessageEncryptor) DecryptString(ciphertext string) (string, error) {
+	decrypted, err := e.DecryptBytes(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(decrypted)
+	return string(decrypted), nil
+}
+
+// DecryptBytes decrypts a base64-encoded ciphertext string into a slice the
+// caller can wipe once done with it, which strings from DecryptString don't
+// allow
+func (e *MessageEncryptor) DecryptBytes(ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return e.Decrypt(data)
+}
+
+// ReEncryptString decrypts a base64-encoded ciphertext with whichever known key
+// sealed it and encrypts it again with the active key. Ciphertexts already
+// sealed with the active key are returned unchanged.
+func (e *MessageEncryptor) ReEncryptString(ciphertext string) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
+	if !e.NeedsReEncrypt(data) {
+		return ciphertext, nil
+	}
+
 	decrypted, err := e.Decrypt(data)
 	if err != nil {
 		return "", err
 	}
-	return string(decrypted), nil
+	defer Wipe(decrypted)
+	return e.EncryptBytes(decrypted)
 }
-
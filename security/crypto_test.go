@@ -0,0 +1,151 @@
+package security
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+)
+
+func mustKey(t *testing.T) *Secret {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(key.Destroy)
+	return key
+}
+
+func TestEncryptEnvelope(t *testing.T) {
+	key := mustKey(t)
+	e, err := NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := e.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ciphertext[0] != envelopeVersion {
+		t.Fatalf("expected version %d, got %d", envelopeVersion, ciphertext[0])
+	}
+
+	id, err := CiphertextKeyID(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != KeyID(key.Bytes()) || id != e.KeyID() {
+		t.Fatalf("expected key id %s, got %s", KeyID(key.Bytes()), id)
+	}
+
+	plaintext, err := e.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "hello" {
+		t.Fatalf("expected hello, got %q", plaintext)
+	}
+
+	// the header is authenticated
+	tampered := bytes.Clone(ciphertext)
+	tampered[0] = 0x02
+	if _, err := e.Decrypt(tampered); err == nil {
+		t.Fatal("expected error decrypting tampered header")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	key := mustKey(t)
+	e, err := NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seal in the pre-envelope format: nonce | sealed data
+	gcm, err := newGCM(key.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatal(err)
+	}
+	legacy := gcm.Seal(nonce, nonce, []byte("legacy"), nil)
+
+	plaintext, err := e.Decrypt(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "legacy" {
+		t.Fatalf("expected legacy, got %q", plaintext)
+	}
+
+	if !e.NeedsReEncrypt(legacy) {
+		t.Fatal("expected legacy ciphertext to need re-encryption")
+	}
+}
+
+func TestRetiredKeys(t *testing.T) {
+	oldKey, newKey := mustKey(t), mustKey(t)
+
+	old, err := NewMessageEncryptor(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := old.EncryptString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewMessageEncryptor(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.DecryptString(ciphertext); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	retired, err := oldKey.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddRetiredKey(retired); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := e.DecryptString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "secret" {
+		t.Fatalf("expected secret, got %q", plaintext)
+	}
+
+	reEncrypted, err := e.ReEncryptString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(reEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := CiphertextKeyID(data); id != e.KeyID() {
+		t.Fatalf("expected re-encrypted key id %s, got %s", e.KeyID(), id)
+	}
+
+	// already sealed with the active key
+	again, err := e.ReEncryptString(reEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != reEncrypted {
+		t.Fatal("expected ciphertext under the active key to be unchanged")
+	}
+}
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -34,17 +35,21 @@ type LocalhostOnlyDialer struct {
 
 // Dial implements the Dial interface
 func (d *LocalhostOnlyDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr if its host is a loopback address or localhost
+func (d *LocalhostOnlyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Only allow localhost/127.0.0.1
-	if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+
+	if !isLoopbackHost(host) {
 		return nil, fmt.Errorf("connection to %s blocked by security policy (only localhost allowed)", host)
 	}
-	
-	return d.Dialer.Dial(network, addr)
+
+	return d.Dialer.DialContext(ctx, network, addr)
 }
 
 // NewLocalhostOnlyClient creates an HTTP client that can only connect to localhost
@@ -55,7 +60,7 @@ func NewLocalhostOnlyClient() *http.Client {
 			KeepAlive: 30 * time.Second,
 		},
 	}
-	
+
 	return &http.Client{
 		Timeout: 30 * time.Second,
 		Transport: &http.Transport{
@@ -68,3 +73,20 @@ func NewLocalhostOnlyClient() *http.Client {
 	}
 }
 
+// NewUnixSocketClient creates an HTTP client that sends every request over the
+// Unix socket at path, regardless of the host in the request URL. It's used to
+// talk to runner processes, which have no network access of their own.
+func NewUnixSocketClient(path string) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
@@ -2,6 +2,11 @@ package security
 
 import (
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ollama/ollama/envconfig"
 )
 
 const (
@@ -9,32 +14,112 @@ const (
 	KeystoreService = "secllama"
 	// EncryptionKeyAccount is the account name for the main encryption key
 	EncryptionKeyAccount = "message-encryption-key"
+	// KeyringAccount is the account name holding the IDs of retired encryption keys
+	KeyringAccount = "message-encryption-keyring"
 )
 
+// ErrKeyExpired is returned by KeyStores whose keys can expire, such as the
+// kernel keyring with SECLLAMA_KEYRING_TIMEOUT, for keys that expired or were
+// revoked
+var ErrKeyExpired = errors.New("key expired or was revoked")
+
 // KeyStore provides secure storage for encryption keys using OS-native mechanisms
 type KeyStore interface {
 	// StoreKey stores a key securely in the OS keychain/credential manager
 	StoreKey(account string, key []byte) error
-	// RetrieveKey retrieves a key from the OS keychain/credential manager
-	RetrieveKey(account string) ([]byte, error)
+	// RetrieveKey retrieves a key from the OS keychain/credential manager. The
+	// caller destroys the Secret once done with it.
+	RetrieveKey(account string) (*Secret, error)
 	// DeleteKey removes a key from the OS keychain/credential manager
 	DeleteKey(account string) error
 	// KeyExists checks if a key exists in the keystore
 	KeyExists(account string) bool
 }
 
-// GetKeyStore returns the appropriate KeyStore implementation for the current OS
-// Implementation is in platform-specific files (keystore_*.go)
+// GetKeyStore returns the first KeyStore that can be opened from the backends
+// listed in SECLLAMA_KEYSTORE. By default the OS-native implementation is used
+// (see the platform-specific keystore_*.go files), falling back to the
+// passphrase-protected file keystore when the native store is unavailable, e.g.
+// on headless Linux without secret-tool.
 func GetKeyStore() (KeyStore, error) {
-	return newKeyStore()
+	ks, _, err := getKeyStore()
+	return ks, err
+}
+
+// getKeyStore is GetKeyStore, also returning the name of the backend in use
+func getKeyStore() (KeyStore, string, error) {
+	backends := envconfig.KeyStoreBackends()
+	if len(backends) == 0 {
+		return nil, "", errors.New("no keystore backend configured")
+	}
+
+	var errs []error
+	for _, backend := range backends {
+		ks, err := openKeyStore(backend)
+		if err == nil {
+			slog.Debug("using keystore", "backend", backend)
+			return ks, backend, nil
+		}
+
+		slog.Warn("keystore backend unavailable", "backend", backend, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", backend, err))
+	}
+
+	return nil, "", errors.Join(errs...)
 }
 
-// Base64Key helper functions for encoding/decoding keys
-func EncodeKey(key []byte) string {
-	return base64.StdEncoding.EncodeToString(key)
+// openKeyStore opens the named KeyStore backend
+func openKeyStore(backend string) (KeyStore, error) {
+	switch backend {
+	case "native":
+		return newKeyStore()
+	case "keyring":
+		return NewKeyringKeyStore()
+	case "file":
+		return NewFileKeyStore()
+	default:
+		return nil, fmt.Errorf("unknown keystore backend %q", backend)
+	}
 }
 
-func DecodeKey(encoded string) ([]byte, error) {
-	return base64.StdEncoding.DecodeString(encoded)
+// retiredKeyAccount returns the account name a retired encryption key is kept under
+func retiredKeyAccount(id string) string {
+	return EncryptionKeyAccount + "." + id
 }
 
+// EncodeKey base64 encodes a key for backends that store text. The caller
+// wipes the result once done with it.
+func EncodeKey(key []byte) []byte {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(key)))
+	base64.StdEncoding.Encode(encoded, key)
+	return encoded
+}
+
+// DecodeKey decodes a key encoded by EncodeKey straight into a Secret. The
+// caller wipes encoded.
+func DecodeKey(encoded []byte) (*Secret, error) {
+	key, err := NewSecret(base64.StdEncoding.DecodedLen(len(encoded)))
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := base64.StdEncoding.Decode(key.Bytes(), encoded)
+	if err != nil {
+		key.Destroy()
+		return nil, err
+	}
+
+	if n == key.Len() {
+		return key, nil
+	}
+
+	// padding makes the decoded length shorter than DecodedLen
+	defer key.Destroy()
+	trimmed, err := NewSecret(n)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(trimmed.Bytes(), key.Bytes())
+	return trimmed, nil
+}
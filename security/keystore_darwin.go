@@ -1,9 +1,9 @@
 package security
 
 import (
+	"bytes"
 	"fmt"
 	"os/exec"
-	"strings"
 )
 
 // KeychainKeyStore implements KeyStore using macOS Keychain
@@ -22,43 +22,45 @@ func NewKeychainKeyStore() (*KeychainKeyStore, error) {
 // StoreKey stores a key in macOS Keychain
 func (k *KeychainKeyStore) StoreKey(account string, key []byte) error {
 	encoded := EncodeKey(key)
-	
+	defer Wipe(encoded)
+
 	// First, try to delete any existing key
 	_ = k.DeleteKey(account)
-	
-	// Add new key
+
+	// Add new key. security only takes the password as an argument, so it
+	// passes through a string that can't be wiped.
 	cmd := exec.Command("security", "add-generic-password",
 		"-s", KeystoreService,
 		"-a", account,
-		"-w", encoded,
+		"-w", string(encoded),
 		"-U") // Update if exists
-	
+
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to store key in keychain: %v, output: %s", err, string(output))
 	}
-	
+
 	return nil
 }
 
 // RetrieveKey retrieves a key from macOS Keychain
-func (k *KeychainKeyStore) RetrieveKey(account string) ([]byte, error) {
+func (k *KeychainKeyStore) RetrieveKey(account string) (*Secret, error) {
 	cmd := exec.Command("security", "find-generic-password",
 		"-s", KeystoreService,
 		"-a", account,
 		"-w") // Output password only
-	
+
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve key from keychain: %v", err)
 	}
-	
-	encoded := strings.TrimSpace(string(output))
-	key, err := DecodeKey(encoded)
+	defer Wipe(output)
+
+	key, err := DecodeKey(bytes.TrimSpace(output))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode key: %v", err)
 	}
-	
+
 	return key, nil
 }
 
@@ -67,7 +69,7 @@ func (k *KeychainKeyStore) DeleteKey(account string) error {
 	cmd := exec.Command("security", "delete-generic-password",
 		"-s", KeystoreService,
 		"-a", account)
-	
+
 	_ = cmd.Run() // Ignore errors (key might not exist)
 	return nil
 }
@@ -77,8 +79,7 @@ func (k *KeychainKeyStore) KeyExists(account string) bool {
 	cmd := exec.Command("security", "find-generic-password",
 		"-s", KeystoreService,
 		"-a", account)
-	
+
 	err := cmd.Run()
 	return err == nil
 }
-
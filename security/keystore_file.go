@@ -0,0 +1,403 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+const (
+	fileKeyStoreVersion = 1
+	fileKeyStoreHeader  = "keystore.json"
+
+	// Argon2id parameters for newly created file keystores
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+
+	// Bounds on the Argon2id parameters read from a keystore header. Outside
+	// them a damaged or tampered header would make the KDF panic or exhaust
+	// memory before the passphrase is even checked.
+	argon2MaxTime    = 16
+	argon2MaxMemory  = 1024 * 1024 // KiB
+	argon2MaxThreads = 64
+)
+
+var (
+	// ErrNoPassphrase is returned when the file keystore needs a passphrase but none was supplied
+	ErrNoPassphrase = errors.New("file keystore passphrase required: set SECLLAMA_KEYSTORE_PASSPHRASE, SECLLAMA_KEYSTORE_PASSPHRASE_FD or run in a terminal")
+	// ErrIncorrectPassphrase is returned when the passphrase does not unlock the file keystore
+	ErrIncorrectPassphrase = errors.New("incorrect file keystore passphrase")
+
+	accountPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	checkPlaintext = []byte("secllama file keystore")
+)
+
+// PassphraseFunc supplies the passphrase protecting a file keystore. confirm is
+// true when the keystore is being created and the passphrase should be confirmed.
+type PassphraseFunc func(confirm bool) ([]byte, error)
+
+// fileKeyStoreParams records how the wrapping key of a file keystore is derived
+type fileKeyStoreParams struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	// Check is a known value sealed with the wrapping key so that a wrong
+	// passphrase is detected when the keystore is opened
+	Check []byte `json:"check"`
+}
+
+// FileKeyStore implements KeyStore with one file per account under
+// ~/.secllama/keys. Each key is sealed with AES-256-GCM under a wrapping key
+// derived from a passphrase with Argon2id.
+type FileKeyStore struct {
+	dir string
+	kek *MessageEncryptor
+	mu  sync.Mutex
+}
+
+// DefaultFileKeyStoreDir returns the directory used by the file keystore
+func DefaultFileKeyStoreDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secllama", "keys"), nil
+}
+
+// NewFileKeyStore opens the file keystore in its default location, reading the
+// passphrase from the environment, a file descriptor or a terminal prompt
+func NewFileKeyStore() (*FileKeyStore, error) {
+	dir, err := DefaultFileKeyStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenFileKeyStore(dir, ReadPassphrase)
+}
+
+// OpenFileKeyStore opens or creates a file keystore in dir
+func OpenFileKeyStore(dir string, passphrase PassphraseFunc) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+
+	path := filepath.Join(dir, fileKeyStoreHeader)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createFileKeyStore(dir, passphrase)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read keystore header: %v", err)
+	}
+
+	var params fileKeyStoreParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore header: %v", err)
+	}
+
+	if params.Version != fileKeyStoreVersion || params.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported keystore format: version %d, kdf %q", params.Version, params.KDF)
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("invalid keystore header: %v", err)
+	}
+
+	pass, err := passphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(pass)
+
+	kek, err := deriveWrappingKey(pass, params)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := kek.open(params.Check, []byte(fileKeyStoreHeader))
+	if err != nil || string(check) != string(checkPlaintext) {
+		kek.Destroy()
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return &FileKeyStore{dir: dir, kek: kek}, nil
+}
+
+func createFileKeyStore(dir string, passphrase PassphraseFunc) (*FileKeyStore, error) {
+	pass, err := passphrase(true)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(pass)
+
+	salt, err := GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	params := fileKeyStoreParams{
+		Version: fileKeyStoreVersion,
+		KDF:     "argon2id",
+		Salt:    salt,
+		Time:    argon2Time,
+		Memory:  argon2Memory,
+		Threads: argon2Threads,
+	}
+
+	kek, err := deriveWrappingKey(pass, params)
+	if err != nil {
+		return nil, err
+	}
+
+	params.Check, err = kek.seal(checkPlaintext, []byte(fileKeyStoreHeader))
+	if err != nil {
+		kek.Destroy()
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		kek.Destroy()
+		return nil, err
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, fileKeyStoreHeader), data); err != nil {
+		kek.Destroy()
+		return nil, fmt.Errorf("failed to write keystore header: %v", err)
+	}
+
+	return &FileKeyStore{dir: dir, kek: kek}, nil
+}
+
+// validate checks that the Argon2id parameters are within bounds
+func (p fileKeyStoreParams) validate() error {
+	if p.Time < 1 || p.Time > argon2MaxTime {
+		return fmt.Errorf("argon2 time %d out of range 1-%d", p.Time, argon2MaxTime)
+	}
+	if p.Threads < 1 || p.Threads > argon2MaxThreads {
+		return fmt.Errorf("argon2 threads %d out of range 1-%d", p.Threads, argon2MaxThreads)
+	}
+	if minMemory := 8 * uint32(p.Threads); p.Memory < minMemory || p.Memory > argon2MaxMemory {
+		return fmt.Errorf("argon2 memory %d KiB out of range %d-%d KiB", p.Memory, minMemory, argon2MaxMemory)
+	}
+	return nil
+}
+
+// DeriveKeyFromPassphrase derives a key from a passphrase with the memory-hard Argon2id KDF
+func DeriveKeyFromPassphrase(passphrase, salt []byte, time, memory uint32, threads uint8) []byte {
+	return argon2.IDKey(passphrase, salt, time, memory, threads, keySize)
+}
+
+func deriveWrappingKey(passphrase []byte, params fileKeyStoreParams) (*MessageEncryptor, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("file keystore passphrase must not be empty")
+	}
+	if len(params.Salt) != saltSize {
+		return nil, errors.New("invalid keystore salt")
+	}
+
+	key, err := NewSecretFrom(DeriveKeyFromPassphrase(passphrase, params.Salt, params.Time, params.Memory, params.Threads))
+	if err != nil {
+		return nil, err
+	}
+	return NewMessageEncryptor(key)
+}
+
+// seal encrypts plaintext with the active key, binding it to associated data
+func (e *MessageEncryptor) seal(plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(e.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts data produced by seal with the same associated data
+func (e *MessageEncryptor) open(ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(e.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, additionalData)
+}
+
+func (f *FileKeyStore) path(account string) (string, error) {
+	if !accountPattern.MatchString(account) {
+		return "", fmt.Errorf("invalid account name %q", account)
+	}
+	return filepath.Join(f.dir, account+".key"), nil
+}
+
+// StoreKey seals a key and writes it to the account's key file
+func (f *FileKeyStore) StoreKey(account string, key []byte) error {
+	path, err := f.path(account)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := f.kek.seal(key, []byte(account))
+	if err != nil {
+		return fmt.Errorf("failed to seal key: %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := writeFileAtomic(path, sealed); err != nil {
+		return fmt.Errorf("failed to store key: %v", err)
+	}
+	return nil
+}
+
+// RetrieveKey reads and unseals the account's key file
+func (f *FileKeyStore) RetrieveKey(account string) (*Secret, error) {
+	path, err := f.path(account)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	sealed, err := os.ReadFile(path)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve key: %v", err)
+	}
+
+	key, err := f.kek.open(sealed, []byte(account))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal key: %v", err)
+	}
+	return NewSecretFrom(key)
+}
+
+// DeleteKey removes the account's key file
+func (f *FileKeyStore) DeleteKey(account string) error {
+	path, err := f.path(account)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete key: %v", err)
+	}
+	return nil
+}
+
+// KeyExists checks if the account's key file exists
+func (f *FileKeyStore) KeyExists(account string) bool {
+	path, err := f.path(account)
+	if err != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Close wipes the wrapping key. The keystore can't be used afterwards.
+func (f *FileKeyStore) Close() error {
+	f.kek.Destroy()
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadPassphrase reads the file keystore passphrase from SECLLAMA_KEYSTORE_PASSPHRASE,
+// from the file descriptor named by SECLLAMA_KEYSTORE_PASSPHRASE_FD, or by
+// prompting on the terminal, in that order
+func ReadPassphrase(confirm bool) ([]byte, error) {
+	if pass := envconfig.KeyStorePassphrase(); pass != "" {
+		// runners and other children inherit the environment; they have no
+		// use for the passphrase
+		os.Unsetenv("SECLLAMA_KEYSTORE_PASSPHRASE")
+		return []byte(pass), nil
+	}
+
+	if s := envconfig.KeyStorePassphraseFD(); s != "" {
+		fd, err := strconv.Atoi(s)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid SECLLAMA_KEYSTORE_PASSPHRASE_FD %q", s)
+		}
+		return readPassphraseFD(uintptr(fd))
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return nil, ErrNoPassphrase
+	}
+
+	fmt.Fprint(os.Stderr, "Enter keystore passphrase: ")
+	pass, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm keystore passphrase: ")
+		again, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(pass) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	return pass, nil
+}
+
+// readPassphraseFD reads a passphrase from an inherited file descriptor. Only
+// the first line is used and the descriptor is closed afterwards.
+func readPassphraseFD(fd uintptr) ([]byte, error) {
+	f := os.NewFile(fd, "passphrase")
+	if f == nil {
+		return nil, fmt.Errorf("invalid passphrase file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase from file descriptor %d: %v", fd, err)
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	return []byte(strings.TrimSuffix(line, "\r")), nil
+}
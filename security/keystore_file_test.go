@@ -0,0 +1,179 @@
+package security
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func staticPassphrase(pass string) PassphraseFunc {
+	return func(bool) ([]byte, error) {
+		return []byte(pass), nil
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	dir := t.TempDir()
+
+	ks, err := OpenFileKeyStore(dir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ks.KeyExists(EncryptionKeyAccount) {
+		t.Fatal("expected empty keystore")
+	}
+
+	key := mustKey(t)
+	if err := ks.StoreKey(EncryptionKeyAccount, key.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// key material never touches disk in the clear
+	sealed, err := os.ReadFile(filepath.Join(dir, EncryptionKeyAccount+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, key.Bytes()) {
+		t.Fatal("key file contains the plaintext key")
+	}
+
+	reopened, err := OpenFileKeyStore(dir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reopened.RetrieveKey(EncryptionKeyAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Destroy()
+	if !bytes.Equal(got.Bytes(), key.Bytes()) {
+		t.Fatal("retrieved key does not match stored key")
+	}
+
+	if err := reopened.DeleteKey(EncryptionKeyAccount); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.KeyExists(EncryptionKeyAccount) {
+		t.Fatal("expected key to be deleted")
+	}
+}
+
+func TestFileKeyStoreIncorrectPassphrase(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenFileKeyStore(dir, staticPassphrase("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenFileKeyStore(dir, staticPassphrase("battery staple")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("expected ErrIncorrectPassphrase, got %v", err)
+	}
+}
+
+func TestFileKeyStoreParamBounds(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenFileKeyStore(dir, staticPassphrase("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, fileKeyStoreHeader)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*fileKeyStoreParams)
+	}{
+		{"zero time", func(p *fileKeyStoreParams) { p.Time = 0 }},
+		{"zero threads", func(p *fileKeyStoreParams) { p.Threads = 0 }},
+		{"huge memory", func(p *fileKeyStoreParams) { p.Memory = math.MaxUint32 }},
+		{"too little memory", func(p *fileKeyStoreParams) { p.Memory = 8 }},
+		{"huge time", func(p *fileKeyStoreParams) { p.Time = math.MaxUint32 }},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var params fileKeyStoreParams
+			if err := json.Unmarshal(data, &params); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&params)
+
+			modified, err := json.Marshal(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, modified, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			asked := false
+			_, err = OpenFileKeyStore(dir, func(bool) ([]byte, error) {
+				asked = true
+				return []byte("correct horse"), nil
+			})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if asked {
+				t.Error("expected the header to be rejected before asking for the passphrase")
+			}
+		})
+	}
+}
+
+func TestFileKeyStoreAccountBinding(t *testing.T) {
+	dir := t.TempDir()
+
+	ks, err := OpenFileKeyStore(dir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.StoreKey("a", mustKey(t).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a key file copied to another account does not unseal
+	if err := os.Rename(filepath.Join(dir, "a.key"), filepath.Join(dir, "b.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.RetrieveKey("b"); err == nil {
+		t.Fatal("expected error retrieving key moved between accounts")
+	}
+
+	if err := ks.StoreKey("../escape", mustKey(t).Bytes()); err == nil {
+		t.Fatal("expected error for invalid account name")
+	}
+}
+
+func TestReadPassphraseEnv(t *testing.T) {
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE", "from env")
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE_FD", "3")
+
+	pass, err := ReadPassphrase(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pass) != "from env" {
+		t.Fatalf("expected %q, got %q", "from env", pass)
+	}
+	if _, ok := os.LookupEnv("SECLLAMA_KEYSTORE_PASSPHRASE"); ok {
+		t.Fatal("expected the passphrase to be removed from the environment")
+	}
+
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE", "")
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE_FD", "not-a-number")
+	if _, err := ReadPassphrase(false); err == nil {
+		t.Fatal("expected error for invalid file descriptor")
+	}
+}
@@ -0,0 +1,148 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// keyringPerm grants the possessor and the owning user full access to a key,
+// and nothing to anyone else
+const keyringPerm = 0x3f3f0000
+
+// KeyringKeyStore implements KeyStore using the Linux kernel keyring. Keys are
+// held in kernel memory only: they never touch disk, don't need a D-Bus secret
+// service, and are lost on reboot. Keys can optionally expire after a period of
+// inactivity; every access resets the timeout.
+type KeyringKeyStore struct {
+	ringID  int
+	timeout time.Duration
+}
+
+// NewKeyringKeyStore creates a KeyringKeyStore configured from SECLLAMA_KEYRING
+// and SECLLAMA_KEYRING_TIMEOUT
+func NewKeyringKeyStore() (*KeyringKeyStore, error) {
+	ringID := unix.KEY_SPEC_USER_KEYRING
+	switch ring := envconfig.Keyring(); ring {
+	case "", "user":
+	case "session":
+		ringID = unix.KEY_SPEC_SESSION_KEYRING
+	default:
+		return nil, fmt.Errorf("unknown kernel keyring %q", ring)
+	}
+
+	return newKeyringKeyStore(ringID, envconfig.KeyringTimeout())
+}
+
+func newKeyringKeyStore(ringID int, timeout time.Duration) (*KeyringKeyStore, error) {
+	// resolve the keyring, creating it if needed, to check keyctl is usable
+	id, err := unix.KeyctlGetKeyringID(ringID, true)
+	if err != nil {
+		return nil, fmt.Errorf("kernel keyring unavailable: %v", err)
+	}
+
+	return &KeyringKeyStore{ringID: id, timeout: timeout}, nil
+}
+
+func keyringDescription(account string) string {
+	return KeystoreService + ":" + account
+}
+
+func (k *KeyringKeyStore) search(account string) (int, error) {
+	return unix.KeyctlSearch(k.ringID, "user", keyringDescription(account), 0)
+}
+
+// keyringError describes err, wrapping ErrKeyExpired for keys that expired or
+// were revoked
+func keyringError(msg string, err error) error {
+	if errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+		return fmt.Errorf("%s: %w", msg, ErrKeyExpired)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
+
+// touch resets the expiry of a key so it only expires after the configured idle period
+func (k *KeyringKeyStore) touch(id int) error {
+	if k.timeout <= 0 {
+		return nil
+	}
+
+	seconds := max(int(k.timeout/time.Second), 1)
+	_, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, seconds, 0, 0)
+	return err
+}
+
+// StoreKey adds a key to the keyring, replacing any existing key for the account
+func (k *KeyringKeyStore) StoreKey(account string, key []byte) error {
+	id, err := unix.AddKey("user", keyringDescription(account), key, k.ringID)
+	if err != nil {
+		return fmt.Errorf("failed to store key in kernel keyring: %v", err)
+	}
+
+	if err := unix.KeyctlSetperm(id, keyringPerm); err != nil {
+		return fmt.Errorf("failed to set key permissions: %v", err)
+	}
+
+	if err := k.touch(id); err != nil {
+		return fmt.Errorf("failed to set key timeout: %v", err)
+	}
+
+	return nil
+}
+
+// RetrieveKey reads a key from the keyring
+func (k *KeyringKeyStore) RetrieveKey(account string) (*Secret, error) {
+	id, err := k.search(account)
+	if err != nil {
+		return nil, keyringError("failed to retrieve key from kernel keyring", err)
+	}
+
+	// KEYCTL_READ returns the payload size, which may have changed between calls
+	for {
+		size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+		if err != nil {
+			return nil, keyringError("failed to read key from kernel keyring", err)
+		}
+
+		buf := make([]byte, size)
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			Wipe(buf)
+			return nil, keyringError("failed to read key from kernel keyring", err)
+		}
+
+		if n <= size {
+			defer Wipe(buf)
+			if err := k.touch(id); err != nil {
+				return nil, fmt.Errorf("failed to refresh key timeout: %v", err)
+			}
+			return NewSecretFrom(buf[:n])
+		}
+		Wipe(buf)
+	}
+}
+
+// DeleteKey invalidates a key so it is removed from every keyring
+func (k *KeyringKeyStore) DeleteKey(account string) error {
+	id, err := k.search(account)
+	if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to find key in kernel keyring: %v", err)
+	}
+
+	if _, err := unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to delete key from kernel keyring: %v", err)
+	}
+	return nil
+}
+
+// KeyExists checks if an unexpired key exists in the keyring
+func (k *KeyringKeyStore) KeyExists(account string) bool {
+	_, err := k.search(account)
+	return err == nil
+}
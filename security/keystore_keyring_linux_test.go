@@ -0,0 +1,83 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// newTestKeyringKeyStore uses the process keyring so tests never touch the
+// user's real keyring
+func newTestKeyringKeyStore(t *testing.T, timeout time.Duration) *KeyringKeyStore {
+	t.Helper()
+	ks, err := newKeyringKeyStore(unix.KEY_SPEC_PROCESS_KEYRING, timeout)
+	if err != nil {
+		t.Skipf("kernel keyring unavailable: %v", err)
+	}
+	return ks
+}
+
+func TestKeyringKeyStore(t *testing.T) {
+	ks := newTestKeyringKeyStore(t, 0)
+	account := "test-" + t.Name()
+	t.Cleanup(func() { _ = ks.DeleteKey(account) })
+
+	if ks.KeyExists(account) {
+		t.Fatal("expected key to not exist")
+	}
+
+	key := mustKey(t)
+	if err := ks.StoreKey(account, key.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ks.RetrieveKey(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Destroy()
+	if !bytes.Equal(got.Bytes(), key.Bytes()) {
+		t.Fatal("retrieved key does not match stored key")
+	}
+
+	// storing again replaces the key
+	replacement := mustKey(t)
+	if err := ks.StoreKey(account, replacement.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ks.RetrieveKey(account); err != nil || !bytes.Equal(got.Bytes(), replacement.Bytes()) {
+		t.Fatal("expected key to be replaced")
+	}
+
+	if err := ks.DeleteKey(account); err != nil {
+		t.Fatal(err)
+	}
+	if ks.KeyExists(account) {
+		t.Fatal("expected key to be deleted")
+	}
+	if err := ks.DeleteKey(account); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func TestKeyringKeyStoreTimeout(t *testing.T) {
+	ks := newTestKeyringKeyStore(t, time.Second)
+	account := "test-" + t.Name()
+	t.Cleanup(func() { _ = ks.DeleteKey(account) })
+
+	if err := ks.StoreKey(account, mustKey(t).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ks.KeyExists(account) {
+		t.Fatal("expected key to exist before the timeout")
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if ks.KeyExists(account) {
+		t.Fatal("expected key to expire after the timeout")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package security
+
+import (
+	"errors"
+	"runtime"
+)
+
+// KeyringKeyStore is only available on Linux
+type KeyringKeyStore struct {
+	KeyStore
+}
+
+// NewKeyringKeyStore always fails: the kernel keyring is only available on Linux
+func NewKeyringKeyStore() (*KeyringKeyStore, error) {
+	return nil, errors.New("kernel keyring keystore is not supported on " + runtime.GOOS)
+}
@@ -1,9 +1,9 @@
 package security
 
 import (
+	"bytes"
 	"fmt"
 	"os/exec"
-	"strings"
 )
 
 // SecretServiceKeyStore implements KeyStore using Linux Secret Service (gnome-keyring/kwallet)
@@ -32,38 +32,39 @@ func NewSecretServiceKeyStore() (*SecretServiceKeyStore, error) {
 // StoreKey stores a key using secret-tool
 func (s *SecretServiceKeyStore) StoreKey(account string, key []byte) error {
 	encoded := EncodeKey(key)
-	
+	defer Wipe(encoded)
+
 	cmd := exec.Command("secret-tool", "store",
 		"--label", fmt.Sprintf("SecLlama %s", account),
 		"service", KeystoreService,
 		"account", account)
-	
-	cmd.Stdin = strings.NewReader(encoded)
+
+	cmd.Stdin = bytes.NewReader(encoded)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to store key: %v, output: %s", err, string(output))
 	}
-	
+
 	return nil
 }
 
 // RetrieveKey retrieves a key using secret-tool
-func (s *SecretServiceKeyStore) RetrieveKey(account string) ([]byte, error) {
+func (s *SecretServiceKeyStore) RetrieveKey(account string) (*Secret, error) {
 	cmd := exec.Command("secret-tool", "lookup",
 		"service", KeystoreService,
 		"account", account)
-	
+
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve key: %v", err)
 	}
-	
-	encoded := strings.TrimSpace(string(output))
-	key, err := DecodeKey(encoded)
+	defer Wipe(output)
+
+	key, err := DecodeKey(bytes.TrimSpace(output))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode key: %v", err)
 	}
-	
+
 	return key, nil
 }
 
@@ -72,7 +73,7 @@ func (s *SecretServiceKeyStore) DeleteKey(account string) error {
 	cmd := exec.Command("secret-tool", "clear",
 		"service", KeystoreService,
 		"account", account)
-	
+
 	_ = cmd.Run() // Ignore errors (key might not exist)
 	return nil
 }
@@ -82,8 +83,7 @@ func (s *SecretServiceKeyStore) KeyExists(account string) bool {
 	cmd := exec.Command("secret-tool", "lookup",
 		"service", KeystoreService,
 		"account", account)
-	
+
 	err := cmd.Run()
 	return err == nil
 }
-
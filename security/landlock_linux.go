@@ -0,0 +1,277 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// LandlockEnv carries the runner's Landlock rules from the parent. Like the
+// seccomp filter, a Landlock domain can't be set up between fork and exec from
+// Go, so the runner applies the rules to itself at startup.
+const LandlockEnv = "SECLLAMA_LANDLOCK_RULES"
+
+// LandlockAppliedEnv replaces LandlockEnv when the runner re-executes itself
+// inside its Landlock domain, and holds the ABI version the rules were applied with
+const LandlockAppliedEnv = "SECLLAMA_LANDLOCK_ABI"
+
+// Landlock access rights, grouped by what the runner needs
+const (
+	landlockReadAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+	landlockWriteAccess = landlockReadAccess |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM |
+		unix.LANDLOCK_ACCESS_FS_REFER |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+
+	landlockDeviceAccess = unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE
+
+	// landlockFileAccess are the only rights that apply to a regular file or
+	// device rather than a directory
+	landlockFileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+// landlockSystemReadPaths are read-only for every runner: the dynamic loader
+// and system libraries GPU drivers are loaded from, and the kernel interfaces
+// used for hardware discovery. Missing paths are skipped. Only the runner's
+// own process is reachable under /proc: every other process's directory,
+// including the server's environment, stays out of reach.
+var landlockSystemReadPaths = []string{
+	"/lib",
+	"/lib64",
+	"/usr/lib",
+	"/usr/lib64",
+	"/usr/local/lib",
+	"/usr/local/cuda",
+	"/opt/rocm",
+	"/etc/ld.so.cache",
+	"/etc/localtime",
+	"/usr/share/zoneinfo",
+	"/proc/self",
+	"/proc/cpuinfo",
+	"/proc/meminfo",
+	"/proc/stat",
+	"/proc/sys/kernel/numa_balancing",
+	"/proc/driver/nvidia",
+	"/sys/devices",
+	"/sys/bus/pci",
+	"/sys/class/drm",
+	"/sys/class/kfd",
+	"/sys/module/amdgpu",
+	"/sys/kernel/mm/transparent_hugepage",
+}
+
+// landlockDevicePaths are GPU and pseudo devices runners open read-write.
+// Entries are glob patterns.
+var landlockDevicePaths = []string{
+	"/dev/null",
+	"/dev/zero",
+	"/dev/random",
+	"/dev/urandom",
+	"/dev/nvidia*",
+	"/dev/nvidia-caps/*",
+	"/dev/dri/*",
+	"/dev/kfd",
+}
+
+// landlockRules is the rule set passed to the runner through LandlockEnv
+type landlockRules struct {
+	Read    []string `json:"read,omitempty"`
+	Write   []string `json:"write,omitempty"`
+	Devices []string `json:"devices,omitempty"`
+}
+
+// GetLandlockStatus reports whether the running kernel supports Landlock and
+// which ABI version it implements
+func GetLandlockStatus() LandlockStatus {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	switch {
+	case errno == unix.ENOSYS:
+		return LandlockStatus{Reason: "kernel was built without Landlock (requires Linux 5.13 or newer)"}
+	case errno == unix.EOPNOTSUPP:
+		return LandlockStatus{Reason: "Landlock is disabled; add landlock to the lsm= kernel boot parameter"}
+	case errno != 0:
+		return LandlockStatus{Reason: fmt.Sprintf("Landlock probe failed: %v", errno)}
+	}
+	return LandlockStatus{ABI: int(abi)}
+}
+
+// SetupLandlock configures cmd to confine itself to config's read and write
+// paths, plus the system libraries and devices every runner needs. It logs and
+// leaves cmd unconfined when the kernel doesn't support Landlock.
+func SetupLandlock(cmd *exec.Cmd, config SandboxConfig) error {
+	status := GetLandlockStatus()
+	if !status.Supported() {
+		slog.Warn("runner filesystem access is not confined", "landlock", status)
+		return nil
+	}
+
+	rules := landlockRules{
+		Read:  append(append([]string{}, config.AllowedReadPaths...), landlockSystemReadPaths...),
+		Write: config.AllowedWritePaths,
+	}
+
+	for _, pattern := range landlockDevicePaths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		rules.Devices = append(rules.Devices, matches...)
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	cmd.Env = setEnv(cmd.Env, LandlockEnv, string(data))
+	slog.Info("runner landlock rules configured", "landlock", status, "read", config.AllowedReadPaths, "write", config.AllowedWritePaths)
+	return nil
+}
+
+// ApplyRunnerLandlock applies the Landlock rules requested by the parent
+// through LandlockEnv. A Landlock domain only covers the thread that creates
+// it, so the rules are applied to a locked thread which then re-executes the
+// runner: the new process and every thread it starts inherit the domain. It
+// does nothing if no rules were requested, and returns only on failure.
+func ApplyRunnerLandlock() error {
+	s, ok := os.LookupEnv(LandlockEnv)
+	if !ok {
+		return nil
+	}
+
+	var rules landlockRules
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return fmt.Errorf("invalid %s: %w", LandlockEnv, err)
+	}
+
+	status := GetLandlockStatus()
+	if !status.Supported() {
+		slog.Warn("runner filesystem access is not confined", "landlock", status)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// never unlocked: exec replaces the process from this thread
+	runtime.LockOSThread()
+
+	if err := restrictSelf(rules, status.ABI); err != nil {
+		return fmt.Errorf("failed to apply landlock rules: %w", err)
+	}
+
+	slog.Info("landlock applied", "abi", status.ABI, "read", rules.Read, "write", rules.Write)
+	env := setEnv(deleteEnv(os.Environ(), LandlockEnv), LandlockAppliedEnv, strconv.Itoa(status.ABI))
+	return syscall.Exec(exe, os.Args, env)
+}
+
+// landlockHandledAccess returns the filesystem rights Landlock restricts for
+// the given ABI version. Rights a kernel doesn't know about can't be handled,
+// and are therefore left unrestricted.
+func landlockHandledAccess(abi int) uint64 {
+	access := uint64(landlockWriteAccess)
+	if abi < 2 {
+		access &^= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi < 3 {
+		access &^= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	return access
+}
+
+// restrictSelf confines the calling thread to rules
+func restrictSelf(rules landlockRules, abi int) error {
+	handled := landlockHandledAccess(abi)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock_create_ruleset: %w", errno)
+	}
+	defer unix.Close(int(fd))
+
+	add := func(paths []string, access uint64) error {
+		for _, path := range paths {
+			if err := addLandlockRule(int(fd), path, access&handled); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := errors.Join(
+		add(rules.Read, landlockReadAccess),
+		add(rules.Write, landlockWriteAccess),
+		add(rules.Devices, landlockDeviceAccess),
+	); err != nil {
+		return err
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock_restrict_self: %w", errno)
+	}
+
+	return nil
+}
+
+// addLandlockRule allows access beneath path. Paths that don't exist are
+// skipped, and access is narrowed to file rights when path isn't a directory.
+func addLandlockRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileAccess
+	}
+
+	beneath := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&beneath)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock_add_rule %s: %w", path, errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// landlockHelper confines itself with the rules from the parent test and
+// checks which of the paths in SECLLAMA_TEST_DIR it can still reach
+func landlockHelper() error {
+	if err := ApplyRunnerLandlock(); err != nil {
+		return err
+	}
+
+	dir := os.Getenv("SECLLAMA_TEST_DIR")
+
+	if _, err := os.ReadFile(filepath.Join(dir, "model", "blob")); err != nil {
+		return fmt.Errorf("read allowed file: %w", err)
+	}
+
+	if _, err := os.ReadFile(filepath.Join(dir, "secret")); !errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("read disallowed file: expected permission denied, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "model", "blob"), nil, 0o600); !errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("write read-only file: expected permission denied, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "scratch", "out"), []byte("ok"), 0o600); err != nil {
+		return fmt.Errorf("write scratch file: %w", err)
+	}
+
+	for _, path := range []string{"/proc/self/status", "/proc/meminfo", "/sys/devices/system/cpu/online"} {
+		if _, err := os.ReadFile(path); err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+
+	// the parent stands in for the server, whose environment may hold secrets
+	environ := fmt.Sprintf("/proc/%d/environ", os.Getppid())
+	if _, err := os.ReadFile(environ); !errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("read %s: expected permission denied, got %v", environ, err)
+	}
+
+	return nil
+}
+
+func TestApplyRunnerLandlock(t *testing.T) {
+	if status := GetLandlockStatus(); !status.Supported() {
+		t.Skipf("landlock %s", status)
+	}
+
+	dir := t.TempDir()
+	for _, d := range []string{"model", "scratch"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"model/blob", "secret"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(exe, "-test.run=^$")
+	cmd.Env = append(os.Environ(), seccompHelperEnv+"=landlock", "SECLLAMA_TEST_DIR="+dir)
+	if err := SetupLandlock(cmd, SandboxConfig{
+		AllowedReadPaths:  []string{exe, filepath.Join(dir, "model", "blob")},
+		AllowedWritePaths: []string{filepath.Join(dir, "scratch")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("helper failed: %v\n%s", err, out)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "scratch", "out")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLandlockHandledAccess(t *testing.T) {
+	cases := []struct {
+		abi      int
+		refer    bool
+		truncate bool
+	}{
+		{1, false, false},
+		{2, true, false},
+		{3, true, true},
+		{6, true, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("v%d", tt.abi), func(t *testing.T) {
+			access := landlockHandledAccess(tt.abi)
+			if got := access&unix.LANDLOCK_ACCESS_FS_REFER != 0; got != tt.refer {
+				t.Errorf("refer handled = %v, want %v", got, tt.refer)
+			}
+			if got := access&unix.LANDLOCK_ACCESS_FS_TRUNCATE != 0; got != tt.truncate {
+				t.Errorf("truncate handled = %v, want %v", got, tt.truncate)
+			}
+			if access&unix.LANDLOCK_ACCESS_FS_READ_FILE == 0 {
+				t.Error("read_file not handled")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package security
+
+// GetLandlockStatus reports that Landlock is unavailable: it is a Linux security module
+func GetLandlockStatus() LandlockStatus {
+	return LandlockStatus{Reason: "Landlock is only available on Linux"}
+}
+
+// ApplyRunnerLandlock does nothing: Landlock is only available on Linux
+func ApplyRunnerLandlock() error {
+	return nil
+}
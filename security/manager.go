@@ -1,21 +1,45 @@
 package security
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrKeyMissing is returned when the encryption key can't be found but data
+// encrypted with it exists, so a new key would leave that data unreadable
+var ErrKeyMissing = errors.New("encryption key missing")
+
 // Manager handles security operations for secllama
 type Manager struct {
 	keyStore  KeyStore
+	backend   string
 	encryptor *MessageEncryptor
 	mu        sync.RWMutex
+
+	// keyIDPath names the file recording the ID of the active key, so that
+	// processes sharing the keystore notice a rotation before sealing with a
+	// key another process has retired. Empty disables the check.
+	keyIDPath string
+	// keyIDModTime is the modification time of keyIDPath when it was last read
+	keyIDModTime time.Time
 }
 
 var (
 	instance *Manager
 	once     sync.Once
+
+	// created is instance once it exists, for Shutdown to check without
+	// creating it
+	created atomic.Pointer[Manager]
 )
 
 // GetManager returns the singleton security manager
@@ -23,27 +47,67 @@ func GetManager() (*Manager, error) {
 	var err error
 	once.Do(func() {
 		instance, err = newManager()
+		created.Store(instance)
 	})
 	return instance, err
 }
 
+// Shutdown closes the singleton security manager, if GetManager created it,
+// wiping its keys from memory
+func Shutdown() error {
+	if m := created.Load(); m != nil {
+		return m.Close()
+	}
+	return nil
+}
+
 // newManager creates a new security manager
 func newManager() (*Manager, error) {
-	keyStore, err := GetKeyStore()
+	keyStore, backend, err := getKeyStore()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize keystore: %v", err)
 	}
-	
+
+	keyIDPath, err := DefaultKeyIDPath()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		keyStore:  keyStore,
+		backend:   backend,
+		keyIDPath: keyIDPath,
+	}
+
+	if err := m.initializeEncryptionKey(); err != nil {
+		return nil, fmt.Errorf("failed to initialize encryption key: %w", err)
+	}
+
+	return m, nil
+}
+
+// DefaultKeyIDPath returns the file recording the ID of the active encryption
+// key. The ID is not secret.
+func DefaultKeyIDPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".secllama", "key_id"), nil
+}
+
+// newManagerWithKeyStore creates a security manager backed by keyStore
+func newManagerWithKeyStore(keyStore KeyStore) (*Manager, error) {
 	m := &Manager{
 		keyStore: keyStore,
 	}
-	
+
 	// Try to load existing encryption key, or create a new one
-	err = m.initializeEncryptionKey()
+	err := m.initializeEncryptionKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize encryption key: %v", err)
+		return nil, fmt.Errorf("failed to initialize encryption key: %w", err)
 	}
-	
+
 	return m, nil
 }
 
@@ -51,110 +115,538 @@ func newManager() (*Manager, error) {
 func (m *Manager) initializeEncryptionKey() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
-	var key []byte
+
+	var key *Secret
 	var err error
-	
+
 	// Try to retrieve existing key
 	if m.keyStore.KeyExists(EncryptionKeyAccount) {
 		key, err = m.keyStore.RetrieveKey(EncryptionKeyAccount)
 		if err != nil {
-			slog.Warn("failed to retrieve existing key, creating new one", "error", err)
-		} else {
-			slog.Info("loaded existing encryption key from keystore")
+			// replacing the key would orphan everything sealed with it
+			return fmt.Errorf("failed to retrieve existing key: %v", err)
+		}
+		slog.Info("loaded existing encryption key from keystore")
+	} else if stores := encryptedStores(); len(stores) > 0 {
+		reason := "is missing from the keystore"
+		if probe, err := m.keyStore.RetrieveKey(EncryptionKeyAccount); errors.Is(err, ErrKeyExpired) {
+			reason = "expired or was revoked"
+		} else if err == nil {
+			probe.Destroy()
 		}
+
+		return fmt.Errorf("%w: the encryption key %s, but %s hold data encrypted with it; restore the key, or move that data aside to start over with a new key",
+			ErrKeyMissing, reason, strings.Join(stores, ", "))
 	}
-	
+
 	// Create new key if needed
-	if key == nil {
+	generated := key == nil
+	if generated {
 		key, err = GenerateKey()
 		if err != nil {
 			return fmt.Errorf("failed to generate encryption key: %v", err)
 		}
-		
-		err = m.keyStore.StoreKey(EncryptionKeyAccount, key)
+
+		err = m.keyStore.StoreKey(EncryptionKeyAccount, key.Bytes())
 		if err != nil {
+			key.Destroy()
 			return fmt.Errorf("failed to store encryption key: %v", err)
 		}
-		
+
 		slog.Info("generated and stored new encryption key")
 	}
-	
+
 	// Create encryptor
 	m.encryptor, err = NewMessageEncryptor(key)
 	if err != nil {
+		key.Destroy()
+		return fmt.Errorf("failed to create message encryptor: %v", err)
+	}
+
+	m.loadRetiredKeys()
+
+	// a key loaded from the keystore is recorded only if nothing is yet, so a
+	// process starting during a rotation can't record the retired key
+	if _, err := os.Stat(m.keyIDPath); generated || errors.Is(err, os.ErrNotExist) {
+		m.writeKeyID()
+	}
+	return nil
+}
+
+// writeKeyID records the ID of the active key in m.keyIDPath. m.mu must be
+// held for writing.
+func (m *Manager) writeKeyID() {
+	if m.keyIDPath == "" {
+		return
+	}
+
+	if err := writeKeyIDFile(m.keyIDPath, m.encryptor.KeyID()); err != nil {
+		slog.Warn("failed to record the active key id, other processes won't notice a rotation", "path", m.keyIDPath, "error", err)
+		return
+	}
+
+	if fi, err := os.Stat(m.keyIDPath); err == nil {
+		m.keyIDModTime = fi.ModTime()
+	}
+}
+
+func writeKeyIDFile(path, id string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(id + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// refreshKeys reloads the keys if another process rotated them since they
+// were loaded, so nothing is sealed with a key the rotation retired. It only
+// stats the key ID file unless that changed.
+func (m *Manager) refreshKeys() {
+	if m.keyIDPath == "" {
+		return
+	}
+
+	fi, err := os.Stat(m.keyIDPath)
+	if err != nil {
+		return
+	}
+
+	m.mu.RLock()
+	seen := fi.ModTime().Equal(m.keyIDModTime)
+	m.mu.RUnlock()
+	if seen {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.keyIDPath)
+	if err != nil {
+		return
+	}
+	m.keyIDModTime = fi.ModTime()
+
+	if m.encryptor == nil || strings.TrimSpace(string(data)) == m.encryptor.KeyID() {
+		return
+	}
+
+	if err := m.reloadKeys(); err != nil {
+		slog.Warn("failed to reload rotated encryption keys", "error", err)
+		return
+	}
+	slog.Info("reloaded encryption keys rotated by another process", "key_id", m.encryptor.KeyID())
+}
+
+// retiredKeyIDs returns the IDs recorded in the keyring of retired keys
+func (m *Manager) retiredKeyIDs() []string {
+	if !m.keyStore.KeyExists(KeyringAccount) {
+		return nil
+	}
+
+	data, err := m.keyStore.RetrieveKey(KeyringAccount)
+	if err != nil {
+		slog.Warn("failed to read retired key index", "error", err)
+		return nil
+	}
+	defer data.Destroy()
+
+	return strings.Fields(string(data.Bytes()))
+}
+
+// storeRetiredKeyIDs writes the keyring index of retired keys
+func (m *Manager) storeRetiredKeyIDs(ids []string) error {
+	if len(ids) == 0 {
+		return m.keyStore.DeleteKey(KeyringAccount)
+	}
+	return m.keyStore.StoreKey(KeyringAccount, []byte(strings.Join(ids, "\n")))
+}
+
+// loadRetiredKeys registers every retired key from the keyring with the encryptor
+// so data sealed before a rotation remains readable
+func (m *Manager) loadRetiredKeys() {
+	for _, id := range m.retiredKeyIDs() {
+		key, err := m.keyStore.RetrieveKey(retiredKeyAccount(id))
+		if err != nil {
+			slog.Warn("failed to retrieve retired encryption key", "key_id", id, "error", err)
+			continue
+		}
+
+		if err := m.encryptor.AddRetiredKey(key); err != nil {
+			slog.Warn("ignoring invalid retired encryption key", "key_id", id, "error", err)
+		}
+	}
+}
+
+// reloadKeys re-reads the active and retired keys from the keystore. This picks
+// up a rotation performed by another process.
+func (m *Manager) reloadKeys() error {
+	key, err := m.keyStore.RetrieveKey(EncryptionKeyAccount)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve encryption key: %v", err)
+	}
+
+	encryptor, err := NewMessageEncryptor(key)
+	if err != nil {
+		key.Destroy()
 		return fmt.Errorf("failed to create message encryptor: %v", err)
 	}
-	
+
+	m.encryptor.Destroy()
+	m.encryptor = encryptor
+	m.loadRetiredKeys()
 	return nil
 }
 
 // EncryptMessage encrypts a message
 func (m *Manager) EncryptMessage(plaintext string) (string, error) {
+	m.refreshKeys()
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
 	if m.encryptor == nil {
 		return "", fmt.Errorf("encryptor not initialized")
 	}
-	
+
 	return m.encryptor.EncryptString(plaintext)
 }
 
+// EncryptMessageBytes encrypts a message without copying it, so the caller
+// can wipe plaintext afterwards
+func (m *Manager) EncryptMessageBytes(plaintext []byte) (string, error) {
+	m.refreshKeys()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.encryptor == nil {
+		return "", fmt.Errorf("encryptor not initialized")
+	}
+
+	return m.encryptor.EncryptBytes(plaintext)
+}
+
 // DecryptMessage decrypts a message
 func (m *Manager) DecryptMessage(ciphertext string) (string, error) {
+	plaintext, err := m.DecryptMessageBytes(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(plaintext)
+	return string(plaintext), nil
+}
+
+// DecryptMessageBytes decrypts a message into a slice the caller wipes once
+// done with it
+func (m *Manager) DecryptMessageBytes(ciphertext string) ([]byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
+	if m.encryptor == nil {
+		return nil, fmt.Errorf("encryptor not initialized")
+	}
+
+	plaintext, err := m.encryptor.DecryptBytes(ciphertext)
+	if !errors.Is(err, ErrUnknownKey) {
+		return plaintext, err
+	}
+	m.mu.RUnlock()
+
+	// The key may have been rotated by another process since it was loaded
+	m.mu.Lock()
+	if m.encryptor != nil {
+		if reloadErr := m.reloadKeys(); reloadErr != nil {
+			slog.Warn("failed to reload encryption keys", "error", reloadErr)
+		}
+	}
+	m.mu.Unlock()
+
+	m.mu.RLock()
+	if m.encryptor == nil {
+		return nil, fmt.Errorf("encryptor not initialized")
+	}
+	return m.encryptor.DecryptBytes(ciphertext)
+}
+
+// ReEncryptMessage re-encrypts a ciphertext produced by EncryptMessage with the
+// active key. It fails if the ciphertext was sealed with an unknown key.
+func (m *Manager) ReEncryptMessage(ciphertext string) (string, error) {
+	m.refreshKeys()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.encryptor == nil {
 		return "", fmt.Errorf("encryptor not initialized")
 	}
-	
-	return m.encryptor.DecryptString(ciphertext)
+
+	return m.encryptor.ReEncryptString(ciphertext)
 }
 
-// RotateKey generates a new encryption key and re-encrypts data
+// KeyID returns the identifier of the active encryption key
+func (m *Manager) KeyID() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.encryptor == nil {
+		return ""
+	}
+	return m.encryptor.KeyID()
+}
+
+// RetiredKeyIDs returns the identifiers of retired keys still kept for decryption
+func (m *Manager) RetiredKeyIDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.encryptor == nil {
+		return nil
+	}
+
+	ids := m.encryptor.RetiredKeyIDs()
+	slices.Sort(ids)
+	return ids
+}
+
+// RotateKey generates a new encryption key and re-encrypts data. The previous
+// key is moved to the keyring of retired keys first, so nothing becomes
+// unreadable if re-encryption is interrupted; older retired keys are only
+// deleted once every registered store has been re-encrypted under the new key.
+// The key just retired is kept until the next rotation: another process may
+// have sealed data with it before noticing the rotation.
 func (m *Manager) RotateKey() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	
+
+	if m.encryptor == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("encryptor not initialized")
+	}
+
+	// Retire the current key
+	oldID := m.encryptor.KeyID()
+	err := m.keyStore.StoreKey(retiredKeyAccount(oldID), m.encryptor.key.Bytes())
+	if err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to retire current key: %v", err)
+	}
+
+	ids := m.retiredKeyIDs()
+	if !slices.Contains(ids, oldID) {
+		ids = append(ids, oldID)
+	}
+	if err := m.storeRetiredKeyIDs(ids); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to update retired key index: %v", err)
+	}
+
 	// Generate new key
 	newKey, err := GenerateKey()
 	if err != nil {
+		m.mu.Unlock()
 		return fmt.Errorf("failed to generate new key: %v", err)
 	}
-	
+
 	// Store new key
-	err = m.keyStore.StoreKey(EncryptionKeyAccount, newKey)
+	err = m.keyStore.StoreKey(EncryptionKeyAccount, newKey.Bytes())
 	if err != nil {
+		newKey.Destroy()
+		m.mu.Unlock()
 		return fmt.Errorf("failed to store new key: %v", err)
 	}
-	
-	// Create new encryptor
-	m.encryptor, err = NewMessageEncryptor(newKey)
+
+	// Create new encryptor that still knows every retired key
+	encryptor, err := NewMessageEncryptor(newKey)
 	if err != nil {
+		newKey.Destroy()
+		m.mu.Unlock()
 		return fmt.Errorf("failed to create new encryptor: %v", err)
 	}
-	
-	slog.Info("encryption key rotated successfully")
+
+	// the old encryptor's keys move to the new one rather than being copied
+	old := m.encryptor
+	for _, key := range old.keys() {
+		_ = encryptor.AddRetiredKey(key)
+	}
+	old.key, old.retired = nil, nil
+
+	m.encryptor = encryptor
+	m.writeKeyID()
+	m.mu.Unlock()
+
+	slog.Info("encryption key rotated", "old_key_id", oldID, "key_id", encryptor.KeyID())
+
+	if err := m.reEncryptStores(); err != nil {
+		return fmt.Errorf("re-encryption incomplete, retired keys were kept: %w", err)
+	}
+
+	return m.pruneRetiredKeys(oldID)
+}
+
+// PruneRetiredKeys deletes every retired key from the keystore. Data still
+// encrypted with a retired key becomes unreadable afterwards.
+func (m *Manager) PruneRetiredKeys() error {
+	return m.pruneRetiredKeys("")
+}
+
+// pruneRetiredKeys deletes every retired key but keep from the keystore
+func (m *Manager) pruneRetiredKeys(keep string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := m.retiredKeyIDs()
+	if m.encryptor != nil {
+		ids = append(ids, m.encryptor.RetiredKeyIDs()...)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == keep })
+
+	for _, id := range ids {
+		if err := m.keyStore.DeleteKey(retiredKeyAccount(id)); err != nil {
+			return fmt.Errorf("failed to delete retired key %s: %v", id, err)
+		}
+	}
+
+	var kept []string
+	if keep != "" {
+		kept = []string{keep}
+	}
+	if err := m.storeRetiredKeyIDs(kept); err != nil {
+		return fmt.Errorf("failed to clear retired key index: %v", err)
+	}
+
+	if m.encryptor != nil {
+		m.encryptor.clearRetired(keep)
+	}
+
+	slog.Info("retired encryption keys deleted", "count", len(ids))
 	return nil
 }
 
-// GetSandboxConfig returns the default sandbox configuration
-func (m *Manager) GetSandboxConfig(port int) SandboxConfig {
-	return SandboxConfig{
-		AllowLocalhost:   true,
-		AllowedPorts:     []int{port},
-		WorkingDirectory: "/tmp/secllama",
-		AllowedReadPaths: []string{
-			"/tmp/secllama",
-			"/var/tmp/secllama",
-		},
-		AllowedWritePaths: []string{
-			"/tmp/secllama",
-			"/var/tmp/secllama",
-		},
+// ReEncrypter re-encrypts a store of data previously encrypted through the
+// Manager so that it is sealed with the active key
+type ReEncrypter func(m *Manager) error
+
+var (
+	reEncryptersMu sync.Mutex
+	reEncrypters   = make(map[string]ReEncrypter)
+)
+
+// RegisterReEncrypter registers a store that RotateKey must re-encrypt before
+// retired keys can be deleted
+func RegisterReEncrypter(name string, fn ReEncrypter) {
+	reEncryptersMu.Lock()
+	defer reEncryptersMu.Unlock()
+
+	if _, ok := reEncrypters[name]; ok {
+		panic("re-encrypter already registered: " + name)
 	}
+	reEncrypters[name] = fn
+}
+
+// reEncryptStores runs every registered re-encrypter in name order
+func (m *Manager) reEncryptStores() error {
+	reEncryptersMu.Lock()
+	names := make([]string, 0, len(reEncrypters))
+	for name := range reEncrypters {
+		names = append(names, name)
+	}
+	reEncryptersMu.Unlock()
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range names {
+		reEncryptersMu.Lock()
+		fn := reEncrypters[name]
+		reEncryptersMu.Unlock()
+
+		if err := fn(m); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		slog.Info("re-encrypted store", "store", name)
+	}
+
+	return errors.Join(errs...)
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]func() bool)
+)
+
+// RegisterEncryptedStore registers a store of data encrypted through the
+// Manager. hasData reports whether it holds any; while one does, a missing
+// encryption key is an error rather than replaced by a new one.
+func RegisterEncryptedStore(name string, hasData func() bool) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if _, ok := stores[name]; ok {
+		panic("encrypted store already registered: " + name)
+	}
+	stores[name] = hasData
+}
+
+// encryptedStores returns the names of the registered stores holding data,
+// sorted
+func encryptedStores() []string {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	var names []string
+	for name, hasData := range stores {
+		if hasData() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// KeyStoreBackend returns the name of the KeyStore backend keys are kept in,
+// as listed in SECLLAMA_KEYSTORE
+func (m *Manager) KeyStoreBackend() string {
+	return m.backend
+}
+
+// GetSandboxConfig returns the default sandbox configuration for a runner
+// serving its API on socketPath
+func (m *Manager) GetSandboxConfig(socketPath string, readPaths ...string) SandboxConfig {
+	return DefaultSandboxConfig(socketPath, readPaths...)
+}
+
+// Close wipes the encryption keys from memory, along with the wrapping key of
+// a file keystore. The Manager can't encrypt or decrypt afterwards.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.encryptor != nil {
+		m.encryptor.Destroy()
+		m.encryptor = nil
+	}
+
+	if c, ok := m.keyStore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 // IsEncryptionEnabled returns whether encryption is enabled
@@ -163,4 +655,3 @@ func (m *Manager) IsEncryptionEnabled() bool {
 	defer m.mu.RUnlock()
 	return m.encryptor != nil
 }
-
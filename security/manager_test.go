@@ -0,0 +1,333 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func newMemKeyStore() *memKeyStore {
+	return &memKeyStore{keys: make(map[string][]byte)}
+}
+
+func (s *memKeyStore) StoreKey(account string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[account] = slices.Clone(key)
+	return nil
+}
+
+func (s *memKeyStore) RetrieveKey(account string) (*Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[account]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", account)
+	}
+	return NewSecretFrom(slices.Clone(key))
+}
+
+func (s *memKeyStore) DeleteKey(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, account)
+	return nil
+}
+
+func (s *memKeyStore) KeyExists(account string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[account]
+	return ok
+}
+
+func (s *memKeyStore) accounts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.keys))
+}
+
+func withReEncrypters(t *testing.T, fns map[string]ReEncrypter) {
+	t.Helper()
+	reEncryptersMu.Lock()
+	saved := reEncrypters
+	reEncrypters = fns
+	reEncryptersMu.Unlock()
+
+	t.Cleanup(func() {
+		reEncryptersMu.Lock()
+		reEncrypters = saved
+		reEncryptersMu.Unlock()
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	ks := newMemKeyStore()
+	m, err := newManagerWithKeyStore(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.EncryptMessage("history line")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withReEncrypters(t, map[string]ReEncrypter{
+		"test": func(m *Manager) error {
+			stored, err = m.ReEncryptMessage(stored)
+			return err
+		},
+	})
+
+	oldID, oldKey := m.KeyID(), m.encryptor.key
+	if err := m.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.KeyID() == oldID {
+		t.Fatal("expected key id to change")
+	}
+
+	plaintext, err := m.DecryptMessage(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "history line" {
+		t.Fatalf("expected history line, got %q", plaintext)
+	}
+
+	// the key just retired is kept for processes that haven't noticed yet
+	if ids := m.RetiredKeyIDs(); !slices.Equal(ids, []string{oldID}) {
+		t.Fatalf("expected retired key %s, got %v", oldID, ids)
+	}
+
+	secondID := m.KeyID()
+	if err := m.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if oldKey.Len() != 0 {
+		t.Fatal("expected the pruned key to be wiped from memory")
+	}
+
+	if ids := m.RetiredKeyIDs(); !slices.Equal(ids, []string{secondID}) {
+		t.Fatalf("expected only retired key %s, got %v", secondID, ids)
+	}
+
+	want := []string{EncryptionKeyAccount, KeyringAccount, retiredKeyAccount(secondID)}
+	slices.Sort(want)
+	if accounts := ks.accounts(); !slices.Equal(accounts, want) {
+		t.Fatalf("expected the active and last retired key in the keystore, got %v", accounts)
+	}
+}
+
+func TestSealAfterRotationElsewhere(t *testing.T) {
+	ks := newMemKeyStore()
+	keyIDPath := filepath.Join(t.TempDir(), "key_id")
+
+	open := func() *Manager {
+		m := &Manager{keyStore: ks, keyIDPath: keyIDPath}
+		if err := m.initializeEncryptionKey(); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	running, rotating := open(), open()
+	withReEncrypters(t, map[string]ReEncrypter{})
+
+	if err := rotating.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the running process seals with the new key without being restarted
+	stored, err := running.EncryptMessage("audit record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := CiphertextKeyID(ciphertext); err != nil || id != rotating.KeyID() {
+		t.Fatalf("sealed with key %s (%v), expected %s", id, err, rotating.KeyID())
+	}
+	if running.KeyID() != rotating.KeyID() {
+		t.Fatalf("expected key %s, got %s", rotating.KeyID(), running.KeyID())
+	}
+}
+
+func TestRotateKeyKeepsRetiredOnFailure(t *testing.T) {
+	ks := newMemKeyStore()
+	m, err := newManagerWithKeyStore(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.EncryptMessage("unrotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withReEncrypters(t, map[string]ReEncrypter{
+		"broken": func(*Manager) error { return fmt.Errorf("disk full") },
+	})
+
+	oldID := m.KeyID()
+	if err := m.RotateKey(); err == nil {
+		t.Fatal("expected rotation to report the failed store")
+	}
+
+	if ids := m.RetiredKeyIDs(); !slices.Equal(ids, []string{oldID}) {
+		t.Fatalf("expected retired key %s, got %v", oldID, ids)
+	}
+
+	// a fresh manager loads the retired key from the keyring
+	m2, err := newManagerWithKeyStore(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := m2.DecryptMessage(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "unrotated" {
+		t.Fatalf("expected unrotated, got %q", plaintext)
+	}
+}
+
+func TestDecryptReloadsRotatedKey(t *testing.T) {
+	ks := newMemKeyStore()
+	stale, err := newManagerWithKeyStore(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := newManagerWithKeyStore(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withReEncrypters(t, map[string]ReEncrypter{})
+	if err := m.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := m.EncryptMessage("new key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := stale.DecryptMessage(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "new key" {
+		t.Fatalf("expected new key, got %q", plaintext)
+	}
+}
+
+func TestManagerClose(t *testing.T) {
+	m, err := newManagerWithKeyStore(newMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.EncryptMessageBytes([]byte("closing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := m.DecryptMessageBytes(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "closing" {
+		t.Fatalf("expected closing, got %q", plaintext)
+	}
+
+	key := m.encryptor.key
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if key.Len() != 0 {
+		t.Fatal("expected the key to be wiped from memory")
+	}
+
+	if _, err := m.DecryptMessageBytes(stored); err == nil {
+		t.Fatal("expected a closed manager to refuse to decrypt")
+	}
+}
+
+// expiredKeyStore is a memKeyStore whose encryption key has expired
+type expiredKeyStore struct {
+	*memKeyStore
+}
+
+func (s expiredKeyStore) RetrieveKey(account string) (*Secret, error) {
+	if account == EncryptionKeyAccount {
+		return nil, fmt.Errorf("failed to retrieve key: %w", ErrKeyExpired)
+	}
+	return s.memKeyStore.RetrieveKey(account)
+}
+
+func TestMissingKeyWithEncryptedData(t *testing.T) {
+	storesMu.Lock()
+	saved := stores
+	stores = map[string]func() bool{
+		"history": func() bool { return true },
+		"empty":   func() bool { return false },
+	}
+	storesMu.Unlock()
+	t.Cleanup(func() {
+		storesMu.Lock()
+		stores = saved
+		storesMu.Unlock()
+	})
+
+	ks := newMemKeyStore()
+	_, err := newManagerWithKeyStore(ks)
+	if !errors.Is(err, ErrKeyMissing) || !strings.Contains(err.Error(), "is missing") || !strings.Contains(err.Error(), "history hold data") {
+		t.Fatalf("expected ErrKeyMissing, got %v", err)
+	}
+	if len(ks.accounts()) != 0 {
+		t.Errorf("a key was stored: %v", ks.accounts())
+	}
+
+	_, err = newManagerWithKeyStore(expiredKeyStore{ks})
+	if !errors.Is(err, ErrKeyMissing) || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected ErrKeyMissing for an expired key, got %v", err)
+	}
+
+	// a key that exists but can't be read isn't replaced either
+	key := mustKey(t)
+	if err := ks.StoreKey(EncryptionKeyAccount, key.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newManagerWithKeyStore(expiredKeyStore{ks}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, _ := ks.RetrieveKey(EncryptionKeyAccount); !bytes.Equal(got.Bytes(), key.Bytes()) {
+		t.Error("the key was replaced")
+	}
+
+	stores = map[string]func() bool{}
+	if _, err := newManagerWithKeyStore(newMemKeyStore()); err != nil {
+		t.Fatalf("without encrypted data a new key is generated: %v", err)
+	}
+}
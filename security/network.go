@@ -0,0 +1,85 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// ErrNetworkIsolated is returned for outbound connections refused because of
+// strict network isolation
+var ErrNetworkIsolated = errors.New("outbound network access is disabled (SECLLAMA_STRICT_NETWORK_ISOLATION)")
+
+// isLoopbackHost reports whether host, a hostname or IP address without a
+// port, can only refer to this machine
+func isLoopbackHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// CheckOutbound returns an error wrapping ErrNetworkIsolated if strict network
+// isolation is enabled and host, with or without a port, is not this machine.
+// Code that reaches out to registries or other services calls it before
+// connecting, so it fails with a clear error rather than a dial error.
+func CheckOutbound(host string) error {
+	if !envconfig.StrictNetworkIsolation() {
+		return nil
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if isLoopbackHost(host) {
+		return nil
+	}
+
+	return fmt.Errorf("connection to %q refused: %w", host, ErrNetworkIsolated)
+}
+
+var installNetworkGuard sync.Once
+
+// InstallNetworkGuard restricts outbound connections of the whole process to
+// loopback addresses. http.DefaultTransport, and so http.DefaultClient, only
+// dials localhost and ignores proxy settings, and net.DefaultResolver refuses
+// every DNS query, so any dependency that resolves a hostname fails even with
+// its own dialer. Names in the hosts file, including localhost, still resolve.
+//
+// It is a backstop for CheckOutbound rather than a sandbox: code that dials an
+// IP address with its own dialer is not covered.
+func InstallNetworkGuard() {
+	installNetworkGuard.Do(func() {
+		dialer := &LocalhostOnlyDialer{
+			Dialer: &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			},
+		}
+
+		if t, ok := http.DefaultTransport.(*http.Transport); ok {
+			t.Proxy = nil
+			t.DialContext = dialer.DialContext
+			t.DialTLSContext = nil
+		}
+
+		net.DefaultResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(context.Context, string, string) (net.Conn, error) {
+				return nil, fmt.Errorf("dns lookup refused: %w", ErrNetworkIsolated)
+			},
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package security
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCheckOutbound(t *testing.T) {
+	cases := []struct {
+		host    string
+		allowed bool
+	}{
+		{"localhost", true},
+		{"localhost:11434", true},
+		{"LOCALHOST.", true},
+		{"registry.localhost", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3:80", true},
+		{"[::1]:443", true},
+		{"::ffff:127.0.0.1", true},
+		{"registry.ollama.ai", false},
+		{"ollama.com:443", false},
+		{"10.0.0.1", false},
+		{"[2001:db8::1]:443", false},
+		{"localhost.example.com", false},
+		{"", false},
+	}
+
+	t.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "true")
+	for _, tt := range cases {
+		err := CheckOutbound(tt.host)
+		if tt.allowed && err != nil {
+			t.Errorf("%q: unexpected error %v", tt.host, err)
+		} else if !tt.allowed && !errors.Is(err, ErrNetworkIsolated) {
+			t.Errorf("%q: expected ErrNetworkIsolated, got %v", tt.host, err)
+		}
+	}
+
+	t.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "false")
+	if err := CheckOutbound("ollama.com:443"); err != nil {
+		t.Errorf("expected no error without isolation, got %v", err)
+	}
+}
+
+func TestLocalhostOnlyDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := &LocalhostOnlyDialer{Dialer: &net.Dialer{Timeout: time.Second}}
+
+	conn, err := d.DialContext(t.Context(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if _, err := d.DialContext(t.Context(), "tcp", "192.0.2.1:80"); err == nil {
+		t.Fatal("expected connection to a non-loopback address to be blocked")
+	}
+}
@@ -0,0 +1,15 @@
+package security
+
+import "fmt"
+
+// PeerCred identifies the process on the other end of a Unix socket, as
+// reported by the kernel when the connection was made
+type PeerCred struct {
+	UID uint32
+	GID uint32
+	PID int32
+}
+
+func (c PeerCred) String() string {
+	return fmt.Sprintf("uid=%d gid=%d pid=%d", c.UID, c.GID, c.PID)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package security
+
+import (
+	"errors"
+	"net"
+)
+
+// PeerCredentials is not supported: SO_PEERCRED is Linux only
+func PeerCredentials(conn *net.UnixConn) (*PeerCred, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,437 @@
+// Package pii finds personal data and secrets in text and swaps them for
+// placeholders, so prompts can be sent to a model without them.
+//
+// A [Session] covers one request: each distinct value it redacts gets a
+// placeholder such as [EMAIL_1] that stays the same for every occurrence, so
+// the model can still refer to it, and [Session.Restore] puts the originals
+// back into what the model writes. Output streamed in chunks goes through a
+// [Restorer], which holds back the start of a placeholder split between
+// chunks until the rest of it arrives.
+//
+// The built-in patterns cover email addresses, phone numbers, credit card
+// numbers, IBANs, IP addresses and common API key formats. Card numbers and
+// IBANs must pass their checksums. A config file can disable built-in
+// patterns and add others.
+package pii
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Built-in pattern names
+const (
+	Email      = "email"
+	Phone      = "phone"
+	CreditCard = "credit_card"
+	IBAN       = "iban"
+	IP         = "ip"
+	APIKey     = "api_key"
+)
+
+// Pattern finds one kind of data to redact
+type Pattern struct {
+	Name   string `json:"name"`
+	Regexp string `json:"regexp"`
+
+	re *regexp.Regexp
+	// valid rejects matches that fit the expression but not the format, such
+	// as card numbers with a bad checksum
+	valid func(string) bool
+	// bounded rejects matches that run into letters or digits on either side,
+	// or into more digits past a separator, such as part of a longer number
+	bounded bool
+}
+
+// builtin returns the built-in patterns. Earlier patterns win when matches
+// of the same length start at the same place.
+func builtin() []Pattern {
+	return []Pattern{
+		{
+			Name:    APIKey,
+			Regexp:  `(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20,})`,
+			bounded: true,
+		},
+		{
+			Name:    Email,
+			Regexp:  `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+			bounded: true,
+		},
+		{
+			Name:    IBAN,
+			Regexp:  `[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]){11,30}`,
+			valid:   validIBAN,
+			bounded: true,
+		},
+		{
+			Name:    CreditCard,
+			Regexp:  `[0-9](?:[ -]?[0-9]){12,18}`,
+			valid:   luhn,
+			bounded: true,
+		},
+		{
+			Name:    IP,
+			Regexp:  `(?:[0-9]{1,3}\.){3}[0-9]{1,3}|(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`,
+			valid:   validIP,
+			bounded: true,
+		},
+		{
+			Name:    Phone,
+			Regexp:  `(?:\+[0-9]{1,3}[ .-]?)?(?:\([0-9]{2,4}\)[ .-]?|[0-9]{2,4}[ .-])[0-9]{3,4}[ .-]?[0-9]{3,4}`,
+			valid:   validPhone,
+			bounded: true,
+		},
+	}
+}
+
+// Config selects the patterns a Redactor uses: the built-in ones, less those
+// named in Disable, followed by Patterns
+type Config struct {
+	Disable  []string  `json:"disable"`
+	Patterns []Pattern `json:"patterns"`
+}
+
+// Redactor finds data to redact with a set of patterns
+type Redactor struct {
+	patterns []Pattern
+}
+
+// New returns a Redactor using the patterns cfg selects
+func New(cfg Config) (*Redactor, error) {
+	var r Redactor
+	for _, p := range builtin() {
+		if !slices.Contains(cfg.Disable, p.Name) {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+
+	for _, p := range cfg.Patterns {
+		if p.Name == "" || p.Regexp == "" {
+			return nil, errors.New("patterns need a name and a regexp")
+		}
+
+		p.valid, p.bounded = nil, false
+		r.patterns = append(r.patterns, p)
+	}
+
+	for i := range r.patterns {
+		re, err := regexp.Compile(r.patterns[i].Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", r.patterns[i].Name, err)
+		}
+		r.patterns[i].re = re
+	}
+
+	return &r, nil
+}
+
+// Load returns a Redactor configured by the JSON file at path, or using the
+// built-in patterns if there is no such file
+func Load(path string) (*Redactor, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(cfg)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	r, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return r, nil
+}
+
+type match struct {
+	start, end int
+	pattern    int
+}
+
+// find returns the matches to redact in s, in order and without overlaps.
+// Where matches overlap, the one starting first wins, then the longest.
+func (r *Redactor) find(s string) []match {
+	var matches []match
+	for i, p := range r.patterns {
+		for _, loc := range p.re.FindAllStringIndex(s, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+
+			if p.bounded && !isBounded(s, loc[0], loc[1]) {
+				continue
+			}
+
+			if p.valid != nil && !p.valid(s[loc[0]:loc[1]]) {
+				continue
+			}
+
+			matches = append(matches, match{loc[0], loc[1], i})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+		return (b.end - b.start) - (a.end - a.start)
+	})
+
+	var kept []match
+	for _, m := range matches {
+		if len(kept) > 0 && m.start < kept[len(kept)-1].end {
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	return kept
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isBounded reports whether s[start:end] is neither preceded nor followed by
+// a letter or digit, or by a digit across one separator
+func isBounded(s string, start, end int) bool {
+	before, after := s[:start], s[end:]
+
+	r, _ := utf8.DecodeLastRuneInString(before)
+	if before != "" && isWordRune(r) {
+		return false
+	} else if n := len(before); n >= 2 && isSeparator(before[n-1]) && isDigit(before[n-2]) {
+		return false
+	}
+
+	r, _ = utf8.DecodeRuneInString(after)
+	if after != "" && isWordRune(r) {
+		return false
+	} else if len(after) >= 2 && isSeparator(after[0]) && isDigit(after[1]) {
+		return false
+	}
+
+	return true
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '.' || c == '-'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Session redacts the text of one request, giving each distinct value the
+// same placeholder wherever it appears
+type Session struct {
+	r *Redactor
+
+	placeholders map[string]string
+	originals    map[string]string
+	// kinds counts the distinct values redacted per pattern, numbering their
+	// placeholders
+	kinds map[string]int
+	// stats counts every value redacted per pattern
+	stats map[string]int
+
+	replacer *strings.Replacer
+}
+
+// NewSession starts a session for one request
+func (r *Redactor) NewSession() *Session {
+	return &Session{
+		r:            r,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		kinds:        make(map[string]int),
+		stats:        make(map[string]int),
+	}
+}
+
+// Redact returns text with the data the session's patterns find replaced by
+// placeholders
+func (s *Session) Redact(text string) string {
+	matches := s.r.find(text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	var last int
+	for _, m := range matches {
+		name := s.r.patterns[m.pattern].Name
+		original := text[m.start:m.end]
+
+		placeholder, ok := s.placeholders[original]
+		if !ok {
+			s.kinds[name]++
+			placeholder = fmt.Sprintf("[%s_%d]", placeholderName(name), s.kinds[name])
+			s.placeholders[original] = placeholder
+			s.originals[placeholder] = original
+			s.replacer = nil
+		}
+		s.stats[name]++
+
+		sb.WriteString(text[last:m.start])
+		sb.WriteString(placeholder)
+		last = m.end
+	}
+	sb.WriteString(text[last:])
+
+	return sb.String()
+}
+
+// placeholderName upper cases a pattern name and replaces anything other than
+// letters and digits with underscores
+func placeholderName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && isWordRune(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
+
+// Restore returns text with the placeholders of the session replaced by the
+// values they stand for
+func (s *Session) Restore(text string) string {
+	if len(s.originals) == 0 {
+		return text
+	}
+
+	if s.replacer == nil {
+		pairs := make([]string, 0, 2*len(s.originals))
+		for placeholder, original := range s.originals {
+			pairs = append(pairs, placeholder, original)
+		}
+		s.replacer = strings.NewReplacer(pairs...)
+	}
+
+	return s.replacer.Replace(text)
+}
+
+// Stats returns how many values were redacted per pattern, or nil if none were
+func (s *Session) Stats() map[string]int {
+	if len(s.stats) == 0 {
+		return nil
+	}
+	return maps.Clone(s.stats)
+}
+
+// isPlaceholderPrefix reports whether text is the start, but not the whole, of
+// one of the session's placeholders
+func (s *Session) isPlaceholderPrefix(text string) bool {
+	for placeholder := range s.originals {
+		if len(text) < len(placeholder) && strings.HasPrefix(placeholder, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restorer restores the placeholders of a session in text that arrives in
+// chunks
+type Restorer struct {
+	s       *Session
+	pending string
+}
+
+// NewRestorer returns a Restorer for one stream of text
+func (s *Session) NewRestorer() *Restorer {
+	return &Restorer{s: s}
+}
+
+// Write restores the placeholders in chunk, appended to what was held back
+// from earlier chunks. A trailing part that could be the start of a
+// placeholder is held back until the next Write or Flush.
+func (r *Restorer) Write(chunk string) string {
+	text := r.pending + chunk
+	r.pending = ""
+
+	if i := strings.LastIndexByte(text, '['); i >= 0 && r.s.isPlaceholderPrefix(text[i:]) {
+		text, r.pending = text[:i], text[i:]
+	}
+
+	return r.s.Restore(text)
+}
+
+// Flush returns whatever is held back
+func (r *Restorer) Flush() string {
+	text := r.pending
+	r.pending = ""
+	return text
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum of card numbers
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		if !isDigit(s[i]) {
+			continue
+		}
+
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// validIBAN reports whether s passes the mod-97 check of IBANs
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+
+	var digits strings.Builder
+	for _, c := range s[4:] + s[:4] {
+		if c >= 'A' && c <= 'Z' {
+			fmt.Fprintf(&digits, "%d", c-'A'+10)
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func validIP(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && !addr.IsUnspecified()
+}
+
+// validPhone rejects matches with too few or too many digits to be a phone
+// number
+func validPhone(s string) bool {
+	var n int
+	for i := range len(s) {
+		if isDigit(s[i]) {
+			n++
+		}
+	}
+	return n >= 9 && n <= 15
+}
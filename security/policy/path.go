@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A step of a JSON path
+type step struct {
+	kind  stepKind
+	key   string
+	index int
+}
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	// stepAll selects every member of an object or array
+	stepAll
+	// stepDescend applies the rest of the path to a value and everything
+	// below it
+	stepDescend
+)
+
+// parsePath parses the subset of JSON path used by tool call rules: "$"
+// followed by ".key", "['key']", "[0]", ".*", "[*]" and "..", as in
+// "$.arguments.command" or "$..url". The leading "$." may be left out.
+func parsePath(s string) ([]step, error) {
+	p := s
+	switch {
+	case strings.HasPrefix(p, "$"):
+		p = p[1:]
+	case !strings.HasPrefix(p, ".") && !strings.HasPrefix(p, "["):
+		p = "." + p
+	}
+
+	var steps []step
+	for p != "" {
+		switch {
+		case strings.HasPrefix(p, ".."):
+			steps = append(steps, step{kind: stepDescend})
+			p = p[1:]
+			if strings.HasPrefix(p, ".[") {
+				p = p[1:]
+			}
+		case strings.HasPrefix(p, "."):
+			p = p[1:]
+			n := strings.IndexAny(p, ".[")
+			if n < 0 {
+				n = len(p)
+			}
+
+			switch name := p[:n]; name {
+			case "":
+				return nil, fmt.Errorf("invalid path %q: missing name", s)
+			case "*":
+				steps = append(steps, step{kind: stepAll})
+			default:
+				steps = append(steps, step{kind: stepKey, key: name})
+			}
+			p = p[n:]
+		case strings.HasPrefix(p, "["):
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", s)
+			}
+
+			inner := p[1:end]
+			switch {
+			case inner == "*":
+				steps = append(steps, step{kind: stepAll})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, step{kind: stepKey, key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: bad index %q", s, inner)
+				}
+				steps = append(steps, step{kind: stepIndex, index: i})
+			}
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q", s)
+		}
+	}
+
+	if len(steps) > 0 && steps[len(steps)-1].kind == stepDescend {
+		return nil, fmt.Errorf("invalid path %q: ends with ..", s)
+	}
+
+	return steps, nil
+}
+
+// apply calls fn on every value in v that path selects and replaces the value
+// with what fn returns. Objects and arrays are changed in place; the result is
+// v, or what replaced it if the path is empty.
+func apply(v any, path []step, fn func(any) any) any {
+	if len(path) == 0 {
+		return fn(v)
+	}
+
+	st, rest := path[0], path[1:]
+	switch st.kind {
+	case stepKey:
+		if m, ok := v.(map[string]any); ok {
+			if child, ok := m[st.key]; ok {
+				m[st.key] = apply(child, rest, fn)
+			}
+		}
+	case stepIndex:
+		if a, ok := v.([]any); ok {
+			i := st.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				a[i] = apply(a[i], rest, fn)
+			}
+		}
+	case stepAll:
+		switch v := v.(type) {
+		case map[string]any:
+			for k := range v {
+				v[k] = apply(v[k], rest, fn)
+			}
+		case []any:
+			for i := range v {
+				v[i] = apply(v[i], rest, fn)
+			}
+		}
+	case stepDescend:
+		v = apply(v, rest, fn)
+		switch v := v.(type) {
+		case map[string]any:
+			for k := range v {
+				v[k] = apply(v[k], path, fn)
+			}
+		case []any:
+			for i := range v {
+				v[i] = apply(v[i], path, fn)
+			}
+		}
+	}
+
+	return v
+}
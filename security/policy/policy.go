@@ -0,0 +1,372 @@
+// Package policy checks model output against a set of rules before it reaches
+// clients.
+//
+// Rules are read from a JSON file. Each rule matches text with a regular
+// expression or a list of literals, or selects values of tool calls with a
+// JSON path, and names an action: "mask" replaces what it matched, "abort"
+// ends the response before it, and "flag" lets it through but counts it.
+//
+// Text streamed in chunks goes through a [Stream], which holds back the last
+// [Config.Lookahead] bytes of what it was given so a match split between
+// chunks is still caught. Matches longer than that can slip through in parts.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule actions
+const (
+	Mask  = "mask"
+	Abort = "abort"
+	Flag  = "flag"
+)
+
+// DefaultLookahead is how many bytes of streamed text are held back by default
+const DefaultLookahead = 128
+
+// DefaultMask replaces masked text unless a rule sets its own
+const DefaultMask = "[REDACTED]"
+
+// Config is the content of a rules file
+type Config struct {
+	Lookahead int    `json:"lookahead,omitempty"`
+	Rules     []Rule `json:"rules"`
+}
+
+// Rule matches text or tool call values and says what to do about them
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Regexp and Literals match text; a rule with both matches either
+	Regexp     string   `json:"regexp,omitempty"`
+	Literals   []string `json:"literals,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+
+	// ToolCall is a JSON path into tool calls, such as "$.arguments.command",
+	// evaluated against {"name": ..., "arguments": {...}}. A rule with a path
+	// only applies to tool calls; without Regexp or Literals it matches
+	// whatever the path selects.
+	ToolCall string `json:"tool_call,omitempty"`
+
+	// Mask replaces what a mask rule matched; default DefaultMask
+	Mask string `json:"mask,omitempty"`
+}
+
+type rule struct {
+	Rule
+	re   *regexp.Regexp
+	path []step
+}
+
+// Engine applies the rules of a rules file
+type Engine struct {
+	rules     []rule
+	lookahead int
+}
+
+// New returns an Engine for the rules of cfg
+func New(cfg Config) (*Engine, error) {
+	e := Engine{lookahead: cfg.Lookahead}
+	if e.lookahead <= 0 {
+		e.lookahead = DefaultLookahead
+	}
+
+	for _, r := range cfg.Rules {
+		if r.Name == "" {
+			return nil, errors.New("rules need a name")
+		}
+
+		switch r.Action {
+		case Mask, Abort, Flag:
+		default:
+			return nil, fmt.Errorf("rule %q: unknown action %q", r.Name, r.Action)
+		}
+
+		if r.Mask == "" {
+			r.Mask = DefaultMask
+		}
+
+		compiled := rule{Rule: r}
+
+		var alternatives []string
+		if r.Regexp != "" {
+			alternatives = append(alternatives, "(?:"+r.Regexp+")")
+		}
+		for _, l := range r.Literals {
+			if l != "" {
+				alternatives = append(alternatives, regexp.QuoteMeta(l))
+			}
+		}
+
+		if len(alternatives) > 0 {
+			expr := strings.Join(alternatives, "|")
+			if r.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			compiled.re = re
+		}
+
+		if r.ToolCall != "" {
+			path, err := parsePath(r.ToolCall)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			compiled.path = path
+		} else if compiled.re == nil {
+			return nil, fmt.Errorf("rule %q: needs a regexp, literals or a tool call path", r.Name)
+		}
+
+		e.rules = append(e.rules, compiled)
+	}
+
+	return &e, nil
+}
+
+// Load returns an Engine for the rules file at path, or nil if there is none
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	e, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return e, nil
+}
+
+// Response applies the rules to one response, which may have several streams
+// of text and tool calls. It is not safe for concurrent use.
+type Response struct {
+	e       *Engine
+	matches map[string]int
+	aborted string
+}
+
+// NewResponse starts checking a response
+func (e *Engine) NewResponse() *Response {
+	return &Response{e: e, matches: make(map[string]int)}
+}
+
+// Aborted returns the name of the rule that aborted the response, or "" if
+// none did
+func (r *Response) Aborted() string {
+	return r.aborted
+}
+
+// Matches returns how many times each rule matched, or nil if none did
+func (r *Response) Matches() map[string]int {
+	if len(r.matches) == 0 {
+		return nil
+	}
+	return maps.Clone(r.matches)
+}
+
+type match struct {
+	start, end int
+	rule       *rule
+}
+
+// find returns the matches of text rules in s, in order and without overlaps
+func (e *Engine) find(s string) []match {
+	var matches []match
+	for i := range e.rules {
+		r := &e.rules[i]
+		if r.path != nil {
+			continue
+		}
+
+		for _, loc := range r.re.FindAllStringIndex(s, -1) {
+			if loc[0] < loc[1] {
+				matches = append(matches, match{loc[0], loc[1], r})
+			}
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+		return (b.end - b.start) - (a.end - a.start)
+	})
+
+	var kept []match
+	for _, m := range matches {
+		if len(kept) > 0 && m.start < kept[len(kept)-1].end {
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	return kept
+}
+
+// Stream checks one stream of text, such as the content of a streamed chat
+// response
+type Stream struct {
+	r   *Response
+	buf string
+	// checked is how far into buf matches were already acted on
+	checked int
+}
+
+// NewStream starts a stream of text in the response
+func (r *Response) NewStream() *Stream {
+	return &Stream{r: r}
+}
+
+// Write adds chunk to the stream and returns the text that is safe to pass
+// on, masked. The last bytes of the stream are held back until more text
+// arrives or Flush is called. Once the response is aborted, Write returns
+// nothing.
+func (s *Stream) Write(chunk string) string {
+	s.buf += chunk
+	return s.check(false)
+}
+
+// Flush returns whatever is held back, once checked
+func (s *Stream) Flush() string {
+	return s.check(true)
+}
+
+func (s *Stream) check(final bool) string {
+	if s.r.aborted != "" {
+		s.buf = ""
+		return ""
+	}
+
+	var sb strings.Builder
+	var pos int
+	// hold is where text has to be held back from, for a match that may
+	// still grow
+	hold := len(s.buf)
+	for _, m := range s.r.e.find(s.buf) {
+		if m.start < s.checked {
+			continue
+		}
+
+		if m.end == len(s.buf) && !final {
+			hold = m.start
+			break
+		}
+
+		s.r.matches[m.rule.Name]++
+		switch m.rule.Action {
+		case Mask:
+			sb.WriteString(s.buf[pos:m.start])
+			sb.WriteString(m.rule.Mask)
+			pos = m.end
+		case Abort:
+			sb.WriteString(s.buf[pos:m.start])
+			s.r.aborted = m.rule.Name
+			s.buf = ""
+			return sb.String()
+		}
+		s.checked = m.end
+	}
+
+	end := len(s.buf)
+	if !final {
+		end = min(hold, len(s.buf)-s.r.e.lookahead)
+		for end > pos && end < len(s.buf) && !utf8.RuneStart(s.buf[end]) {
+			end--
+		}
+	}
+	end = max(end, pos)
+
+	sb.WriteString(s.buf[pos:end])
+	s.buf = s.buf[end:]
+	s.checked = max(s.checked-end, 0)
+	return sb.String()
+}
+
+// ToolCall applies the tool call rules to a call of function name with
+// arguments, masking arguments in place. It returns the name, masked if a
+// rule selected it. A rule masking the arguments as a whole removes them.
+func (r *Response) ToolCall(name string, arguments map[string]any) string {
+	if r.aborted != "" {
+		return name
+	}
+
+	call := map[string]any{"name": name, "arguments": arguments}
+	for i := range r.e.rules {
+		rule := &r.e.rules[i]
+		if rule.path == nil {
+			continue
+		}
+
+		apply(call, rule.path, func(v any) any {
+			if r.aborted != "" {
+				return v
+			}
+
+			if rule.re == nil {
+				return r.act(rule, v, func() any { return rule.Mask })
+			}
+
+			s, ok := scalar(v)
+			if !ok || !rule.re.MatchString(s) {
+				return v
+			}
+
+			return r.act(rule, v, func() any { return rule.re.ReplaceAllLiteralString(s, rule.Mask) })
+		})
+	}
+
+	if _, ok := call["arguments"].(map[string]any); !ok {
+		clear(arguments)
+	}
+
+	if s, ok := call["name"].(string); ok {
+		return s
+	}
+	return name
+}
+
+// act records a match of rule on v and returns what v becomes
+func (r *Response) act(rule *rule, v any, masked func() any) any {
+	r.matches[rule.Name]++
+	switch rule.Action {
+	case Mask:
+		return masked()
+	case Abort:
+		r.aborted = rule.Name
+	}
+	return v
+}
+
+// scalar returns the text of a string, number or boolean
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64, bool, int, int64, json.Number:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
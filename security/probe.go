@@ -0,0 +1,200 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SandboxProbeEnv asks a runner to probe its own sandbox instead of
+	// serving. It carries the JSON encoded ProbeTargets.
+	SandboxProbeEnv = "SECLLAMA_SANDBOX_PROBE"
+	// SandboxProbeReportFile is the name of the file a probing runner writes
+	// its ProbeReport to, in its scratch directory
+	SandboxProbeReportFile = "sandbox-probe.json"
+)
+
+// probeTimeout bounds each network probe, so a silently dropped packet
+// counts as blocked rather than stalling the report
+const probeTimeout = 3 * time.Second
+
+// ProbeTargets are the resources a sandboxed runner must not be able to reach
+type ProbeTargets struct {
+	// TCP and UDP are outbound addresses connections are attempted to
+	TCP string `json:"tcp"`
+	UDP string `json:"udp"`
+	// DNS is a host name the probe tries to resolve
+	DNS string `json:"dns"`
+	// Loopback is a local address, normally the server's own API
+	Loopback string `json:"loopback,omitempty"`
+	// DeniedPaths must be unreadable from inside the sandbox
+	DeniedPaths []string `json:"denied_paths,omitempty"`
+	// NetNS identifies the parent's network namespace, which the runner must
+	// not share (Linux only)
+	NetNS string `json:"netns,omitempty"`
+}
+
+// DefaultProbeTargets returns well-known public endpoints and the existing
+// paths among deniedPaths
+func DefaultProbeTargets(loopback string, deniedPaths ...string) ProbeTargets {
+	targets := ProbeTargets{
+		TCP:      "1.1.1.1:443",
+		UDP:      "1.1.1.1:53",
+		DNS:      "example.com",
+		Loopback: loopback,
+		NetNS:    currentNetNS(),
+	}
+
+	for _, p := range deniedPaths {
+		if _, err := os.Stat(p); err == nil {
+			targets.DeniedPaths = append(targets.DeniedPaths, p)
+		}
+	}
+
+	return targets
+}
+
+// ProbeResult is the outcome of a single sandbox probe
+type ProbeResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ProbeReport is what a probing runner found out about its own sandbox
+type ProbeReport struct {
+	// Isolation are the mechanisms the runner observed being applied to itself
+	Isolation []ProbeResult `json:"isolation,omitempty"`
+	// Probes are attempts to escape the sandbox; each passes if it was blocked
+	Probes []ProbeResult `json:"probes"`
+}
+
+// RunRunnerSandboxProbe runs the probes requested through SandboxProbeEnv and
+// writes the report to SandboxProbeReportFile in the runner's scratch
+// directory. It reports whether a probe was requested.
+func RunRunnerSandboxProbe() (bool, error) {
+	s, ok := os.LookupEnv(SandboxProbeEnv)
+	if !ok {
+		return false, nil
+	}
+
+	var targets ProbeTargets
+	if err := json.Unmarshal([]byte(s), &targets); err != nil {
+		return true, fmt.Errorf("invalid %s: %w", SandboxProbeEnv, err)
+	}
+
+	data, err := json.Marshal(ProbeReport{
+		Isolation: isolationProbes(targets),
+		Probes:    RunSandboxProbes(context.Background(), targets),
+	})
+	if err != nil {
+		return true, err
+	}
+
+	return true, os.WriteFile(filepath.Join(os.TempDir(), SandboxProbeReportFile), data, 0o600)
+}
+
+// RunSandboxProbes tries to reach each of targets from the current process
+func RunSandboxProbes(ctx context.Context, targets ProbeTargets) []ProbeResult {
+	var results []ProbeResult
+	blocked := func(name string, err error) {
+		if err == nil {
+			results = append(results, ProbeResult{Name: name, Passed: false, Detail: "succeeded"})
+		} else {
+			results = append(results, ProbeResult{Name: name, Passed: true, Detail: err.Error()})
+		}
+	}
+
+	blocked("outbound tcp "+targets.TCP, probeDial(ctx, "tcp", targets.TCP))
+	blocked("outbound udp "+targets.UDP, probeUDP(ctx, targets.UDP))
+	blocked("dns lookup "+targets.DNS, probeDNS(ctx, targets.DNS))
+	if targets.Loopback != "" {
+		blocked("loopback tcp "+targets.Loopback, probeDial(ctx, "tcp", targets.Loopback))
+	}
+
+	for _, p := range targets.DeniedPaths {
+		blocked("read "+p, probeRead(p))
+	}
+
+	blocked("write outside scratch dir", probeWrite(filepath.Dir(os.TempDir())))
+	return results
+}
+
+func probeDial(ctx context.Context, network, addr string) error {
+	d := net.Dialer{Timeout: probeTimeout}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeUDP sends a DNS query for the root zone, and only succeeds if an
+// answer comes back: unlike TCP, a UDP "connection" can't fail on its own
+func probeUDP(ctx context.Context, addr string) error {
+	d := net.Dialer{Timeout: probeTimeout}
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return err
+	}
+
+	query := []byte{0x53, 0x4c, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 1}
+	if _, err := conn.Write(query); err != nil {
+		return err
+	}
+
+	_, err = conn.Read(make([]byte, 512))
+	return err
+}
+
+func probeDNS(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
+
+func probeRead(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		_, err = f.ReadDir(1)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return err
+	}
+
+	_, err = f.Read(make([]byte, 1))
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return err
+}
+
+// probeWrite creates and immediately removes a file in dir
+func probeWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".secllama-probe-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
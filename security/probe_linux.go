@@ -0,0 +1,76 @@
+package security
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// currentNetNS identifies the network namespace of the current process
+func currentNetNS() string {
+	ns, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return ""
+	}
+	return ns
+}
+
+// isolationProbes checks which of the Linux sandbox mechanisms are in effect
+// for the current process
+func isolationProbes(targets ProbeTargets) []ProbeResult {
+	status := procStatus()
+
+	netns := ProbeResult{Name: "network namespace", Detail: currentNetNS()}
+	netns.Passed = netns.Detail != "" && targets.NetNS != "" && netns.Detail != targets.NetNS
+	if netns.Detail == targets.NetNS {
+		netns.Detail = "shared with server (" + netns.Detail + ")"
+	}
+
+	landlock := ProbeResult{Name: "landlock"}
+	if abi, ok := os.LookupEnv(LandlockAppliedEnv); ok {
+		landlock.Passed = true
+		landlock.Detail = "ABI v" + abi
+	} else if s := GetLandlockStatus(); !s.Supported() {
+		landlock.Detail = s.String()
+	} else {
+		landlock.Detail = "not applied"
+	}
+
+	seccomp := ProbeResult{Name: "seccomp"}
+	mode := os.Getenv(SeccompEnv)
+	switch {
+	case status["Seccomp"] != "2":
+		seccomp.Detail = "no filter installed"
+	case mode != SeccompEnforce.String():
+		seccomp.Detail = fmt.Sprintf("filter installed in %s mode", mode)
+	default:
+		seccomp.Passed = true
+		seccomp.Detail = "filter installed in enforce mode"
+	}
+
+	nnp := ProbeResult{Name: "no_new_privs", Passed: status["NoNewPrivs"] == "1"}
+	if !nnp.Passed {
+		nnp.Detail = "not set"
+	}
+
+	return []ProbeResult{netns, landlock, seccomp, nnp}
+}
+
+// procStatus returns the fields of /proc/self/status
+func procStatus() map[string]string {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), ":"); ok {
+			fields[k] = strings.TrimSpace(v)
+		}
+	}
+	return fields
+}
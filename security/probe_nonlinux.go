@@ -0,0 +1,14 @@
+//go:build !linux
+
+package security
+
+// currentNetNS returns "": network namespaces are Linux specific
+func currentNetNS() string {
+	return ""
+}
+
+// isolationProbes returns nothing: the macOS and Windows sandboxes can only be
+// verified through the escape probes
+func isolationProbes(ProbeTargets) []ProbeResult {
+	return nil
+}
@@ -0,0 +1,43 @@
+package security
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Outside a sandbox, the probes for resources this process can reach must fail
+func TestRunSandboxProbesUnconfined(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	readable := filepath.Join(t.TempDir(), "readable")
+	if err := os.WriteFile(readable, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := DefaultProbeTargets(l.Addr().String(), readable, filepath.Join(t.TempDir(), "missing"))
+	if len(targets.DeniedPaths) != 1 {
+		t.Fatalf("expected missing paths to be skipped, got %v", targets.DeniedPaths)
+	}
+
+	results := map[string]ProbeResult{}
+	for _, r := range RunSandboxProbes(t.Context(), targets) {
+		results[strings.Fields(r.Name)[0]] = r
+	}
+
+	for _, name := range []string{"loopback", "read"} {
+		r, ok := results[name]
+		if !ok {
+			t.Fatalf("missing %s probe", name)
+		}
+		if r.Passed {
+			t.Errorf("%s: expected probe to detect unconfined access, got %+v", r.Name, r)
+		}
+	}
+}
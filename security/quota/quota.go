@@ -0,0 +1,255 @@
+// Package quota limits how much of a shared server each caller can use: how
+// many requests they make per minute, how many run at once, and how many
+// prompt and generated tokens they use per hour.
+//
+// Callers are identified by strings such as "key:<id>", "uid:<uid>" or
+// "addr:<ip>"; the server decides which applies to a request. Usage is kept in
+// memory, so it starts over when the server restarts.
+package quota
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits are the limits of one caller. Zero means no limit.
+type Limits struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	Concurrent        int `json:"concurrent,omitempty"`
+	TokensPerHour     int `json:"tokens_per_hour,omitempty"`
+}
+
+// Config is the content of a limits file. Callers listed in Callers get
+// their limits instead of the default ones.
+type Config struct {
+	Default Limits            `json:"default"`
+	Callers map[string]Limits `json:"callers,omitempty"`
+}
+
+// Load returns a Limiter configured by the JSON file at path, or nil if there
+// is none
+func Load(path string) (*Limiter, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return New(cfg), nil
+}
+
+// LimitError is returned for requests over a limit
+type LimitError struct {
+	// Limit is the name of the limit in Limits, e.g. "requests_per_minute"
+	Limit string
+	// RetryAfter is how long until the request would be allowed
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded: %s, retry in %s", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+type tokenUse struct {
+	at time.Time
+	n  int
+}
+
+type usage struct {
+	requests []time.Time
+	tokens   []tokenUse
+	active   int
+}
+
+// prune forgets requests and tokens that no longer count against any limit
+func (u *usage) prune(now time.Time) {
+	u.requests = u.requests[expired(u.requests, now.Add(-time.Minute), func(t time.Time) time.Time { return t }):]
+	u.tokens = u.tokens[expired(u.tokens, now.Add(-time.Hour), func(t tokenUse) time.Time { return t.at }):]
+}
+
+// expired returns how many of the entries of s, in order of time, are at or
+// before cutoff
+func expired[E any](s []E, cutoff time.Time, at func(E) time.Time) int {
+	i, _ := slices.BinarySearchFunc(s, cutoff, func(e E, cutoff time.Time) int {
+		if at(e).After(cutoff) {
+			return 1
+		}
+		return -1
+	})
+	return i
+}
+
+func (u *usage) idle() bool {
+	return u.active == 0 && len(u.requests) == 0 && len(u.tokens) == 0
+}
+
+func (u *usage) tokenCount() (n int) {
+	for _, t := range u.tokens {
+		n += t.n
+	}
+	return n
+}
+
+// Limiter tracks the usage of each caller against their limits. It is safe
+// for concurrent use.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	callers   map[string]*usage
+	lastSweep time.Time
+}
+
+// New returns a Limiter enforcing cfg
+func New(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, now: time.Now, callers: make(map[string]*usage)}
+}
+
+// Limits returns the limits of caller
+func (l *Limiter) Limits(caller string) Limits {
+	if limits, ok := l.cfg.Callers[caller]; ok {
+		return limits
+	}
+	return l.cfg.Default
+}
+
+// usage returns the usage of caller, pruned, and forgets idle callers every
+// minute. l.mu must be held.
+func (l *Limiter) usage(caller string, now time.Time) *usage {
+	if now.Sub(l.lastSweep) > time.Minute {
+		for c, u := range l.callers {
+			if u.prune(now); u.idle() {
+				delete(l.callers, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	u, ok := l.callers[caller]
+	if !ok {
+		u = &usage{}
+		l.callers[caller] = u
+	}
+	u.prune(now)
+	return u
+}
+
+// Acquire starts a request by caller, or returns a *LimitError if it would go
+// over one of their limits. release must be called once the request is done.
+func (l *Limiter) Acquire(caller string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	limits := l.Limits(caller)
+	u := l.usage(caller, now)
+
+	if limits.Concurrent > 0 && u.active >= limits.Concurrent {
+		return nil, &LimitError{Limit: "concurrent", RetryAfter: time.Second}
+	}
+
+	if limits.RequestsPerMinute > 0 && len(u.requests) >= limits.RequestsPerMinute {
+		oldest := u.requests[len(u.requests)-limits.RequestsPerMinute]
+		return nil, &LimitError{Limit: "requests_per_minute", RetryAfter: oldest.Add(time.Minute).Sub(now)}
+	}
+
+	if limits.TokensPerHour > 0 {
+		if n := u.tokenCount(); n >= limits.TokensPerHour {
+			// wait until enough of the oldest usage expires
+			var retry time.Duration
+			for _, t := range u.tokens {
+				n -= t.n
+				if n < limits.TokensPerHour {
+					retry = t.at.Add(time.Hour).Sub(now)
+					break
+				}
+			}
+			return nil, &LimitError{Limit: "tokens_per_hour", RetryAfter: retry}
+		}
+	}
+
+	u.requests = append(u.requests, now)
+	u.active++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			u.active--
+		})
+	}, nil
+}
+
+// Record counts tokens used by a request of caller
+func (l *Limiter) Record(caller string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	u := l.usage(caller, now)
+	u.tokens = append(u.tokens, tokenUse{now, tokens})
+}
+
+// Usage is the current usage of a caller
+type Usage struct {
+	Caller string
+	// Requests counts the requests of the last minute
+	Requests   int
+	Concurrent int
+	// Tokens counts the tokens of the last hour
+	Tokens int
+	Limits Limits
+}
+
+// Usage returns the current usage of caller
+func (l *Limiter) Usage(caller string) Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.usageOf(caller, l.usage(caller, l.now()))
+}
+
+// All returns the current usage of every caller with any, sorted by caller
+func (l *Limiter) All() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	all := make([]Usage, 0, len(l.callers))
+	for caller, u := range l.callers {
+		if u.prune(now); !u.idle() {
+			all = append(all, l.usageOf(caller, u))
+		}
+	}
+
+	slices.SortFunc(all, func(a, b Usage) int { return cmp.Compare(a.Caller, b.Caller) })
+	return all
+}
+
+func (l *Limiter) usageOf(caller string, u *usage) Usage {
+	return Usage{
+		Caller:     caller,
+		Requests:   len(u.requests),
+		Concurrent: u.active,
+		Tokens:     u.tokenCount(),
+		Limits:     l.Limits(caller),
+	}
+}
@@ -0,0 +1,140 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testLimiter(cfg Config) (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func limitOf(t *testing.T, err error) *LimitError {
+	t.Helper()
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a LimitError, got %v", err)
+	}
+	return limitErr
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	l, now := testLimiter(Config{Default: Limits{RequestsPerMinute: 2}})
+
+	for range 2 {
+		release, err := l.Acquire("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+		*now = now.Add(10 * time.Second)
+	}
+
+	_, err := l.Acquire("a")
+	if e := limitOf(t, err); e.Limit != "requests_per_minute" || e.RetryAfter != 40*time.Second {
+		t.Errorf("got %+v", e)
+	}
+
+	// other callers have their own budget
+	if _, err := l.Acquire("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(40 * time.Second)
+	if _, err := l.Acquire("a"); err != nil {
+		t.Fatalf("after the window: %v", err)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	l, _ := testLimiter(Config{Default: Limits{Concurrent: 1}})
+
+	release, err := l.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.Acquire("a")
+	if e := limitOf(t, err); e.Limit != "concurrent" {
+		t.Errorf("got %+v", e)
+	}
+
+	if u := l.Usage("a"); u.Concurrent != 1 {
+		t.Errorf("concurrent %d", u.Concurrent)
+	}
+
+	release()
+	release()
+
+	if _, err := l.Acquire("a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokensPerHour(t *testing.T) {
+	l, now := testLimiter(Config{
+		Default: Limits{TokensPerHour: 100},
+		Callers: map[string]Limits{"batch": {TokensPerHour: 10}},
+	})
+
+	l.Record("a", 60)
+	*now = now.Add(10 * time.Minute)
+	l.Record("a", 50)
+	*now = now.Add(10 * time.Minute)
+
+	_, err := l.Acquire("a")
+	if e := limitOf(t, err); e.Limit != "tokens_per_hour" || e.RetryAfter != 40*time.Minute {
+		t.Errorf("got %+v", e)
+	}
+
+	if u := l.Usage("a"); u.Tokens != 110 || u.Limits.TokensPerHour != 100 {
+		t.Errorf("got %+v", u)
+	}
+
+	l.Record("batch", 10)
+	if _, err := l.Acquire("batch"); err == nil {
+		t.Error("expected the caller's own limit to apply")
+	}
+
+	*now = now.Add(40 * time.Minute)
+	if _, err := l.Acquire("a"); err != nil {
+		t.Fatalf("after the oldest usage expired: %v", err)
+	}
+
+	all := l.All()
+	if len(all) != 2 || all[0].Caller != "a" || all[1].Caller != "batch" {
+		t.Errorf("got %+v", all)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || l != nil {
+		t.Fatalf("missing file: %v, %v", l, err)
+	}
+
+	path := filepath.Join(dir, "limits.json")
+	if err := os.WriteFile(path, []byte(`{"default": {"requests_per_minute": 60}, "callers": {"uid:1000": {"concurrent": 2}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := l.Limits("uid:1000"); got != (Limits{Concurrent: 2}) {
+		t.Errorf("got %+v", got)
+	}
+	if got := l.Limits("uid:1001"); got != (Limits{RequestsPerMinute: 60}) {
+		t.Errorf("got %+v", got)
+	}
+}
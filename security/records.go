@@ -0,0 +1,202 @@
+package security
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// recordsVersion is the version of the sealed record file format:
+//
+//	<format> <version> <key ID>
+//	<base64 record 0>
+//	<base64 record 1>
+//	...
+//	mac <base64 HMAC-SHA256 of every line above>
+//
+// Each record is sealed with the key named in the header, its format and
+// sequence number authenticated with it, so records can't be moved within a
+// file or between files of different formats. The MAC detects records that
+// were removed, added or truncated at the end.
+const recordsVersion = 1
+
+// ErrIntegrity is returned when a sealed record file was modified, or
+// isn't one
+var ErrIntegrity = errors.New("integrity check failed")
+
+// IsRecordFile reports whether data starts like a sealed record file of the
+// given format
+func IsRecordFile(data []byte, format string) bool {
+	return bytes.HasPrefix(data, []byte(format+" "))
+}
+
+// recordAD returns the associated data sealed with record seq
+func recordAD(format string, seq int) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(format), 0), uint64(seq))
+}
+
+// writeRecords writes records sealed with e's active key to w, as a sealed
+// record file of the given format
+func writeRecords(e *MessageEncryptor, w io.Writer, format string, records [][]byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %s\n", format, recordsVersion, e.KeyID())
+
+	for seq, record := range records {
+		sealed, err := e.Seal(record, recordAD(format, seq))
+		if err != nil {
+			return err
+		}
+
+		buf.WriteString(base64.StdEncoding.EncodeToString(sealed))
+		buf.WriteByte('\n')
+	}
+
+	mac, err := e.MAC(e.KeyID(), buf.Bytes())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&buf, "mac %s\n", base64.StdEncoding.EncodeToString(mac))
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// readRecords opens the records of a sealed record file of the given format.
+// It fails with ErrIntegrity if the file was modified, and with
+// ErrUnknownKey if e doesn't know the key it was sealed with.
+func readRecords(e *MessageEncryptor, data []byte, format string) ([][]byte, error) {
+	body, trailer, ok := cutLastLine(data)
+	if !ok || !strings.HasPrefix(trailer, "mac ") {
+		return nil, fmt.Errorf("%w: missing MAC", ErrIntegrity)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+
+	var version int
+	var keyID string
+	if n, err := fmt.Sscanf(lines[0], format+" %d %s", &version, &keyID); n != 2 || err != nil {
+		return nil, fmt.Errorf("%w: not a %s file", ErrIntegrity, format)
+	} else if version != recordsVersion {
+		return nil, fmt.Errorf("unsupported %s version %d", format, version)
+	}
+
+	want, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(trailer, "mac "))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid MAC", ErrIntegrity)
+	}
+
+	mac, err := e.MAC(keyID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(mac, want) {
+		return nil, fmt.Errorf("%w: MAC mismatch", ErrIntegrity)
+	}
+
+	records := make([][]byte, 0, len(lines)-1)
+	for seq, line := range lines[1:] {
+		sealed, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrIntegrity, seq, err)
+		}
+
+		record, err := e.Open(sealed, recordAD(format, seq))
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrIntegrity, seq, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// cutLastLine splits data before its last newline terminated line
+func cutLastLine(data []byte) (body []byte, last string, ok bool) {
+	data, ok = bytes.CutSuffix(data, []byte("\n"))
+	if !ok {
+		return nil, "", false
+	}
+
+	i := bytes.LastIndexByte(data, '\n')
+	if i < 0 {
+		return nil, "", false
+	}
+	return data[:i+1], string(data[i+1:]), true
+}
+
+// WriteRecords writes records to w as a sealed record file of the given
+// format, sealed with the active key
+func (m *Manager) WriteRecords(w io.Writer, format string, records [][]byte) error {
+	m.refreshKeys()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.encryptor == nil {
+		return fmt.Errorf("encryptor not initialized")
+	}
+
+	return writeRecords(m.encryptor, w, format, records)
+}
+
+// ReadRecords opens the records of a sealed record file of the given format.
+// It fails with ErrIntegrity if the file was modified. The caller wipes the
+// records once done with them.
+func (m *Manager) ReadRecords(data []byte, format string) ([][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.encryptor == nil {
+		return nil, fmt.Errorf("encryptor not initialized")
+	}
+
+	records, err := readRecords(m.encryptor, data, format)
+	if !errors.Is(err, ErrUnknownKey) {
+		return records, err
+	}
+	m.mu.RUnlock()
+
+	// The key may have been rotated by another process since it was loaded
+	m.mu.Lock()
+	if m.encryptor != nil {
+		if reloadErr := m.reloadKeys(); reloadErr != nil {
+			slog.Warn("failed to reload encryption keys", "error", reloadErr)
+		}
+	}
+	m.mu.Unlock()
+
+	m.mu.RLock()
+	if m.encryptor == nil {
+		return nil, fmt.Errorf("encryptor not initialized")
+	}
+	return readRecords(m.encryptor, data, format)
+}
+
+// sealedAccount returns the keystore account marking format as written in
+// sealed record files
+func sealedAccount(format string) string {
+	return "sealed." + format
+}
+
+// MarkSealed records in the keystore that files of the given format are
+// sealed record files. Readers that still accept an older, unauthenticated
+// format check IsSealed, so that a file replaced with one in the older format
+// is detected rather than migrated.
+func (m *Manager) MarkSealed(format string) error {
+	if m.keyStore.KeyExists(sealedAccount(format)) {
+		return nil
+	}
+	return m.keyStore.StoreKey(sealedAccount(format), []byte(format))
+}
+
+// IsSealed reports whether MarkSealed was called for format
+func (m *Manager) IsSealed(format string) bool {
+	return m.keyStore.KeyExists(sealedAccount(format))
+}
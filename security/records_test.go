@@ -0,0 +1,118 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecords(t *testing.T) {
+	e, err := NewMessageEncryptor(mustKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	records := [][]byte{[]byte("first"), []byte("aGVsbG8="), []byte("multi\nline")}
+	if err := writeRecords(e, &buf, "test-records", records); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if !IsRecordFile(data, "test-records") || IsRecordFile(data, "other") {
+		t.Fatal("IsRecordFile doesn't recognise the format")
+	}
+
+	got, err := readRecords(e, data, "test-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("got %d records", len(got))
+	}
+	for i := range records {
+		if !bytes.Equal(got[i], records[i]) {
+			t.Errorf("record %d: got %q", i, got[i])
+		}
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	// header, three records, mac and the empty string after the last newline
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+
+	tampered := map[string]string{
+		"removed":       lines[0] + lines[1] + lines[3] + lines[4] + lines[5],
+		"reordered":     lines[0] + lines[2] + lines[1] + lines[3] + lines[4],
+		"truncated":     lines[0] + lines[1] + lines[2],
+		"no mac":        lines[0] + lines[1] + lines[2] + lines[3],
+		"changed mac":   lines[0] + lines[1] + lines[2] + lines[3] + "mac AAAA\n",
+		"other format":  strings.Replace(string(data), "test-records", "test-record2", 1),
+		"appended line": string(data) + lines[1],
+	}
+
+	for name, data := range tampered {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readRecords(e, []byte(data), "test-records"); !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("expected ErrIntegrity, got %v", err)
+			}
+		})
+	}
+
+	// the records of a file can't be passed off as another format's, even
+	// with a valid MAC
+	var forged bytes.Buffer
+	forged.WriteString("other 1 " + e.KeyID() + "\n" + lines[1])
+	mac, err := e.MAC(e.KeyID(), forged.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.WriteString("mac " + base64.StdEncoding.EncodeToString(mac) + "\n")
+	if _, err := readRecords(e, forged.Bytes(), "other"); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity, got %v", err)
+	}
+}
+
+func TestRecordsRetiredKey(t *testing.T) {
+	m, err := newManagerWithKeyStore(newMemKeyStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteRecords(&buf, "test-records", [][]byte{[]byte("before rotation")}); err != nil {
+		t.Fatal(err)
+	}
+
+	withReEncrypters(t, map[string]ReEncrypter{
+		"test": func(m *Manager) error {
+			records, err := m.ReadRecords(buf.Bytes(), "test-records")
+			if err != nil {
+				return err
+			}
+
+			buf.Reset()
+			return m.WriteRecords(&buf, "test-records", records)
+		},
+	})
+
+	oldID := m.KeyID()
+	if err := m.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), oldID) {
+		t.Fatal("expected the file to be rewritten with the new key")
+	}
+
+	records, err := m.ReadRecords(buf.Bytes(), "test-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || string(records[0]) != "before rotation" {
+		t.Fatalf("got %q", records)
+	}
+}
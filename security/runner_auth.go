@@ -0,0 +1,75 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// runnerSecretSize is the number of random bytes in a runner secret
+const runnerSecretSize = 32
+
+// GenerateRunnerSecret returns a fresh secret a runner requires on every
+// request. Each runner gets its own, so a process that can connect to one
+// runner's socket still can't drive it.
+func GenerateRunnerSecret() (string, error) {
+	b := make([]byte, runnerSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate runner secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ReadRunnerSecret reads the secret the server passed to a runner through r,
+// normally the read end of a pipe. Secrets never travel through argv or the
+// environment, which other local users can read from /proc.
+func ReadRunnerSecret(r io.Reader) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(r, 4*runnerSecretSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read runner secret: %w", err)
+	}
+
+	secret := strings.TrimSpace(string(b))
+	if len(secret) != 2*runnerSecretSize {
+		return "", errors.New("invalid runner secret")
+	}
+	return secret, nil
+}
+
+// RunnerAuthHandler rejects requests to h that don't carry secret as a bearer
+// token
+func RunnerAuthHandler(secret string, h http.Handler) http.Handler {
+	expected := []byte("Bearer " + secret)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NewRunnerClient creates an HTTP client for the runner listening on socket,
+// authenticating every request with secret
+func NewRunnerClient(socket, secret string) *http.Client {
+	client := NewUnixSocketClient(socket)
+	client.Transport = &bearerTransport{token: secret, base: client.Transport}
+	return client
+}
+
+// bearerTransport adds a bearer token to every request
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
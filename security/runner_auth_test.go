@@ -0,0 +1,77 @@
+package security
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunnerAuth(t *testing.T) {
+	secret, err := GenerateRunnerSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "runner.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: RunnerAuthHandler(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))}
+	go srv.Serve(l) //nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+
+	other, err := GenerateRunnerSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		client *http.Client
+		status int
+	}{
+		"secret":       {NewRunnerClient(socket, secret), http.StatusOK},
+		"no secret":    {NewUnixSocketClient(socket), http.StatusUnauthorized},
+		"wrong secret": {NewRunnerClient(socket, other), http.StatusUnauthorized},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := tt.client.Get("http://runner/health")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestReadRunnerSecret(t *testing.T) {
+	secret, err := GenerateRunnerSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadRunnerSecret(strings.NewReader(secret + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != secret {
+		t.Errorf("expected %q, got %q", secret, got)
+	}
+
+	for _, input := range []string{"", "short\n", strings.Repeat("a", 200)} {
+		if _, err := ReadRunnerSecret(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
@@ -1,22 +1,82 @@
 package security
 
 import (
+	"fmt"
 	"log/slog"
 	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/envconfig"
 )
 
 // SandboxConfig defines configuration for sandboxing runner processes
 type SandboxConfig struct {
-	// AllowLocalhost allows connections to localhost (required for runner communication)
+	// AllowLocalhost allows connections to localhost. Runners are reached over
+	// SocketPath instead, so this is no longer required for runner communication.
 	AllowLocalhost bool
 	// AllowedPorts specifies which ports can be accessed (if AllowLocalhost is true)
 	AllowedPorts []int
+	// SocketPath is the Unix socket the runner serves its API on
+	SocketPath string
 	// WorkingDirectory is the directory where the runner can operate
 	WorkingDirectory string
 	// AllowedReadPaths are paths the runner can read from
 	AllowedReadPaths []string
 	// AllowedWritePaths are paths the runner can write to
 	AllowedWritePaths []string
+	// Seccomp selects whether the runner installs its seccomp filter and
+	// whether violations are denied or only logged (Linux only)
+	Seccomp SeccompMode
+	// Landlock confines the runner's filesystem access to AllowedReadPaths and
+	// AllowedWritePaths where the kernel supports it (Linux only)
+	Landlock bool
+}
+
+// DefaultSandboxConfig returns the sandbox configuration for a runner serving
+// its API on socketPath: no network access at all, read-only access to
+// readPaths (the runner executable, model files and GPU libraries it was
+// started with), and write access only to the socket's private directory,
+// which doubles as the runner's scratch directory
+func DefaultSandboxConfig(socketPath string, readPaths ...string) SandboxConfig {
+	seccomp, err := ParseSeccompMode(envconfig.Seccomp())
+	if err != nil {
+		slog.Warn("invalid seccomp mode, enforcing", "error", err)
+		seccomp = SeccompEnforce
+	}
+
+	socketDir := filepath.Dir(socketPath)
+	return SandboxConfig{
+		AllowLocalhost:    false,
+		SocketPath:        socketPath,
+		WorkingDirectory:  socketDir,
+		AllowedReadPaths:  readPaths,
+		AllowedWritePaths: []string{socketDir},
+		Seccomp:           seccomp,
+		Landlock:          envconfig.Landlock(),
+	}
+}
+
+// LandlockStatus describes whether the kernel can confine a runner's
+// filesystem access with Landlock
+type LandlockStatus struct {
+	// ABI is the Landlock ABI version the kernel implements, or 0 if Landlock
+	// is unavailable
+	ABI int
+	// Reason explains why Landlock is unavailable
+	Reason string
+}
+
+// Supported reports whether Landlock can be used
+func (s LandlockStatus) Supported() bool {
+	return s.ABI > 0
+}
+
+func (s LandlockStatus) String() string {
+	if s.Supported() {
+		return fmt.Sprintf("supported (ABI v%d)", s.ABI)
+	}
+	return "unsupported: " + s.Reason
 }
 
 // ApplySandbox applies OS-specific sandboxing to a command
@@ -38,3 +98,41 @@ const (
 	LocalNetworkOnly
 )
 
+// SeccompMode controls the seccomp filter installed in runner processes
+type SeccompMode int
+
+const (
+	// SeccompDisabled installs no filter
+	SeccompDisabled SeccompMode = iota
+	// SeccompLog allows filtered syscalls but records them in the audit log
+	SeccompLog
+	// SeccompEnforce denies filtered syscalls with EPERM
+	SeccompEnforce
+)
+
+func (m SeccompMode) String() string {
+	switch m {
+	case SeccompDisabled:
+		return "off"
+	case SeccompLog:
+		return "log"
+	case SeccompEnforce:
+		return "enforce"
+	default:
+		return fmt.Sprintf("SeccompMode(%d)", int(m))
+	}
+}
+
+// ParseSeccompMode parses "off", "log" or "enforce"
+func ParseSeccompMode(s string) (SeccompMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "off", "false", "0", "disabled":
+		return SeccompDisabled, nil
+	case "log", "audit":
+		return SeccompLog, nil
+	case "enforce", "on", "true", "1":
+		return SeccompEnforce, nil
+	default:
+		return SeccompDisabled, fmt.Errorf("unknown seccomp mode %q", s)
+	}
+}
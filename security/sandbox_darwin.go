@@ -13,50 +13,55 @@ import (
 func applySandbox(cmd *exec.Cmd, config SandboxConfig) error {
 	// macOS has built-in sandboxing via sandbox-exec
 	// We'll create a sandbox profile that blocks network access
-	
+
 	profile := generateSandboxProfile(config)
-	
-	// Write profile to temporary file
+
+	// Write profile next to the runner socket, since each profile names its own socket
 	tmpDir := os.TempDir()
+	if config.SocketPath != "" {
+		tmpDir = filepath.Dir(config.SocketPath)
+	}
 	profilePath := filepath.Join(tmpDir, "secllama-sandbox.sb")
-	
+
 	err := os.WriteFile(profilePath, []byte(profile), 0600)
 	if err != nil {
 		return fmt.Errorf("failed to write sandbox profile: %v", err)
 	}
-	
+
 	// Wrap command with sandbox-exec
 	originalPath := cmd.Path
 	originalArgs := cmd.Args
-	
+
 	cmd.Path = "/usr/bin/sandbox-exec"
 	cmd.Args = append([]string{"sandbox-exec", "-f", profilePath, originalPath}, originalArgs[1:]...)
-	
+
 	slog.Info("macOS sandbox applied", "profile", profilePath)
-	
+
 	return nil
 }
 
 // generateSandboxProfile creates a macOS sandbox profile that blocks network
 func generateSandboxProfile(config SandboxConfig) string {
 	var sb strings.Builder
-	
+
 	sb.WriteString("(version 1)\n")
 	sb.WriteString("(debug deny)\n\n")
-	
+
 	// Allow most operations by default, only restrict specific things
 	sb.WriteString("(allow default)\n\n")
-	
-	// Deny external network access if needed
-	// Note: macOS sandbox-exec has limited fine-grained network filtering
-	// The main network security is enforced at the application layer via
-	// the localhost-only HTTP client. The sandbox provides process isolation.
+
+	// Deny all network access; the runner is reached over its Unix socket,
+	// which is the only endpoint it may bind and accept connections on
 	if !config.AllowLocalhost {
 		sb.WriteString("; Deny all network access\n")
-		sb.WriteString("(deny network-outbound)\n")
-		sb.WriteString("(deny network-bind)\n\n")
+		sb.WriteString("(deny network*)\n\n")
 	}
-	
+
+	if config.SocketPath != "" {
+		sb.WriteString("; Allow the runner API socket\n")
+		fmt.Fprintf(&sb, "(allow network-bind network-inbound (local unix-socket (path-literal %q)))\n\n", config.SocketPath)
+	}
+
 	return sb.String()
 }
 
@@ -68,4 +73,3 @@ func CheckSandboxSupport() error {
 	}
 	return nil
 }
-
@@ -1,72 +1,84 @@
 package security
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
-	"runtime"
 	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
-// applySandbox applies Linux-specific sandboxing using namespaces and seccomp
+// applySandbox applies Linux-specific sandboxing using namespaces, Landlock
+// and seccomp.
+// The runner gets a network namespace of its own with no usable interfaces,
+// not even loopback, and is reached over the Unix socket in config.SocketPath,
+// which lives in the filesystem rather than the network namespace. Creating a
+// network namespace requires CAP_SYS_ADMIN, so unprivileged servers create a
+// user namespace as well, mapping the current uid and gid onto themselves.
 func applySandbox(cmd *exec.Cmd, config SandboxConfig) error {
-	// Use Linux namespaces for isolation
-	// We'll use network namespace to isolate network access
-	
-	if cmd.SysProcAttr == nil {
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if config.SocketPath == "" {
+		return errors.New("network isolation requires the runner to listen on a Unix socket")
 	}
-	
-	// Create new network namespace to isolate network
-	// CLONE_NEWNET creates a new network namespace
-	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNET
-	
-	// Set up network namespace with only loopback
-	// This requires root or CAP_NET_ADMIN capability
-	// For non-root users, we'll use alternative methods
-	
-	slog.Info("linux sandbox applied with network isolation")
-	
-	// Alternative: Use unshare command if available
-	// This provides better compatibility without requiring root
-	unsharePath, err := exec.LookPath("unshare")
-	if err == nil {
-		// Wrap command with unshare
-		originalArgs := cmd.Args
-		cmd.Path = unsharePath
-		cmd.Args = append([]string{"unshare", "--net", "--"}, originalArgs...)
-		slog.Info("using unshare for network isolation", "args", cmd.Args)
-	} else {
-		slog.Warn("unshare not available, network isolation may be limited")
+
+	// cmd.SysProcAttr may be shared between commands
+	attr := &syscall.SysProcAttr{}
+	if cmd.SysProcAttr != nil {
+		copied := *cmd.SysProcAttr
+		attr = &copied
+	}
+
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+
+	if uid, gid := os.Geteuid(), os.Getegid(); uid != 0 {
+		if err := checkUserNamespaces(); err != nil {
+			return err
+		}
+
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+
+	cmd.SysProcAttr = attr
+	slog.Info("linux sandbox applied with network isolation", "socket", config.SocketPath, "user_namespace", attr.Cloneflags&syscall.CLONE_NEWUSER != 0)
+
+	if config.Landlock {
+		if err := SetupLandlock(cmd, config); err != nil {
+			return err
+		}
+	}
+
+	if config.Seccomp != SeccompDisabled {
+		if err := SetupSeccompFilter(cmd, config.Seccomp); err != nil {
+			return err
+		}
 	}
-	
+
 	return nil
 }
 
-// SetupSeccompFilter sets up a seccomp filter to restrict system calls
-func SetupSeccompFilter(cmd *exec.Cmd) error {
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("seccomp only supported on Linux")
-	}
-	
-	// List of blocked syscalls for network access
-	blockedSyscalls := []string{
-		"socket",     // Block socket creation
-		"connect",    // Block network connections
-		"sendto",     // Block sending data
-		"recvfrom",   // Block receiving data
-		"sendmsg",    // Block message sending
-		"recvmsg",    // Block message receiving
+// checkUserNamespaces reports an error if the kernel is known to refuse
+// unprivileged user namespaces
+func checkUserNamespaces() error {
+	for _, sysctl := range []string{
+		"/proc/sys/kernel/unprivileged_userns_clone",
+		"/proc/sys/user/max_user_namespaces",
+	} {
+		data, err := os.ReadFile(sysctl)
+		if err != nil {
+			continue
+		}
+
+		if strings.TrimSpace(string(data)) == "0" {
+			return fmt.Errorf("unprivileged user namespaces are disabled (%s is 0)", sysctl)
+		}
 	}
-	
-	slog.Info("seccomp filter would block syscalls", "syscalls", blockedSyscalls)
-	
-	// Note: Full seccomp implementation requires cgo and libseccomp
-	// For now, we'll rely on network namespace isolation
-	
+
 	return nil
 }
 
@@ -74,17 +86,17 @@ func SetupSeccompFilter(cmd *exec.Cmd) error {
 func CreateIsolatedNetworkNamespace() error {
 	// This would need to be called with appropriate privileges
 	// Requires CAP_NET_ADMIN or root
-	
+
 	// 1. Create new network namespace
 	err := unix.Unshare(unix.CLONE_NEWNET)
 	if err != nil {
 		return fmt.Errorf("failed to create network namespace: %v", err)
 	}
-	
+
 	// 2. Bring up loopback interface
 	// This requires netlink operations which we'll implement later
 	slog.Info("created isolated network namespace")
-	
+
 	return nil
 }
 
@@ -92,23 +104,22 @@ func CreateIsolatedNetworkNamespace() error {
 func WrapCommandWithFirewall(cmd *exec.Cmd, allowedPorts []int) error {
 	// This is an alternative approach using iptables
 	// Creates rules to block all but localhost traffic
-	
+
 	// Build iptables rules
 	var rules []string
 	rules = append(rules, "iptables -A OUTPUT -o lo -j ACCEPT")
 	rules = append(rules, "iptables -A OUTPUT -d 127.0.0.0/8 -j ACCEPT")
-	
+
 	for _, port := range allowedPorts {
 		rules = append(rules, fmt.Sprintf("iptables -A OUTPUT -p tcp --dport %d -d 127.0.0.1 -j ACCEPT", port))
 	}
-	
+
 	rules = append(rules, "iptables -A OUTPUT -j DROP")
-	
+
 	slog.Info("firewall rules", "rules", strings.Join(rules, " && "))
-	
+
 	// Note: Actually applying iptables rules requires root
 	// This is more of a reference implementation
-	
+
 	return nil
 }
-
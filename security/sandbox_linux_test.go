@@ -0,0 +1,82 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// netnsHelper runs inside the runner sandbox and checks that only the Unix
+// socket is reachable
+func netnsHelper() error {
+	for _, addr := range []string{"127.0.0.1:80", "1.1.1.1:53", "[::1]:80"} {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return fmt.Errorf("dial %s: expected failure", addr)
+		}
+	}
+
+	l, err := net.Listen("unix", os.Getenv("SECLLAMA_TEST_SOCKET"))
+	if err != nil {
+		return fmt.Errorf("listen on unix socket: %w", err)
+	}
+	defer l.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ok"))
+	return err
+}
+
+func TestApplySandboxNetworkIsolation(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "runner.sock")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), seccompHelperEnv+"=netns", "SECLLAMA_TEST_SOCKET="+socket)
+	cmd.Stderr = os.Stderr
+
+	config := DefaultSandboxConfig(socket)
+	config.Seccomp = SeccompDisabled
+	if err := ApplySandbox(cmd, config); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sandboxed process can't start here: %v", err)
+	}
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+
+	var conn net.Conn
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) && !strings.Contains(err.Error(), "connection refused") {
+			t.Fatal(err)
+		}
+	}
+	if conn == nil {
+		t.Fatal("timed out connecting to the sandboxed process")
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("sandboxed helper failed: %v", err)
+	}
+}
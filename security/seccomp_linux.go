@@ -0,0 +1,305 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SeccompEnv tells a runner process which seccomp mode to install at startup.
+// A filter can't be attached between fork and exec from Go, so the runner
+// installs it on itself before loading the model. It is set only by the
+// server, apart from SECLLAMA_SECCOMP, which configures the server: a user
+// setting that for a process other than the server must not install a filter.
+const SeccompEnv = "SECLLAMA_RUNNER_SECCOMP_MODE"
+
+// offsets into struct seccomp_data
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16 // low 32 bits on little-endian architectures
+)
+
+// blockedSyscalls are denied for runner processes on every architecture. A
+// model runner only needs to read files, map memory, talk to GPU drivers and
+// serve its local socket; none of these are required for that.
+var blockedSyscalls = []uintptr{
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_FSOPEN,
+	unix.SYS_FSMOUNT,
+	unix.SYS_FSCONFIG,
+	unix.SYS_MOVE_MOUNT,
+	unix.SYS_OPEN_TREE,
+	unix.SYS_KEYCTL,
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_BPF,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_USERFAULTFD,
+	unix.SYS_SETNS,
+	unix.SYS_UNSHARE,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_NAME_TO_HANDLE_AT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	unix.SYS_REBOOT,
+	unix.SYS_ACCT,
+	unix.SYS_QUOTACTL,
+	// io_uring runs operations from a kernel worker, where seccomp doesn't
+	// see them, so it would let the runner sidestep the rest of this list
+	unix.SYS_IO_URING_SETUP,
+	unix.SYS_IO_URING_ENTER,
+	unix.SYS_IO_URING_REGISTER,
+}
+
+// allowedSocketFamilies are the only address families a runner may create
+// sockets for
+var allowedSocketFamilies = []uint32{
+	unix.AF_UNIX,
+	unix.AF_INET,
+	unix.AF_INET6,
+}
+
+// SetupSeccompFilter configures cmd to install the runner seccomp filter in
+// the given mode when it starts
+func SetupSeccompFilter(cmd *exec.Cmd, mode SeccompMode) error {
+	if mode != SeccompDisabled && nativeAuditArch == 0 {
+		return fmt.Errorf("seccomp filter not supported on this architecture")
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	cmd.Env = setEnv(cmd.Env, SeccompEnv, mode.String())
+	slog.Info("runner seccomp filter configured", "mode", mode)
+	return nil
+}
+
+// setEnv sets key in env, replacing any existing value
+func setEnv(env []string, key, value string) []string {
+	env = deleteEnv(env, key)
+	return append(env, key+"="+value)
+}
+
+// deleteEnv removes key from env
+func deleteEnv(env []string, key string) []string {
+	out := env[:0:0]
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); k != key {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// InstallRunnerSeccompFilter installs the seccomp filter requested by the
+// parent through SeccompEnv. It does nothing if no filter was requested.
+func InstallRunnerSeccompFilter() error {
+	s, ok := os.LookupEnv(SeccompEnv)
+	if !ok {
+		return nil
+	}
+
+	mode, err := ParseSeccompMode(s)
+	if err != nil {
+		return err
+	}
+
+	if err := InstallSeccompFilter(mode); err != nil {
+		if mode == SeccompEnforce {
+			return fmt.Errorf("failed to install seccomp filter: %w", err)
+		}
+		slog.Warn("failed to install seccomp filter", "mode", mode, "error", err)
+		return nil
+	}
+
+	if mode != SeccompDisabled {
+		slog.Info("seccomp filter installed", "mode", mode)
+	}
+	return nil
+}
+
+// InstallSeccompFilter installs the runner seccomp filter on every thread of
+// the current process. The filter can't be removed once installed.
+func InstallSeccompFilter(mode SeccompMode) error {
+	if mode == SeccompDisabled {
+		return nil
+	}
+
+	prog, err := seccompProgram(mode)
+	if err != nil {
+		return err
+	}
+
+	// required to install a filter without CAP_SYS_ADMIN
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	fprog := unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+
+	// TSYNC applies the filter to all threads, which the Go runtime has
+	// already started by the time this runs
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP,
+		unix.SECCOMP_SET_MODE_FILTER,
+		unix.SECCOMP_FILTER_FLAG_TSYNC,
+		uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("seccomp: %w", errno)
+	}
+
+	return nil
+}
+
+// seccompProgram builds the classic BPF program for the runner filter
+func seccompProgram(mode SeccompMode) ([]unix.SockFilter, error) {
+	if nativeAuditArch == 0 {
+		return nil, errors.New("seccomp filter not supported on this architecture")
+	}
+
+	var deny uint32
+	switch mode {
+	case SeccompLog:
+		deny = unix.SECCOMP_RET_LOG
+	case SeccompEnforce:
+		deny = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	default:
+		return nil, fmt.Errorf("invalid seccomp mode %s", mode)
+	}
+
+	var b bpfBuilder
+
+	// syscalls made through another ABI (e.g. 32-bit compat) bypass the
+	// syscall numbers checked below
+	b.load(seccompDataArch)
+	b.jumpIf(unix.BPF_JEQ, nativeAuditArch, "", "deny")
+
+	b.load(seccompDataNr)
+	if abiSyscallLimit != 0 {
+		b.jumpIf(unix.BPF_JGE, abiSyscallLimit, "deny", "")
+	}
+
+	for _, nr := range append(blockedSyscalls, archBlockedSyscalls...) {
+		b.jumpIf(unix.BPF_JEQ, uint32(nr), "deny", "")
+	}
+
+	b.jumpIf(unix.BPF_JEQ, uint32(unix.SYS_SOCKET), "socket", "allow")
+
+	b.label("socket")
+	b.load(seccompDataArg0)
+	for _, family := range allowedSocketFamilies {
+		b.jumpIf(unix.BPF_JEQ, family, "allow", "")
+	}
+	b.ret(deny)
+
+	b.label("allow")
+	b.ret(unix.SECCOMP_RET_ALLOW)
+
+	b.label("deny")
+	b.ret(deny)
+
+	return b.assemble()
+}
+
+// bpfInsn is a classic BPF instruction whose jump targets are labels; an
+// empty label falls through to the next instruction
+type bpfInsn struct {
+	unix.SockFilter
+	jt, jf string
+}
+
+// bpfBuilder assembles classic BPF programs with symbolic jump targets
+type bpfBuilder struct {
+	insns  []bpfInsn
+	labels map[string]int
+}
+
+func (b *bpfBuilder) label(name string) {
+	if b.labels == nil {
+		b.labels = make(map[string]int)
+	}
+	b.labels[name] = len(b.insns)
+}
+
+func (b *bpfBuilder) load(offset uint32) {
+	b.insns = append(b.insns, bpfInsn{SockFilter: unix.SockFilter{
+		Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS,
+		K:    offset,
+	}})
+}
+
+func (b *bpfBuilder) jumpIf(op uint16, k uint32, jt, jf string) {
+	b.insns = append(b.insns, bpfInsn{
+		SockFilter: unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, K: k},
+		jt:         jt,
+		jf:         jf,
+	})
+}
+
+func (b *bpfBuilder) ret(k uint32) {
+	b.insns = append(b.insns, bpfInsn{SockFilter: unix.SockFilter{
+		Code: unix.BPF_RET | unix.BPF_K,
+		K:    k,
+	}})
+}
+
+// assemble resolves labels into relative jump offsets
+func (b *bpfBuilder) assemble() ([]unix.SockFilter, error) {
+	offset := func(pc int, label string) (uint8, error) {
+		if label == "" {
+			return 0, nil
+		}
+
+		target, ok := b.labels[label]
+		if !ok {
+			return 0, fmt.Errorf("undefined label %q", label)
+		}
+
+		delta := target - pc - 1
+		if delta < 0 || delta > 255 {
+			return 0, fmt.Errorf("jump to %q out of range", label)
+		}
+		return uint8(delta), nil
+	}
+
+	prog := make([]unix.SockFilter, len(b.insns))
+	for pc, insn := range b.insns {
+		jt, err := offset(pc, insn.jt)
+		if err != nil {
+			return nil, err
+		}
+
+		jf, err := offset(pc, insn.jf)
+		if err != nil {
+			return nil, err
+		}
+
+		prog[pc] = insn.SockFilter
+		prog[pc].Jt, prog[pc].Jf = jt, jf
+	}
+
+	if len(prog) > unix.BPF_MAXINSNS {
+		return nil, errors.New("seccomp program too long")
+	}
+	return prog, nil
+}
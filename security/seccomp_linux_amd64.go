@@ -0,0 +1,14 @@
+package security
+
+import "golang.org/x/sys/unix"
+
+const (
+	nativeAuditArch = unix.AUDIT_ARCH_X86_64
+	// abiSyscallLimit rejects x32 ABI syscalls, which set bit 30 of the number
+	abiSyscallLimit = 0x40000000
+)
+
+var archBlockedSyscalls = []uintptr{
+	unix.SYS_IOPL,
+	unix.SYS_IOPERM,
+}
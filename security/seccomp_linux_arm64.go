@@ -0,0 +1,10 @@
+package security
+
+import "golang.org/x/sys/unix"
+
+const (
+	nativeAuditArch = unix.AUDIT_ARCH_AARCH64
+	abiSyscallLimit = 0
+)
+
+var archBlockedSyscalls []uintptr
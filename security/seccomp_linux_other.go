@@ -0,0 +1,11 @@
+//go:build linux && !amd64 && !arm64
+
+package security
+
+// the runner seccomp filter is only built for amd64 and arm64
+const (
+	nativeAuditArch = 0
+	abiSyscallLimit = 0
+)
+
+var archBlockedSyscalls []uintptr
@@ -0,0 +1,191 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runBPF interprets the subset of classic BPF emitted by seccompProgram
+func runBPF(t *testing.T, prog []unix.SockFilter, data []byte) uint32 {
+	t.Helper()
+
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		insn := prog[pc]
+		switch insn.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[insn.K:])
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if acc == insn.K {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			if acc >= insn.K {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return insn.K
+		default:
+			t.Fatalf("unexpected instruction %#x at %d", insn.Code, pc)
+		}
+	}
+
+	t.Fatal("program fell off the end")
+	return 0
+}
+
+func seccompData(arch uint32, nr uintptr, arg0 uint64) []byte {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[seccompDataNr:], uint32(nr))
+	binary.LittleEndian.PutUint32(data[seccompDataArch:], arch)
+	binary.LittleEndian.PutUint64(data[seccompDataArg0:], arg0)
+	return data
+}
+
+func TestSeccompProgram(t *testing.T) {
+	if nativeAuditArch == 0 {
+		t.Skip("seccomp filter not supported on this architecture")
+	}
+
+	deny := unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	prog, err := seccompProgram(SeccompEnforce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		arch   uint32
+		nr     uintptr
+		arg0   uint64
+		expect uint32
+	}{
+		{"read", nativeAuditArch, unix.SYS_READ, 0, unix.SECCOMP_RET_ALLOW},
+		{"mmap", nativeAuditArch, unix.SYS_MMAP, 0, unix.SECCOMP_RET_ALLOW},
+		{"ptrace", nativeAuditArch, unix.SYS_PTRACE, 0, deny},
+		{"mount", nativeAuditArch, unix.SYS_MOUNT, 0, deny},
+		{"keyctl", nativeAuditArch, unix.SYS_KEYCTL, 0, deny},
+		{"bpf", nativeAuditArch, unix.SYS_BPF, 0, deny},
+		{"process_vm_readv", nativeAuditArch, unix.SYS_PROCESS_VM_READV, 0, deny},
+		{"io_uring_setup", nativeAuditArch, unix.SYS_IO_URING_SETUP, 0, deny},
+		{"io_uring_enter", nativeAuditArch, unix.SYS_IO_URING_ENTER, 0, deny},
+		{"io_uring_register", nativeAuditArch, unix.SYS_IO_URING_REGISTER, 0, deny},
+		{"socket unix", nativeAuditArch, unix.SYS_SOCKET, unix.AF_UNIX, unix.SECCOMP_RET_ALLOW},
+		{"socket inet", nativeAuditArch, unix.SYS_SOCKET, unix.AF_INET, unix.SECCOMP_RET_ALLOW},
+		{"socket inet6", nativeAuditArch, unix.SYS_SOCKET, unix.AF_INET6, unix.SECCOMP_RET_ALLOW},
+		{"socket netlink", nativeAuditArch, unix.SYS_SOCKET, unix.AF_NETLINK, deny},
+		{"socket packet", nativeAuditArch, unix.SYS_SOCKET, unix.AF_PACKET, deny},
+		{"foreign arch", 0x40000003, unix.SYS_READ, 0, deny},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := runBPF(t, prog, seccompData(tt.arch, tt.nr, tt.arg0)); actual != tt.expect {
+				t.Errorf("expected %#x, got %#x", tt.expect, actual)
+			}
+		})
+	}
+
+	logProg, err := seccompProgram(SeccompLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := runBPF(t, logProg, seccompData(nativeAuditArch, unix.SYS_PTRACE, 0)); actual != unix.SECCOMP_RET_LOG {
+		t.Errorf("expected log action, got %#x", actual)
+	}
+}
+
+// seccompHelperEnv names the helper a re-executed test binary runs
+const seccompHelperEnv = "SECLLAMA_TEST_SANDBOX_HELPER"
+
+// seccompHelper runs in a child process: installing a filter is irreversible
+func seccompHelper() error {
+	if err := InstallRunnerSeccompFilter(); err != nil {
+		return fmt.Errorf("install: %w", err)
+	}
+
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return fmt.Errorf("AF_UNIX socket: %w", err)
+	}
+	unix.Close(fd)
+
+	if _, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, 0); !errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("AF_NETLINK socket: expected EPERM, got %v", err)
+	}
+
+	if _, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_PROCESS_KEYRING, false); !errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("keyctl: expected EPERM, got %v", err)
+	}
+
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	helpers := map[string]func() error{
+		"seccomp":  seccompHelper,
+		"netns":    netnsHelper,
+		"landlock": landlockHelper,
+	}
+
+	if name := os.Getenv(seccompHelperEnv); name != "" {
+		if err := helpers[name](); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestInstallSeccompFilter(t *testing.T) {
+	if nativeAuditArch == 0 {
+		t.Skip("seccomp filter not supported on this architecture")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), seccompHelperEnv+"=seccomp")
+	if err := SetupSeccompFilter(cmd, SeccompEnforce); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if _, probeErr := unix.PrctlRetInt(unix.PR_GET_SECCOMP, 0, 0, 0, 0); probeErr != nil {
+			t.Skipf("seccomp unavailable: %v", probeErr)
+		}
+		t.Fatalf("helper failed: %v\n%s", err, out)
+	}
+}
+
+func TestSeccompSettingIsNotARunnerRequest(t *testing.T) {
+	// the user-facing setting configures the server; only the server asks a
+	// runner for a filter
+	t.Setenv("SECLLAMA_SECCOMP", "enforce")
+	if s, ok := os.LookupEnv(SeccompEnv); ok {
+		t.Skipf("%s=%s is set", SeccompEnv, s)
+	}
+
+	if mode, err := unix.PrctlRetInt(unix.PR_GET_SECCOMP, 0, 0, 0, 0); err != nil || mode != 0 {
+		t.Skipf("seccomp unavailable or already active: mode %d, %v", mode, err)
+	}
+
+	if err := InstallRunnerSeccompFilter(); err != nil {
+		t.Fatal(err)
+	}
+
+	if mode, _ := unix.PrctlRetInt(unix.PR_GET_SECCOMP, 0, 0, 0, 0); mode != 0 {
+		t.Fatalf("expected no filter, got seccomp mode %d", mode)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package security
+
+import "errors"
+
+// InstallRunnerSeccompFilter does nothing: seccomp is only available on Linux
+func InstallRunnerSeccompFilter() error {
+	return nil
+}
+
+// InstallSeccompFilter fails for any mode but SeccompDisabled: seccomp is only available on Linux
+func InstallSeccompFilter(mode SeccompMode) error {
+	if mode == SeccompDisabled {
+		return nil
+	}
+	return errors.New("seccomp is only supported on Linux")
+}
@@ -0,0 +1,104 @@
+package security
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Secret holds key material outside the Go heap, where the garbage collector
+// can't copy it and it never reaches swap. Where the platform allows, the
+// memory is locked, excluded from core dumps and surrounded by inaccessible
+// guard pages, so overruns fault instead of reading or writing neighbouring
+// secrets. Destroy zeroes and releases it; Secrets must not be copied.
+type Secret struct {
+	mu     sync.Mutex
+	region []byte
+	data   []byte
+}
+
+// lockWarning reports once that secrets couldn't be locked into memory
+var lockWarning sync.Once
+
+// NewSecret returns a zeroed Secret of size bytes
+func NewSecret(size int) (*Secret, error) {
+	if size == 0 {
+		return &Secret{}, nil
+	}
+
+	region, data, locked, err := allocSecret(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if !locked {
+		lockWarning.Do(func() {
+			slog.Warn("secrets can't be locked into memory and may be swapped out; raise RLIMIT_MEMLOCK to lock them")
+		})
+	}
+
+	return &Secret{region: region, data: data}, nil
+}
+
+// NewSecretFrom moves b into a new Secret, wiping b
+func NewSecretFrom(b []byte) (*Secret, error) {
+	defer Wipe(b)
+
+	s, err := NewSecret(len(b))
+	if err != nil {
+		return nil, err
+	}
+
+	copy(s.data, b)
+	return s, nil
+}
+
+// Bytes returns the secret itself. The slice must not be retained past
+// Destroy, after which it is empty.
+func (s *Secret) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+// Len returns the size of the secret
+func (s *Secret) Len() int {
+	return len(s.Bytes())
+}
+
+// Clone returns a copy of the secret in a Secret of its own
+func (s *Secret) Clone() (*Secret, error) {
+	b := s.Bytes()
+
+	c, err := NewSecret(len(b))
+	if err != nil {
+		return nil, err
+	}
+
+	copy(c.data, b)
+	return c, nil
+}
+
+// Destroy zeroes the secret and releases its memory. It is safe to call more
+// than once.
+func (s *Secret) Destroy() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	Wipe(s.data)
+	if s.region != nil {
+		if err := freeSecret(s.region); err != nil {
+			slog.Warn("failed to release secret memory", "error", err)
+		}
+	}
+	s.region, s.data = nil, nil
+}
+
+// Wipe overwrites b with zeroes, for plaintext and key material that has to
+// pass through ordinary memory
+func Wipe(b []byte) {
+	clear(b)
+}
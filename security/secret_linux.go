@@ -0,0 +1,8 @@
+package security
+
+import "golang.org/x/sys/unix"
+
+// dontDump excludes b from core dumps
+func dontDump(b []byte) error {
+	return unix.Madvise(b, unix.MADV_DONTDUMP)
+}
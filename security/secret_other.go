@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package security
+
+// allocSecret falls back to the Go heap where there is no way to map or lock
+// memory
+func allocSecret(size int) (region, data []byte, locked bool, err error) {
+	return nil, make([]byte, size), false, nil
+}
+
+func freeSecret([]byte) error {
+	return nil
+}
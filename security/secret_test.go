@@ -0,0 +1,85 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	src := []byte("0123456789abcdef")
+	s, err := NewSecretFrom(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Error("expected the source to be wiped")
+	}
+	if string(s.Bytes()) != "0123456789abcdef" {
+		t.Errorf("got %q", s.Bytes())
+	}
+
+	c, err := s.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+
+	b, mapped := s.Bytes(), s.region != nil
+	s.Destroy()
+	s.Destroy()
+
+	if s.Len() != 0 {
+		t.Error("expected a destroyed secret to be empty")
+	}
+	if string(c.Bytes()) != "0123456789abcdef" {
+		t.Errorf("expected the clone to outlive the original, got %q", c.Bytes())
+	}
+
+	// the memory is unmapped where the platform allows, so only look at it
+	// where it isn't
+	if !mapped && !bytes.Equal(b, make([]byte, len(b))) {
+		t.Error("expected the secret to be wiped")
+	}
+}
+
+func TestSecretSizes(t *testing.T) {
+	for _, size := range []int{0, 1, keySize, 4096, 4097} {
+		s, err := NewSecret(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := s.Bytes()
+		if len(b) != size {
+			t.Fatalf("size %d: got %d bytes", size, len(b))
+		}
+
+		// every byte is writable up to the guard page
+		for i := range b {
+			b[i] = 0xff
+		}
+		s.Destroy()
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	for _, size := range []int{keySize, 31, 1} {
+		key := bytes.Repeat([]byte{0xa5}, size)
+
+		encoded := EncodeKey(key)
+		decoded, err := DecodeKey(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decoded.Bytes(), key) {
+			t.Errorf("size %d: got %x", size, decoded.Bytes())
+		}
+		decoded.Destroy()
+	}
+
+	if _, err := DecodeKey([]byte("not base64!")); err == nil {
+		t.Error("expected an error decoding invalid base64")
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package security
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocSecret maps whole pages for size bytes between two guard pages. The
+// secret ends where the trailing guard page begins, so writing past it
+// faults. locked reports whether the pages could be locked into memory.
+func allocSecret(size int) (region, data []byte, locked bool, err error) {
+	page := os.Getpagesize()
+	inner := (size + page - 1) / page * page
+
+	region, err = unix.Mmap(-1, 0, inner+2*page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	for _, guard := range [][]byte{region[:page], region[page+inner:]} {
+		if err := unix.Mprotect(guard, unix.PROT_NONE); err != nil {
+			unix.Munmap(region)
+			return nil, nil, false, err
+		}
+	}
+
+	pages := region[page : page+inner]
+	locked = unix.Mlock(pages) == nil
+	if err := dontDump(pages); err != nil {
+		unix.Munmap(region)
+		return nil, nil, false, err
+	}
+
+	return region, pages[inner-size:], locked, nil
+}
+
+// freeSecret unmaps a region from allocSecret, which unlocks it
+func freeSecret(region []byte) error {
+	return unix.Munmap(region)
+}
@@ -0,0 +1,40 @@
+package security
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocSecret allocates whole pages for size bytes between two guard pages.
+// The secret ends where the trailing guard page begins, so writing past it
+// faults. locked reports whether the pages could be locked into memory.
+func allocSecret(size int) (region, data []byte, locked bool, err error) {
+	page := os.Getpagesize()
+	inner := (size + page - 1) / page * page
+	total := inner + 2*page
+
+	addr, err := windows.VirtualAlloc(0, uintptr(total), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// addr is memory the Go runtime doesn't manage, so it can't move
+	region = unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), total)
+
+	var old uint32
+	for _, guard := range []uintptr{addr, addr + uintptr(page+inner)} {
+		if err := windows.VirtualProtect(guard, uintptr(page), windows.PAGE_NOACCESS, &old); err != nil {
+			freeSecret(region)
+			return nil, nil, false, err
+		}
+	}
+
+	locked = windows.VirtualLock(addr+uintptr(page), uintptr(inner)) == nil
+	return region, region[page+inner-size : page+inner], locked, nil
+}
+
+// freeSecret releases a region from allocSecret, which unlocks it
+func freeSecret(region []byte) error {
+	return windows.VirtualFree(uintptr(unsafe.Pointer(&region[0])), 0, windows.MEM_RELEASE)
+}
@@ -0,0 +1,321 @@
+// Package session implements the encrypted session layer between api.Client
+// and the server.
+//
+// A client opens a session with an X25519 key exchange against [Path]. Both
+// sides derive an AES-256-GCM key from the shared secret with HKDF-SHA256, and
+// the server hands out a session ID. Every request then names its session in
+// [HeaderSession] and carries a fresh random ID in [HeaderRequest]. Request
+// and response bodies are sent as lines, one sealed message per line, so
+// streaming NDJSON keeps its framing: each line is the base64 encoding of a
+// random nonce followed by the ciphertext. The additional data binds each
+// message to its session, request, direction and position in the stream, so
+// messages can't be replayed into another request, swapped between requests
+// and responses, or reordered. Every stream ends with an empty end record,
+// marked as such in its additional data, and readers require it, so a stream
+// cut short at a line boundary is rejected rather than taken as complete.
+//
+// The key exchange is not authenticated. It keeps prompts away from anything
+// that only observes traffic, such as packet captures, logging middleware or
+// a forwarding proxy; pin the server's TLS certificate to also rule out an
+// active man in the middle.
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Path is the endpoint a client opens a session with
+	Path = "/api/session"
+	// HeaderSession names the session a request belongs to. The server sets it
+	// on sealed responses.
+	HeaderSession = "X-Secllama-Session"
+	// HeaderRequest carries the random ID of a sealed request
+	HeaderRequest = "X-Secllama-Request"
+	// HeaderError is set on responses rejecting a request's session, telling
+	// the client to open a new one
+	HeaderError = "X-Secllama-Session-Error"
+	// ContentType marks a sealed request body
+	ContentType = "application/vnd.secllama.sealed"
+)
+
+const info = "secllama session v2"
+
+// Direction distinguishes the messages of a request from those of its response
+type Direction byte
+
+const (
+	Request  Direction = 'q'
+	Response Direction = 'r'
+)
+
+// ErrInvalidMessage is returned for a message that fails to authenticate
+var ErrInvalidMessage = errors.New("session: message authentication failed")
+
+// ErrTruncated is returned for a stream that ends without its end record
+var ErrTruncated = errors.New("session: stream ended early")
+
+// HandshakeRequest opens a session
+type HandshakeRequest struct {
+	PublicKey []byte `json:"public_key"`
+}
+
+// HandshakeResponse completes the key exchange started by a HandshakeRequest
+type HandshakeResponse struct {
+	SessionID string    `json:"session_id"`
+	PublicKey []byte    `json:"public_key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GenerateKey returns a new ephemeral X25519 key
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// Key is the symmetric key of one session
+type Key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// DeriveKey completes the key exchange for session id. private is this side's
+// key; clientPublic and serverPublic are both sides' public keys, one of which
+// is private's own.
+func DeriveKey(id string, private *ecdh.PrivateKey, clientPublic, serverPublic []byte) (*Key, error) {
+	peer := serverPublic
+	if bytes.Equal(peer, private.PublicKey().Bytes()) {
+		peer = clientPublic
+	}
+
+	peerKey, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, fmt.Errorf("session: invalid public key: %w", err)
+	}
+
+	shared, err := private.ECDH(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("session: key exchange failed: %w", err)
+	}
+
+	salt := append(append([]byte{}, clientPublic...), serverPublic...)
+	secret, err := hkdf.Key(sha256.New, shared, salt, info+" "+id, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{id: id, aead: aead}, nil
+}
+
+// ID returns the session ID
+func (k *Key) ID() string {
+	return k.id
+}
+
+// NewRequestID returns a random request ID for HeaderRequest
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Stream seals or opens the messages of one direction of one request, in order
+type Stream struct {
+	key       *Key
+	direction Direction
+	requestID string
+	seq       uint64
+	ended     bool
+}
+
+// Stream returns the message stream for direction of request requestID
+func (k *Key) Stream(direction Direction, requestID string) *Stream {
+	return &Stream{key: k, direction: direction, requestID: requestID}
+}
+
+func (s *Stream) additionalData(end bool) []byte {
+	ad := make([]byte, 0, len(info)+len(s.key.id)+len(s.requestID)+12)
+	ad = append(ad, info...)
+	ad = append(ad, 0)
+	ad = append(ad, s.key.id...)
+	ad = append(ad, 0)
+	ad = append(ad, s.requestID...)
+	ad = append(ad, byte(s.direction))
+	if end {
+		ad = append(ad, 1)
+	} else {
+		ad = append(ad, 0)
+	}
+	return binary.BigEndian.AppendUint64(ad, s.seq)
+}
+
+// Seal seals the next message of the stream, returning it as a line without
+// the trailing newline
+func (s *Stream) Seal(msg []byte) []byte {
+	return s.seal(msg, false)
+}
+
+// SealEnd seals the end record that closes the stream, returning it as a line
+// without the trailing newline
+func (s *Stream) SealEnd() []byte {
+	return s.seal(nil, true)
+}
+
+func (s *Stream) seal(msg []byte, end bool) []byte {
+	nonce := make([]byte, s.key.aead.NonceSize(), s.key.aead.NonceSize()+len(msg)+s.key.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+
+	sealed := s.key.aead.Seal(nonce, nonce, msg, s.additionalData(end))
+	s.seq++
+
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(line, sealed)
+	return line
+}
+
+// Open opens the next message of the stream from a line produced by Seal. It
+// returns io.EOF for the stream's end record, after which every line is
+// rejected.
+func (s *Stream) Open(line []byte) ([]byte, error) {
+	if s.ended {
+		return nil, ErrInvalidMessage
+	}
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, bytes.TrimSpace(line))
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+	sealed = sealed[:n]
+
+	size := s.key.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrInvalidMessage
+	}
+
+	nonce, ciphertext := sealed[:size], sealed[size:]
+	msg, err := s.key.aead.Open(nil, nonce, ciphertext, s.additionalData(false))
+	if err != nil {
+		if _, err := s.key.aead.Open(nil, nonce, ciphertext, s.additionalData(true)); err != nil {
+			return nil, ErrInvalidMessage
+		}
+
+		s.seq++
+		s.ended = true
+		return nil, io.EOF
+	}
+
+	s.seq++
+	return msg, nil
+}
+
+// Done returns ErrTruncated unless the stream's end record has been opened
+func (s *Stream) Done() error {
+	if !s.ended {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// OpenAll opens every line of body, joining the messages with newlines. The
+// last line must be the stream's end record.
+func (s *Stream) OpenAll(body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, s.Done()
+	}
+
+	var out []byte
+	for i, line := range bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n")) {
+		msg, err := s.Open(line)
+		if errors.Is(err, io.EOF) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, msg...)
+	}
+
+	if err := s.Done(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Writer seals every line written to it as one message
+type Writer struct {
+	w      io.Writer
+	stream *Stream
+	buf    []byte
+}
+
+// NewWriter returns a Writer sealing lines with stream and writing them to w
+func NewWriter(w io.Writer, stream *Stream) *Writer {
+	return &Writer{w: w, stream: stream}
+}
+
+// Write seals each complete line in p. An incomplete line is buffered until
+// its newline is written, or until Close.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := w.writeMessage(w.buf[:i]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close seals any buffered incomplete line, then the end record of the
+// stream. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if len(w.buf) > 0 {
+		if err := w.writeMessage(w.buf); err != nil {
+			return err
+		}
+		w.buf = nil
+	}
+
+	_, err := w.w.Write(append(w.stream.SealEnd(), '\n'))
+	return err
+}
+
+func (w *Writer) writeMessage(msg []byte) error {
+	_, err := w.w.Write(append(w.stream.Seal(msg), '\n'))
+	return err
+}
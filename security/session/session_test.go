@@ -0,0 +1,200 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pair performs a key exchange through a Store and returns the client's key
+// and the server's key for the same session
+func pair(t *testing.T, store *Store) (client, server *Key) {
+	t.Helper()
+
+	private, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public := private.PublicKey().Bytes()
+	resp, err := store.Handshake(HandshakeRequest{PublicKey: public})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err = DeriveKey(resp.SessionID, private, public, resp.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = store.Use(resp.SessionID, "handshake-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+func TestSealOpen(t *testing.T) {
+	client, server := pair(t, NewStore(DefaultTTL))
+	requestID := NewRequestID()
+
+	seal := client.Stream(Request, requestID)
+	lines := [][]byte{seal.Seal([]byte(`{"prompt":"hello"}`)), seal.Seal(nil), seal.Seal([]byte("third"))}
+
+	open := server.Stream(Request, requestID)
+	for i, want := range []string{`{"prompt":"hello"}`, "", "third"} {
+		got, err := open.Open(lines[i])
+		if err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if string(got) != want {
+			t.Errorf("line %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	if bytes.Contains(lines[0], []byte("hello")) {
+		t.Error("sealed message contains plaintext")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	store := NewStore(DefaultTTL)
+	client, server := pair(t, store)
+	other, _ := pair(t, store)
+	requestID := NewRequestID()
+
+	seal := client.Stream(Request, requestID)
+	first := seal.Seal([]byte("first"))
+	second := seal.Seal([]byte("second"))
+
+	tampered := bytes.Clone(first)
+	tampered[len(tampered)/2] ^= 'A' ^ 'B'
+
+	cases := map[string]struct {
+		stream *Stream
+		line   []byte
+	}{
+		"tampered":           {server.Stream(Request, requestID), tampered},
+		"reordered":          {server.Stream(Request, requestID), second},
+		"other request":      {server.Stream(Request, NewRequestID()), first},
+		"other direction":    {server.Stream(Response, requestID), first},
+		"other session":      {other.Stream(Request, requestID), first},
+		"not base64":         {server.Stream(Request, requestID), []byte("!!!")},
+		"shorter than nonce": {server.Stream(Request, requestID), []byte("AAAA")},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tt.stream.Open(tt.line); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("expected ErrInvalidMessage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	client, server := pair(t, NewStore(DefaultTTL))
+	requestID := NewRequestID()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, server.Stream(Response, requestID))
+	for _, chunk := range []string{`{"a":`, "1}\n", `{"b":2}` + "\n" + `{"c"`, ":3}"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 2 {
+		t.Errorf("expected complete lines to be sealed as they are written, got %d", n)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.Stream(Response, requestID).OpenAll(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "{\"a\":1}\n{\"b\":2}\n{\"c\":3}"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	_, server := pair(t, store)
+	id := server.ID()
+
+	if _, err := store.Use(id, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Use(id, "a"); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("expected ErrReplayedRequest, got %v", err)
+	}
+
+	if _, err := store.Use("missing", "a"); !errors.Is(err, ErrUnknownSession) {
+		t.Errorf("expected ErrUnknownSession, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := store.Use(id, "b"); !errors.Is(err, ErrUnknownSession) {
+		t.Errorf("expected expired session, got %v", err)
+	}
+}
+
+func TestOpenAllTruncated(t *testing.T) {
+	client, server := pair(t, NewStore(DefaultTTL))
+	requestID := NewRequestID()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, server.Stream(Response, requestID))
+	if _, err := w.Write([]byte("{\"a\":1}\n{\"b\":2}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	lines = lines[:len(lines)-1]
+	if len(lines) != 3 {
+		t.Fatalf("expected two messages and an end record, got %d lines", len(lines))
+	}
+
+	extra := server.Stream(Response, requestID)
+	for range lines {
+		extra.Seal(nil)
+	}
+
+	cases := map[string]struct {
+		body []byte
+		err  error
+	}{
+		"complete":           {bytes.Join(lines, nil), nil},
+		"without end record": {bytes.Join(lines[:2], nil), ErrTruncated},
+		"first message only": {lines[0], ErrTruncated},
+		"empty":              {nil, ErrTruncated},
+		"line after end":     {append(bytes.Join(lines, nil), append(extra.Seal([]byte("more")), '\n')...), ErrInvalidMessage},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := client.Stream(Response, requestID).OpenAll(tt.body)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			if want := "{\"a\":1}\n{\"b\":2}"; tt.err == nil && string(got) != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long a session may sit unused before it expires
+	DefaultTTL = time.Hour
+	// maxSessions bounds the number of open sessions; the least recently
+	// used one is dropped to make room
+	maxSessions = 1024
+	// maxRequestIDs is the number of recent request IDs remembered per session
+	// to reject replayed requests
+	maxRequestIDs = 4096
+)
+
+var (
+	// ErrUnknownSession is returned for a session that expired or never existed
+	ErrUnknownSession = errors.New("unknown or expired session")
+	// ErrReplayedRequest is returned for a request ID already used in a session
+	ErrReplayedRequest = errors.New("replayed request")
+)
+
+type entry struct {
+	key      *Key
+	lastUsed time.Time
+	seen     map[string]struct{}
+	order    []string
+}
+
+// Store holds the server side of open sessions
+type Store struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*entry
+	now      func() time.Time
+}
+
+// NewStore returns an empty Store whose sessions expire after ttl without use
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, sessions: make(map[string]*entry), now: time.Now}
+}
+
+// Handshake answers a client's key exchange and opens a session
+func (s *Store) Handshake(req HandshakeRequest) (*HandshakeResponse, error) {
+	private, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+
+	public := private.PublicKey().Bytes()
+	key, err := DeriveKey(id, private, req.PublicKey, public)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expire(now)
+	s.sessions[id] = &entry{key: key, lastUsed: now, seen: make(map[string]struct{})}
+
+	return &HandshakeResponse{SessionID: id, PublicKey: public, ExpiresAt: now.Add(s.ttl)}, nil
+}
+
+// Use returns the key of session id for request requestID, rejecting request
+// IDs the session has already seen
+func (s *Store) Use(id, requestID string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.sessions[id]
+	if !ok || now.Sub(e.lastUsed) > s.ttl {
+		delete(s.sessions, id)
+		return nil, ErrUnknownSession
+	}
+
+	if _, ok := e.seen[requestID]; ok {
+		return nil, ErrReplayedRequest
+	}
+
+	e.seen[requestID] = struct{}{}
+	e.order = append(e.order, requestID)
+	if len(e.order) > maxRequestIDs {
+		delete(e.seen, e.order[0])
+		e.order = e.order[1:]
+	}
+
+	e.lastUsed = now
+	return e.key, nil
+}
+
+// expire drops expired sessions, and the least recently used ones while the
+// store is full. Callers hold s.mu.
+func (s *Store) expire(now time.Time) {
+	var oldest string
+	for id, e := range s.sessions {
+		if now.Sub(e.lastUsed) > s.ttl {
+			delete(s.sessions, id)
+		} else if oldest == "" || e.lastUsed.Before(s.sessions[oldest].lastUsed) {
+			oldest = id
+		}
+	}
+
+	if len(s.sessions) >= maxSessions {
+		delete(s.sessions, oldest)
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/apikey"
+	"github.com/ollama/ollama/security/audit"
+)
+
+// apiKeyContextKey is the gin context key of the API key a request was made
+// with
+const apiKeyContextKey = "secllama.apikey"
+
+// routeScopes is the scope each route needs, by method and path. Routes that
+// aren't listed need the admin scope; "/" and "/api/version" need no key, so
+// clients can check the server is up.
+var routeScopes = map[string]apikey.Scope{
+	"HEAD /":            "",
+	"GET /":             "",
+	"HEAD /api/version": "",
+	"GET /api/version":  "",
+
+	"HEAD /api/tags":        apikey.Read,
+	"GET /api/tags":         apikey.Read,
+	"POST /api/show":        apikey.Read,
+	"GET /api/ps":           apikey.Read,
+	"GET /api/usage":        apikey.Read,
+	"POST /api/me":          apikey.Read,
+	"POST /api/session":     apikey.Read,
+	"GET /v1/models":        apikey.Read,
+	"GET /v1/models/:model": apikey.Read,
+
+	"POST /api/generate":        apikey.Generate,
+	"POST /api/chat":            apikey.Generate,
+	"POST /api/embed":           apikey.Generate,
+	"POST /api/embeddings":      apikey.Generate,
+	"POST /v1/chat/completions": apikey.Generate,
+	"POST /v1/completions":      apikey.Generate,
+	"POST /v1/embeddings":       apikey.Generate,
+}
+
+// routeScope returns the scope the route at path needs. path is the route's
+// pattern, or "" for requests that match no route, which need a valid key of
+// any scope.
+func routeScope(method, path string) apikey.Scope {
+	if path == "" {
+		return apikey.Read
+	}
+
+	if scope, ok := routeScopes[method+" "+path]; ok {
+		return scope
+	}
+	return apikey.Admin
+}
+
+// loadAPIKeys returns the store of API keys, or nil if API keys are off
+func loadAPIKeys() *apikey.Store {
+	path := envconfig.APIKeys()
+	if path == "" {
+		return nil
+	}
+
+	keys := apikey.Open(path)
+	if enabled, err := keys.Enabled(); err != nil {
+		slog.Error("failed to read API keys, refusing requests until fixed", "path", path, "error", err)
+	} else if enabled {
+		slog.Info("API keys required", "path", path)
+	}
+	return keys
+}
+
+// authorize checks the API key of r allows scope. It returns the status to
+// refuse the request with otherwise.
+func authorize(keys *apikey.Store, r *http.Request, scope apikey.Scope) (*apikey.Key, int, error) {
+	if keys == nil || scope == "" {
+		return nil, 0, nil
+	}
+
+	enabled, err := keys.Enabled()
+	if err != nil {
+		slog.Error("failed to read API keys", "error", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to read API keys")
+	} else if !enabled {
+		return nil, 0, nil
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, http.StatusUnauthorized, errors.New("API key required: set SECLLAMA_API_KEY")
+	}
+
+	key, err := keys.Verify(strings.TrimSpace(token))
+	if errors.Is(err, apikey.ErrInvalid) {
+		return nil, http.StatusUnauthorized, err
+	} else if err != nil {
+		slog.Error("failed to read API keys", "error", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to read API keys")
+	}
+
+	if !key.Scope.Allows(scope) {
+		return nil, http.StatusForbidden, fmt.Errorf("API key %s has the %s scope, %s %s needs %s", key.ID, key.Scope, r.Method, r.URL.Path, scope)
+	}
+
+	return &key, 0, nil
+}
+
+// apiKeyMiddleware refuses requests without an API key allowing the scope
+// their route needs, once any API keys exist
+func apiKeyMiddleware(keys *apikey.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, status, err := authorize(keys, c.Request, routeScope(c.Request.Method, c.FullPath()))
+		if err != nil {
+			if status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", `Bearer realm="secllama"`)
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		if key != nil {
+			c.Set(apiKeyContextKey, key)
+		}
+		c.Next()
+	}
+}
+
+// localRegistryHandler checks the API key of, and audits, the requests next
+// serves without going through the gin router: the pulls and deletes
+// registry.Local handles itself
+func (s *Server) localRegistryHandler(keys *apikey.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event string
+		switch r.URL.Path {
+		case "/api/delete":
+			event = audit.EventDelete
+		case "/api/pull":
+			event = audit.EventPull
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, status, err := authorize(keys, r, apikey.Admin)
+		if err != nil {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="secllama"`)
+			}
+			writeError(w, status, err)
+			return
+		}
+
+		s.auditHandler(event, key, next).ServeHTTP(w, r)
+	})
+}
+
+// writeError writes err as a JSON error response, like gin's
+// AbortWithStatusJSON does for handlers outside the router
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(gin.H{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/security/apikey"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := apikey.Open(filepath.Join(t.TempDir(), "api_keys.json"))
+
+	r := gin.New()
+	r.Use(apiKeyMiddleware(keys))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/", ok)
+	r.GET("/api/tags", ok)
+	r.POST("/api/chat", ok)
+	r.POST("/api/pull", ok)
+	r.GET("/v1/models/:model", ok)
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// without keys, nothing is asked for
+	if code := do(http.MethodPost, "/api/pull", ""); code != http.StatusOK {
+		t.Fatalf("no keys: got %d", code)
+	}
+
+	tokens := make(map[apikey.Scope]string)
+	for _, scope := range []apikey.Scope{apikey.Read, apikey.Generate, apikey.Admin} {
+		token, _, err := keys.Create(string(scope), scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[scope] = token
+	}
+
+	cases := []struct {
+		method, path string
+		token        string
+		want         int
+	}{
+		{http.MethodGet, "/", "", http.StatusOK},
+		{http.MethodGet, "/api/tags", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/tags", "secllama_nope_nope", http.StatusUnauthorized},
+		{http.MethodGet, "/api/tags", tokens[apikey.Read], http.StatusOK},
+		{http.MethodGet, "/v1/models/llama", tokens[apikey.Read], http.StatusOK},
+		{http.MethodPost, "/api/chat", tokens[apikey.Read], http.StatusForbidden},
+		{http.MethodPost, "/api/chat", tokens[apikey.Generate], http.StatusOK},
+		{http.MethodPost, "/api/pull", tokens[apikey.Generate], http.StatusForbidden},
+		{http.MethodPost, "/api/pull", tokens[apikey.Admin], http.StatusOK},
+		{http.MethodGet, "/api/tags", tokens[apikey.Admin], http.StatusOK},
+		{http.MethodGet, "/missing", "", http.StatusUnauthorized},
+		{http.MethodGet, "/missing", tokens[apikey.Read], http.StatusNotFound},
+	}
+
+	for _, tt := range cases {
+		if code := do(tt.method, tt.path, tt.token); code != tt.want {
+			t.Errorf("%s %s with %q: got %d, want %d", tt.method, tt.path, tt.token, code, tt.want)
+		}
+	}
+
+	if _, err := keys.Revoke(string(apikey.Generate)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := do(http.MethodPost, "/api/chat", tokens[apikey.Generate]); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got %d", code)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/security/apikey"
+	"github.com/ollama/ollama/security/audit"
+	"github.com/ollama/ollama/types/model"
+)
+
+// openAuditLog opens the audit log named by SECLLAMA_AUDIT_LOG. Records are
+// sealed with the message encryption key, so without a key store there is no
+// audit log; that is logged rather than keeping the server from starting.
+func openAuditLog() *audit.Log {
+	path := envconfig.AuditLog()
+	if path == "" {
+		return nil
+	}
+
+	mgr, err := security.GetManager()
+	if err != nil {
+		slog.Error("audit log disabled: no encryption key available", "error", err)
+		return nil
+	}
+
+	l, err := audit.Open(path, mgr)
+	if err != nil {
+		slog.Error("audit log disabled", "path", path, "error", err)
+		return nil
+	}
+
+	slog.Info("audit log enabled", "path", path)
+	return l
+}
+
+// appendAudit appends r to the audit log, if there is one. Failing to record
+// an operation is logged but doesn't fail it.
+func appendAudit(l *audit.Log, r audit.Record, err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	if err := l.Append(r); err != nil {
+		slog.Error("failed to append to audit log", "event", r.Event, "error", err)
+	}
+}
+
+// auditRequest records a request that completed with err
+func (s *Server) auditRequest(c *gin.Context, r audit.Record, err error) {
+	r.Caller = requestCaller(c)
+	appendAudit(s.audit, r, err)
+}
+
+// requestCaller identifies who made a request: the uid and pid of the calling
+// process for requests over the Unix socket, the remote address otherwise,
+// and the ID of the API key it was made with, if any
+func requestCaller(c *gin.Context) string {
+	key, _ := c.Value(apiKeyContextKey).(*apikey.Key)
+	return callerOf(c.Request, key)
+}
+
+// callerOf is requestCaller for a request made with key, which may be nil
+func callerOf(r *http.Request, key *apikey.Key) string {
+	caller := r.RemoteAddr
+	if cred, ok := peerCredFromContext(r.Context()); ok {
+		caller = cred.String()
+	}
+
+	if name, ok := clientCertName(r); ok {
+		caller += " cert=" + name
+	}
+
+	if key != nil {
+		caller += " key=" + key.ID
+	}
+	return caller
+}
+
+// auditHandler records the request next serves as event, made with key. The
+// model is taken from the request body, and the error from the response.
+func (s *Server) auditHandler(event string, key *apikey.Key, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.audit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := audit.Record{Event: event, Caller: callerOf(r, key)}
+
+		// peek at the model name, leaving the body for next to read
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+		var req api.DeleteRequest
+		if json.Unmarshal(body, &req) == nil {
+			if n := model.ParseName(cmp.Or(req.Model, req.Name)); n.IsValid() {
+				rec.Model = n.DisplayShortest()
+				if event == audit.EventDelete {
+					rec.Digest = manifestDigest(n)
+				}
+			}
+		}
+
+		start := time.Now()
+		aw := &auditWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+
+		rec.Duration = time.Since(start)
+		if event == audit.EventPull && aw.err == "" && rec.Model != "" {
+			rec.Digest = manifestDigest(model.ParseName(rec.Model))
+		}
+		if aw.err == "" && aw.status >= http.StatusBadRequest {
+			aw.err = http.StatusText(aw.status)
+		}
+		if aw.err != "" {
+			rec.Error = aw.err
+		}
+		appendAudit(s.audit, rec, nil)
+	})
+}
+
+// auditWriter remembers the status of a response and the last error it
+// reported, as JSON {"error": ...} lines
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	err    string
+}
+
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	for line := range bytes.SplitSeq(b, []byte("\n")) {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(line, &resp) == nil && resp.Error != "" {
+			w.err = resp.Error
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// manifestDigest returns the digest of the manifest of model n, or "" if it
+// has none
+func manifestDigest(n model.Name) string {
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		return ""
+	}
+	return m.digest
+}
+
+// auditStream records r once the response stream ch ends, with the error the
+// stream ended with, if any. For generate and chat responses the token counts
+// are taken from the final response; prompts and output are never looked at.
+// Without a digest, r gets the digest of its model's manifest as it is when
+// the stream ends, e.g. after a pull.
+func (s *Server) auditStream(c *gin.Context, r audit.Record, ch chan any) chan any {
+	if s.audit == nil {
+		return ch
+	}
+
+	r.Caller = requestCaller(c)
+	start := time.Now()
+
+	out := make(chan any)
+	go func() {
+		defer close(out)
+		for v := range ch {
+			var metrics *api.Metrics
+			switch t := v.(type) {
+			case api.GenerateResponse:
+				metrics = &t.Metrics
+			case api.ChatResponse:
+				metrics = &t.Metrics
+			case gin.H:
+				if e, ok := t["error"].(string); ok {
+					r.Error = e
+				}
+			}
+
+			if metrics != nil && metrics.PromptEvalCount+metrics.EvalCount > 0 {
+				r.PromptTokens, r.EvalTokens = metrics.PromptEvalCount, metrics.EvalCount
+			}
+
+			// keep draining ch after the client went away, so the
+			// operation can finish and be recorded
+			select {
+			case out <- v:
+			case <-c.Request.Context().Done():
+			}
+		}
+
+		r.Duration = time.Since(start)
+		if r.Digest == "" && r.Error == "" {
+			r.Digest = manifestDigest(model.ParseName(r.Model))
+		}
+		appendAudit(s.audit, r, nil)
+	}()
+
+	return out
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/security/audit"
+)
+
+type auditTestCipher struct {
+	*security.MessageEncryptor
+}
+
+func (c auditTestCipher) EncryptMessage(plaintext string) (string, error) {
+	return c.EncryptString(plaintext)
+}
+
+func (c auditTestCipher) DecryptMessage(ciphertext string) (string, error) {
+	return c.DecryptString(ciphertext)
+}
+
+func TestAuditStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := security.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := security.NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher := auditTestCipher{e}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := audit.Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{audit: l}
+
+	stream := func(event string, responses ...any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/"+event, strings.NewReader(`{"prompt": "the secret question"}`))
+		c.Request.RemoteAddr = "192.0.2.1:1234"
+
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for _, r := range responses {
+				ch <- r
+			}
+		}()
+
+		// the record is written before the stream is closed
+		for range s.auditStream(c, audit.Record{Event: event, Model: "test", Digest: "sha256:abc"}, ch) {
+		}
+	}
+
+	stream(audit.EventGenerate,
+		api.GenerateResponse{Model: "test", Response: "the secret answer"},
+		api.GenerateResponse{Model: "test", Done: true, Metrics: api.Metrics{PromptEvalCount: 7, EvalCount: 3}},
+	)
+	stream(audit.EventChat, gin.H{"error": "model failed"})
+
+	var records []audit.Record
+	if err := audit.Read(path, cipher, func(r audit.Record, _ string) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	generate := records[0]
+	if generate.Event != audit.EventGenerate || generate.Digest != "sha256:abc" || generate.Caller != "192.0.2.1:1234" {
+		t.Errorf("unexpected record %+v", generate)
+	}
+	if generate.PromptTokens != 7 || generate.EvalTokens != 3 || generate.Error != "" {
+		t.Errorf("unexpected record %+v", generate)
+	}
+
+	if chat := records[1]; chat.Event != audit.EventChat || chat.Error != "model failed" {
+		t.Errorf("unexpected record %+v", chat)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"secret", "generate", "192.0.2.1"} {
+		if strings.Contains(string(data), plaintext) {
+			t.Errorf("audit log contains %q in plaintext", plaintext)
+		}
+	}
+}
+
+func TestLocalRegistryHandler(t *testing.T) {
+	key, err := security.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := security.NewMessageEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher := auditTestCipher{e}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := audit.Open(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{audit: l}
+
+	// registry.Local stand-in: it has no models
+	var served []string
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		served = append(served, r.URL.Path+" "+string(body))
+		if r.URL.Path == "/api/delete" {
+			writeError(w, http.StatusNotFound, errors.New("model not found"))
+		}
+	})
+
+	h := peerCredHandler(map[uint32]bool{1000: true}, s.localRegistryHandler(nil, local))
+
+	do := func(uid uint32, method, path, body string) int {
+		ctx := context.WithValue(t.Context(), peerCredKey{}, peerCred{cred: &security.PeerCred{UID: uid, PID: 42}})
+		req := httptest.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(1001, http.MethodPost, "/api/pull", `{"model": "llama3"}`); code != http.StatusForbidden {
+		t.Errorf("pull by another user: got %d, want 403", code)
+	}
+	if code := do(1000, http.MethodDelete, "/api/delete", `{"model": "llama3"}`); code != http.StatusNotFound {
+		t.Errorf("delete: got %d, want 404", code)
+	}
+	if code := do(1000, http.MethodGet, "/api/tags", ""); code != http.StatusOK {
+		t.Errorf("tags: got %d, want 200", code)
+	}
+
+	if want := []string{`/api/delete {"model": "llama3"}`, "/api/tags "}; !slices.Equal(served, want) {
+		t.Errorf("served %q, want %q", served, want)
+	}
+
+	var records []audit.Record
+	if err := audit.Read(path, cipher, func(r audit.Record, _ string) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %+v", records)
+	}
+	if r := records[0]; r.Event != audit.EventDelete || r.Model != "llama3:latest" || r.Error != "model not found" || !strings.HasPrefix(r.Caller, "uid=1000") {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// A bundle is a tar archive of one or more models for moving them to machines
+// without network access. Its first entry is index.json, listing every model
+// with its manifest and every blob with its digest and size, followed by one
+// blobs/sha256-<hex> entry per blob. Layers shared between models are stored
+// once. Since the index comes first, a bundle can be imported as it streams in.
+// Manifest signatures travel with their models.
+const (
+	bundleVersion   = 1
+	bundleIndexName = "index.json"
+	bundleBlobsDir  = "blobs/"
+)
+
+var errInvalidBundle = errors.New("invalid bundle")
+
+type bundleIndex struct {
+	Version int           `json:"version"`
+	Models  []bundleModel `json:"models"`
+	Blobs   []bundleBlob  `json:"blobs"`
+}
+
+type bundleModel struct {
+	Name       string              `json:"name"`
+	Manifest   Manifest            `json:"manifest"`
+	Signatures []ManifestSignature `json:"signatures,omitempty"`
+}
+
+type bundleBlob struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+func bundleBlobName(digest string) string {
+	return bundleBlobsDir + strings.ReplaceAll(digest, ":", "-")
+}
+
+// bundleProgress reports the bytes written through it for one blob
+type bundleProgress struct {
+	status    string
+	digest    string
+	total     int64
+	completed int64
+	fn        func(api.ProgressResponse)
+}
+
+func (w *bundleProgress) Write(b []byte) (int, error) {
+	w.completed += int64(len(b))
+	w.fn(api.ProgressResponse{Status: w.status, Digest: w.digest, Total: w.total, Completed: w.completed})
+	return len(b), nil
+}
+
+// ExportBundle writes the models names to w as a bundle. Every blob is hashed
+// as it is written and the export fails if any doesn't match its digest.
+func ExportBundle(w io.Writer, names []model.Name, fn func(api.ProgressResponse)) error {
+	index := bundleIndex{Version: bundleVersion}
+	seen := make(map[string]bool)
+	for _, n := range names {
+		n, err := getExistingName(n)
+		if err != nil {
+			return err
+		}
+
+		m, err := ParseNamedManifest(n)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("model %q not found", n.DisplayShortest())
+		} else if err != nil {
+			return err
+		}
+
+		digest, err := m.signingDigest()
+		if err != nil {
+			return err
+		}
+
+		sigs, err := readSignatures(digest)
+		if err != nil {
+			return err
+		}
+
+		index.Models = append(index.Models, bundleModel{Name: n.String(), Manifest: *m, Signatures: sigs})
+
+		for _, layer := range append([]Layer{m.Config}, m.Layers...) {
+			if layer.Digest == "" || seen[layer.Digest] {
+				continue
+			}
+			seen[layer.Digest] = true
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return err
+			}
+
+			fi, err := os.Stat(p)
+			if err != nil {
+				return err
+			}
+
+			index.Blobs = append(index.Blobs, bundleBlob{Digest: layer.Digest, Size: fi.Size()})
+		}
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: bundleIndexName, Mode: 0o644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, blob := range index.Blobs {
+		if err := exportBlob(tw, blob, fn); err != nil {
+			return err
+		}
+	}
+
+	fn(api.ProgressResponse{Status: "success"})
+	return tw.Close()
+}
+
+func exportBlob(tw *tar.Writer, blob bundleBlob, fn func(api.ProgressResponse)) error {
+	p, err := GetBlobsPath(blob.Digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: bundleBlobName(blob.Digest), Mode: 0o644, Size: blob.Size}); err != nil {
+		return err
+	}
+
+	sha256sum := sha256.New()
+	pw := &bundleProgress{status: "exporting", digest: blob.Digest, total: blob.Size, fn: fn}
+	if _, err := io.Copy(io.MultiWriter(tw, sha256sum, pw), f); err != nil {
+		return err
+	}
+
+	if got := fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)); got != blob.Digest {
+		return fmt.Errorf("blob %s is corrupt: its content has digest %s", blob.Digest, got)
+	}
+
+	return nil
+}
+
+// ImportBundle reads a bundle from r and adds its models. Each blob is checked
+// against its SHA-256 digest before it is moved into the blobs directory, and
+// manifests are only written once every blob of the bundle has been verified,
+// so a corrupt or truncated bundle adds no models. Blobs that already exist
+// are kept as they are.
+func ImportBundle(r io.Reader, fn func(api.ProgressResponse)) ([]model.Name, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidBundle, err)
+	} else if hdr.Name != bundleIndexName {
+		return nil, fmt.Errorf("%w: expected %s, got %q", errInvalidBundle, bundleIndexName, hdr.Name)
+	}
+
+	var index bundleIndex
+	if err := json.NewDecoder(tr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidBundle, bundleIndexName, err)
+	}
+
+	if index.Version != bundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errInvalidBundle, index.Version)
+	}
+
+	blobs := make(map[string]int64)
+	for _, blob := range index.Blobs {
+		if _, err := GetBlobsPath(blob.Digest); err != nil || blob.Digest == "" {
+			return nil, fmt.Errorf("%w: invalid blob digest %q", errInvalidBundle, blob.Digest)
+		}
+		blobs[blob.Digest] = blob.Size
+	}
+
+	names := make([]model.Name, len(index.Models))
+	for i, m := range index.Models {
+		names[i] = model.ParseName(m.Name)
+		if !names[i].IsFullyQualified() {
+			return nil, fmt.Errorf("%w: invalid model name %q", errInvalidBundle, m.Name)
+		}
+
+		for _, layer := range append([]Layer{m.Manifest.Config}, m.Manifest.Layers...) {
+			if _, ok := blobs[layer.Digest]; !ok && layer.Digest != "" {
+				return nil, fmt.Errorf("%w: %s: layer %s is not in the bundle", errInvalidBundle, m.Name, layer.Digest)
+			}
+		}
+
+		digest, err := m.Manifest.signingDigest()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sig := range m.Signatures {
+			if _, err := sig.verify(digest); err != nil {
+				return nil, fmt.Errorf("%w: %s: invalid signature: %v", errInvalidBundle, m.Name, err)
+			}
+		}
+	}
+
+	imported := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidBundle, err)
+		}
+
+		digest := strings.Replace(strings.TrimPrefix(hdr.Name, bundleBlobsDir), "-", ":", 1)
+		size, ok := blobs[digest]
+		switch {
+		case !ok || bundleBlobName(digest) != hdr.Name:
+			return nil, fmt.Errorf("%w: unexpected entry %q", errInvalidBundle, hdr.Name)
+		case imported[digest]:
+			return nil, fmt.Errorf("%w: duplicate blob %s", errInvalidBundle, digest)
+		case hdr.Size != size:
+			return nil, fmt.Errorf("%w: blob %s has size %d, index says %d", errInvalidBundle, digest, hdr.Size, size)
+		}
+
+		if err := importBlob(tr, digest, size, fn); err != nil {
+			return nil, err
+		}
+		imported[digest] = true
+	}
+
+	for digest := range blobs {
+		if !imported[digest] {
+			return nil, fmt.Errorf("%w: blob %s is missing", errInvalidBundle, digest)
+		}
+	}
+
+	for i, m := range index.Models {
+		fn(api.ProgressResponse{Status: "writing manifest for " + names[i].DisplayShortest()})
+		if err := WriteManifest(names[i], m.Manifest.Config, m.Manifest.Layers); err != nil {
+			return nil, err
+		}
+
+		if len(m.Signatures) > 0 {
+			digest, err := m.Manifest.signingDigest()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := addSignatures(digest, m.Signatures...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fn(api.ProgressResponse{Status: "success"})
+	return names, nil
+}
+
+// importBlob writes the blob digest from r to the blobs directory if it
+// doesn't exist yet, verifying its digest first
+func importBlob(r io.Reader, digest string, size int64, fn func(api.ProgressResponse)) error {
+	pw := &bundleProgress{status: "importing", digest: digest, total: size, fn: fn}
+
+	blob, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(blob); err == nil {
+		_, err := io.Copy(pw, r)
+		return err
+	}
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(blobs, "sha256-")
+	if err != nil {
+		return err
+	}
+	defer temp.Close()
+	defer os.Remove(temp.Name())
+
+	sha256sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(temp, sha256sum, pw), r); err != nil {
+		return fmt.Errorf("%w: blob %s: %v", errInvalidBundle, digest, err)
+	}
+
+	if got := fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)); got != digest {
+		return fmt.Errorf("%w: blob %s does not match its digest (got %s)", errInvalidBundle, digest, got)
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), blob); err != nil {
+		return err
+	}
+
+	return os.Chmod(blob, 0o644)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestBundle(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	for _, req := range []api.CreateRequest{
+		{Model: "a", Files: map[string]string{"test.gguf": digest}},
+		{Model: "b", Files: map[string]string{"test.gguf": digest}, System: "bundled system prompt"},
+	} {
+		if w := createRequest(t, s.CreateHandler, req); w.Code != http.StatusOK {
+			t.Fatalf("create %s: %d %s", req.Model, w.Code, w.Body.String())
+		}
+	}
+
+	var bundle bytes.Buffer
+	names := []model.Name{model.ParseName("a"), model.ParseName("b")}
+	if err := ExportBundle(&bundle, names, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the gguf layer is shared: two configs, one gguf, one system prompt
+	var entries []string
+	tr := tar.NewReader(bytes.NewReader(bundle.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, hdr.Name)
+	}
+
+	if len(entries) != 5 || entries[0] != bundleIndexName {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	t.Run("import", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+		imported, err := ImportBundle(bytes.NewReader(bundle.Bytes()), func(api.ProgressResponse) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(imported) != 2 {
+			t.Fatalf("expected 2 models, got %v", imported)
+		}
+
+		for _, n := range imported {
+			m, err := ParseNamedManifest(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, layer := range append(m.Layers, m.Config) {
+				if err := verifyBlob(layer.Digest); err != nil {
+					t.Errorf("%s: %v", n, err)
+				}
+			}
+		}
+	})
+
+	cases := map[string][]byte{
+		"tampered":  bytes.Replace(bundle.Bytes(), []byte("bundled system prompt"), []byte("tampered system prompt"[:21]), 1),
+		"truncated": bundle.Bytes()[:bundle.Len()/2],
+		"not a bundle": func() []byte {
+			var b bytes.Buffer
+			tw := tar.NewWriter(&b)
+			tw.WriteHeader(&tar.Header{Name: "../../etc/passwd", Size: 1})
+			tw.Write([]byte("x"))
+			tw.Close()
+			return b.Bytes()
+		}(),
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+			if _, err := ImportBundle(bytes.NewReader(data), func(api.ProgressResponse) {}); !errors.Is(err, errInvalidBundle) {
+				t.Fatalf("expected errInvalidBundle, got %v", err)
+			}
+
+			ms, err := Manifests(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ms) > 0 {
+				t.Errorf("expected no models, got %d", len(ms))
+			}
+		})
+	}
+}
+
+func TestExportBundleNotFound(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	err := ExportBundle(io.Discard, []model.Name{model.ParseName("missing")}, func(api.ProgressResponse) {})
+	if err == nil || err.Error() != `model "missing:latest" not found` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/security/audit"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/types/errtypes"
 	"github.com/ollama/ollama/types/model"
@@ -243,6 +244,7 @@ func (s *Server) CreateHandler(c *gin.Context) {
 
 		ch <- api.ProgressResponse{Status: "success"}
 	}()
+	ch = s.auditStream(c, audit.Record{Event: audit.EventCreate, Model: name.DisplayShortest()}, ch)
 
 	if r.Stream != nil && !*r.Stream {
 		waitForStream(c, ch)
@@ -490,14 +492,14 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 	}
 
 	if r.Template != "" {
-		layers, err = setTemplate(layers, r.Template)
+		layers, err = setTemplate(layers, r.Template, r.EncryptLayers)
 		if err != nil {
 			return err
 		}
 	}
 
 	if r.System != "" {
-		layers, err = setSystem(layers, r.System)
+		layers, err = setSystem(layers, r.System, r.EncryptLayers)
 		if err != nil {
 			return err
 		}
@@ -529,16 +531,23 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 		}
 	}
 
-	layers, err = setParameters(layers, r.Parameters)
+	layers, err = setParameters(layers, r.Parameters, r.EncryptLayers)
 	if err != nil {
 		return err
 	}
 
-	layers, err = setMessages(layers, r.Messages)
+	layers, err = setMessages(layers, r.Messages, r.EncryptLayers)
 	if err != nil {
 		return err
 	}
 
+	if r.EncryptLayers {
+		layers, err = encryptLayers(layers)
+		if err != nil {
+			return err
+		}
+	}
+
 	configLayer, err := createConfigLayer(layers, *config)
 	if err != nil {
 		return err
@@ -660,9 +669,11 @@ func ggufLayers(digest string, fn func(resp api.ProgressResponse)) ([]*layerGGML
 	return detectChatTemplate(layers)
 }
 
+// removeLayer removes the layers with media type mediatype from layers,
+// whether encrypted or not
 func removeLayer(layers []Layer, mediatype string) []Layer {
 	return slices.DeleteFunc(layers, func(layer Layer) bool {
-		if layer.MediaType != mediatype {
+		if plaintextMediaType(layer.MediaType) != mediatype {
 			return false
 		}
 
@@ -675,7 +686,7 @@ func removeLayer(layers []Layer, mediatype string) []Layer {
 	})
 }
 
-func setTemplate(layers []Layer, t string) ([]Layer, error) {
+func setTemplate(layers []Layer, t string, encrypt bool) ([]Layer, error) {
 	layers = removeLayer(layers, "application/vnd.ollama.image.template")
 	if _, err := template.Parse(t); err != nil {
 		return nil, fmt.Errorf("%w: %s", errBadTemplate, err)
@@ -684,8 +695,7 @@ func setTemplate(layers []Layer, t string) ([]Layer, error) {
 		return nil, fmt.Errorf("%w: %s", errBadTemplate, err)
 	}
 
-	blob := strings.NewReader(t)
-	layer, err := NewLayer(blob, "application/vnd.ollama.image.template")
+	layer, err := newModelfileLayer([]byte(t), "application/vnd.ollama.image.template", encrypt)
 	if err != nil {
 		return nil, err
 	}
@@ -694,11 +704,10 @@ func setTemplate(layers []Layer, t string) ([]Layer, error) {
 	return layers, nil
 }
 
-func setSystem(layers []Layer, s string) ([]Layer, error) {
+func setSystem(layers []Layer, s string, encrypt bool) ([]Layer, error) {
 	layers = removeLayer(layers, "application/vnd.ollama.image.system")
 	if s != "" {
-		blob := strings.NewReader(s)
-		layer, err := NewLayer(blob, "application/vnd.ollama.image.system")
+		layer, err := newModelfileLayer([]byte(s), "application/vnd.ollama.image.system", encrypt)
 		if err != nil {
 			return nil, err
 		}
@@ -717,28 +726,25 @@ func setLicense(layers []Layer, l string) ([]Layer, error) {
 	return layers, nil
 }
 
-func setParameters(layers []Layer, p map[string]any) ([]Layer, error) {
+func setParameters(layers []Layer, p map[string]any, encrypt bool) ([]Layer, error) {
 	if p == nil {
 		p = make(map[string]any)
 	}
 	for _, layer := range layers {
-		if layer.MediaType != "application/vnd.ollama.image.params" {
+		if plaintextMediaType(layer.MediaType) != "application/vnd.ollama.image.params" {
 			continue
 		}
 
-		digestPath, err := GetBlobsPath(layer.Digest)
-		if err != nil {
-			return nil, err
-		}
+		// parameters inherited encrypted stay encrypted
+		encrypt = encrypt || isEncrypted(layer.MediaType)
 
-		fn, err := os.Open(digestPath)
+		data, err := readLayer(layer)
 		if err != nil {
 			return nil, err
 		}
-		defer fn.Close()
 
 		var existing map[string]any
-		if err := json.NewDecoder(fn).Decode(&existing); err != nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
 			return nil, err
 		}
 
@@ -760,7 +766,7 @@ func setParameters(layers []Layer, p map[string]any) ([]Layer, error) {
 	if err := json.NewEncoder(&b).Encode(p); err != nil {
 		return nil, err
 	}
-	layer, err := NewLayer(&b, "application/vnd.ollama.image.params")
+	layer, err := newModelfileLayer(b.Bytes(), "application/vnd.ollama.image.params", encrypt)
 	if err != nil {
 		return nil, err
 	}
@@ -768,7 +774,7 @@ func setParameters(layers []Layer, p map[string]any) ([]Layer, error) {
 	return layers, nil
 }
 
-func setMessages(layers []Layer, m []api.Message) ([]Layer, error) {
+func setMessages(layers []Layer, m []api.Message, encrypt bool) ([]Layer, error) {
 	// this leaves the old messages intact if no new messages were specified
 	// which may not be the correct behaviour
 	if len(m) == 0 {
@@ -781,7 +787,7 @@ func setMessages(layers []Layer, m []api.Message) ([]Layer, error) {
 	if err := json.NewEncoder(&b).Encode(m); err != nil {
 		return nil, err
 	}
-	layer, err := NewLayer(&b, "application/vnd.ollama.image.messages")
+	layer, err := newModelfileLayer(b.Bytes(), "application/vnd.ollama.image.messages", encrypt)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+// Layers holding the parts of a Modelfile that tend to be proprietary can be
+// stored encrypted with the message encryption key. An encrypted layer has
+// the media type of its plaintext with encryptedSuffix appended, and its blob
+// holds the ciphertext, so the plaintext never reaches the blobs directory.
+// GetModel decrypts them as it reads the model.
+const encryptedSuffix = "+encrypted"
+
+// encryptedPlaceholder is shown in place of the content of encrypted layers
+// to callers who may not read it
+const encryptedPlaceholder = "[encrypted]"
+
+// encryptableMediaTypes are the media types of layers --encrypt-layers
+// encrypts
+var encryptableMediaTypes = []string{
+	"application/vnd.ollama.image.template",
+	"application/vnd.ollama.image.system",
+	"application/vnd.ollama.image.params",
+	"application/vnd.ollama.image.messages",
+}
+
+func init() {
+	security.RegisterReEncrypter("layers", func(m *security.Manager) error {
+		return reEncryptLayers(m.ReEncryptMessage)
+	})
+	security.RegisterEncryptedStore("layers", func() bool {
+		ms, err := Manifests(true)
+		if err != nil {
+			return false
+		}
+		for _, m := range ms {
+			if slices.ContainsFunc(m.Layers, func(l Layer) bool { return isEncrypted(l.MediaType) }) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func isEncrypted(mediatype string) bool {
+	return strings.HasSuffix(mediatype, encryptedSuffix)
+}
+
+// plaintextMediaType returns the media type of the content of a layer with
+// media type mediatype, once decrypted
+func plaintextMediaType(mediatype string) string {
+	return strings.TrimSuffix(mediatype, encryptedSuffix)
+}
+
+// layerCipher returns the manager whose key encrypted layers are sealed with
+func layerCipher() (*security.Manager, error) {
+	mgr, err := security.GetManager()
+	if err != nil {
+		return nil, err
+	} else if mgr == nil {
+		return nil, errors.New("no encryption key available")
+	}
+
+	return mgr, nil
+}
+
+// newModelfileLayer creates a layer with media type mediatype holding data,
+// encrypted if encrypt is set
+func newModelfileLayer(data []byte, mediatype string, encrypt bool) (Layer, error) {
+	if !encrypt {
+		return NewLayer(bytes.NewReader(data), mediatype)
+	}
+
+	mgr, err := layerCipher()
+	if err != nil {
+		return Layer{}, fmt.Errorf("encrypting layer: %w", err)
+	}
+
+	ciphertext, err := mgr.EncryptMessageBytes(data)
+	if err != nil {
+		return Layer{}, fmt.Errorf("encrypting layer: %w", err)
+	}
+
+	return NewLayer(strings.NewReader(ciphertext), mediatype+encryptedSuffix)
+}
+
+// readLayer returns the content of layer l, decrypting it if it is encrypted
+func readLayer(l Layer) ([]byte, error) {
+	p, err := GetBlobsPath(l.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil || !isEncrypted(l.MediaType) {
+		return data, err
+	}
+
+	mgr, err := layerCipher()
+	if err != nil {
+		return nil, fmt.Errorf("decrypting layer %s: %w", l.Digest, err)
+	}
+
+	plaintext, err := mgr.DecryptMessageBytes(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting layer %s: %w", l.Digest, err)
+	}
+
+	return plaintext, nil
+}
+
+// encryptLayers replaces the plaintext layers of layers that --encrypt-layers
+// covers, such as those inherited from a base model, with encrypted ones
+func encryptLayers(layers []Layer) ([]Layer, error) {
+	for i, layer := range layers {
+		if !slices.Contains(encryptableMediaTypes, layer.MediaType) {
+			continue
+		}
+
+		data, err := readLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted, err := newModelfileLayer(data, layer.MediaType, true)
+		if err != nil {
+			return nil, err
+		}
+
+		// the plaintext blob stays if another model still uses it
+		if err := layer.Remove(); err != nil {
+			slog.Warn("couldn't remove blob", "digest", layer.Digest, "error", err)
+		}
+
+		layers[i] = encrypted
+	}
+
+	return layers, nil
+}
+
+// canReadEncryptedLayers reports whether the caller of c may see the content
+// of encrypted layers through the API. Only the user running the server,
+// who holds the key anyway, may, and only over the Unix socket where the
+// caller can be identified.
+func canReadEncryptedLayers(c *gin.Context) bool {
+	cred, ok := peerCredFromContext(c.Request.Context())
+	return ok && cred.UID == uint32(os.Getuid())
+}
+
+// redactEncrypted replaces the parts of m read from encrypted layers with
+// encryptedPlaceholder. Parameters and messages are dropped instead.
+func (m *Model) redactEncrypted() {
+	for _, mediatype := range m.encrypted {
+		switch mediatype {
+		case "application/vnd.ollama.image.template":
+			m.Template, _ = template.Parse(encryptedPlaceholder)
+		case "application/vnd.ollama.image.system":
+			m.System = encryptedPlaceholder
+		case "application/vnd.ollama.image.params":
+			m.Options = nil
+		case "application/vnd.ollama.image.messages":
+			m.Messages = nil
+		}
+	}
+}
+
+// reEncryptLayers replaces the ciphertext of every encrypted layer with what
+// reEncrypt returns for it. Since a layer's digest is that of its ciphertext,
+// re-encrypted layers are new blobs: the manifests using them are rewritten
+// and the old blobs removed. Models that were signed need to be signed again.
+func reEncryptLayers(reEncrypt func(string) (string, error)) error {
+	ms, err := Manifests(true)
+	if err != nil {
+		return err
+	}
+
+	reEncrypted := make(map[string]Layer)
+	for n, m := range ms {
+		if !slices.ContainsFunc(m.Layers, func(l Layer) bool { return isEncrypted(l.MediaType) }) {
+			continue
+		}
+
+		var changed bool
+		layers := slices.Clone(m.Layers)
+		for i, layer := range layers {
+			if !isEncrypted(layer.MediaType) {
+				continue
+			}
+
+			if l, ok := reEncrypted[layer.Digest]; ok {
+				layers[i] = l
+				changed = true
+				continue
+			}
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return err
+			}
+
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+
+			ciphertext, err := reEncrypt(string(data))
+			if err != nil {
+				return fmt.Errorf("%s: layer %s: %w", n.DisplayShortest(), layer.Digest, err)
+			} else if ciphertext == string(data) {
+				// already sealed with the active key
+				continue
+			}
+
+			layers[i], err = NewLayer(strings.NewReader(ciphertext), layer.MediaType)
+			if err != nil {
+				return err
+			}
+			reEncrypted[layer.Digest] = layers[i]
+			changed = true
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := rewriteManifest(n, m, layers); err != nil {
+			return fmt.Errorf("%s: %w", n.DisplayShortest(), err)
+		}
+	}
+
+	for digest := range reEncrypted {
+		l := Layer{Digest: digest}
+		if err := l.Remove(); err != nil {
+			slog.Warn("couldn't remove blob", "digest", digest, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// rewriteManifest writes the manifest of model n with layers in place of
+// those of m, updating its config to match
+func rewriteManifest(n model.Name, m *Manifest, layers []Layer) error {
+	var config ConfigV2
+	if m.Config.Digest != "" {
+		p, err := GetBlobsPath(m.Config.Digest)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			return err
+		}
+	}
+
+	configLayer, err := createConfigLayer(layers, config)
+	if err != nil {
+		return err
+	}
+
+	if digest, err := m.signingDigest(); err == nil {
+		if sigs, _ := readSignatures(digest); len(sigs) > 0 {
+			slog.Warn("re-encrypting layers invalidates the signatures of the model, sign it again", "model", n.DisplayShortest())
+		}
+	}
+
+	if err := WriteManifest(n, *configLayer, layers); err != nil {
+		return err
+	}
+
+	if m.Config.Digest != configLayer.Digest {
+		if err := m.Config.Remove(); err != nil {
+			slog.Warn("couldn't remove blob", "digest", m.Config.Digest, "error", err)
+		}
+	}
+
+	return nil
+}
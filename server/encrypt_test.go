@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestEncryptLayers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SECLLAMA_KEYSTORE", "file")
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE", "correct horse battery staple")
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:         "secret",
+		Files:         map[string]string{"test.gguf": digest},
+		Template:      "{{ .System }} secret template {{ .Prompt }}",
+		System:        "secret system prompt",
+		Parameters:    map[string]any{"stop": []string{"secret stop"}},
+		Messages:      []api.Message{{Role: "user", Content: "secret example"}},
+		EncryptLayers: true,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	// inherits the encrypted layers, replacing the parameters
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:      "derived",
+		From:       "secret",
+		Parameters: map[string]any{"temperature": 0.5},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	assertNoPlaintext := func(t *testing.T) {
+		t.Helper()
+		blobs, err := GetBlobsPath("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(blobs, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("secret")) {
+				t.Errorf("blob %s holds plaintext: %q", e.Name(), data)
+			}
+		}
+	}
+
+	assertDecrypted := func(t *testing.T, name string) {
+		t.Helper()
+		m := mustGetModel(t, name)
+		if m.System != "secret system prompt" {
+			t.Errorf("expected decrypted system prompt, got %q", m.System)
+		}
+		if m.Template.String() != "{{ .System }} secret template {{ .Prompt }}" {
+			t.Errorf("expected decrypted template, got %q", m.Template.String())
+		}
+		if len(m.Messages) != 1 || m.Messages[0].Content != "secret example" {
+			t.Errorf("expected decrypted messages, got %v", m.Messages)
+		}
+		if _, ok := m.Options["stop"]; !ok {
+			t.Errorf("expected decrypted parameters, got %v", m.Options)
+		}
+		if len(m.encrypted) != 4 {
+			t.Errorf("expected 4 encrypted layers, got %v", m.encrypted)
+		}
+	}
+
+	assertNoPlaintext(t)
+	assertDecrypted(t, "secret")
+	assertDecrypted(t, "derived")
+
+	t.Run("show", func(t *testing.T) {
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: "secret"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("show: %d %s", w.Code, w.Body.String())
+		}
+
+		if bytes.Contains(w.Body.Bytes(), []byte("secret ")) {
+			t.Fatalf("show revealed encrypted layers: %s", w.Body.String())
+		}
+
+		resp, err := GetModelInfo(api.ShowRequest{Model: "secret"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.System != encryptedPlaceholder || resp.Template != encryptedPlaceholder || resp.Parameters != encryptedPlaceholder || len(resp.Messages) > 0 {
+			t.Errorf("expected redacted layers, got %+v", resp)
+		}
+
+		resp, err = GetModelInfo(api.ShowRequest{Model: "secret"}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.System != "secret system prompt" {
+			t.Errorf("expected decrypted system prompt, got %q", resp.System)
+		}
+	})
+
+	t.Run("re-encrypt", func(t *testing.T) {
+		before, err := ParseNamedManifest(model.ParseName("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mgr, err := security.GetManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the key isn't rotated, but sealing again gives new ciphertext
+		if err := reEncryptLayers(func(ciphertext string) (string, error) {
+			plaintext, err := mgr.DecryptMessage(ciphertext)
+			if err != nil {
+				return "", err
+			}
+			return mgr.EncryptMessage(plaintext)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := ParseNamedManifest(model.ParseName("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, layer := range before.Layers {
+			if !isEncrypted(layer.MediaType) {
+				continue
+			}
+
+			if slices.ContainsFunc(after.Layers, func(l Layer) bool { return l.Digest == layer.Digest }) {
+				t.Errorf("layer %s was not re-encrypted", layer.Digest)
+			}
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(p); err == nil {
+				t.Errorf("old blob %s was kept", layer.Digest)
+			}
+		}
+
+		assertNoPlaintext(t)
+		assertDecrypted(t, "secret")
+		assertDecrypted(t, "derived")
+	})
+}
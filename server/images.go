@@ -26,6 +26,7 @@ import (
 	"github.com/ollama/ollama/fs/gguf"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/parser"
+	"github.com/ollama/ollama/security"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/thinking"
 	"github.com/ollama/ollama/types/model"
@@ -67,6 +68,14 @@ type Model struct {
 	Messages       []api.Message
 
 	Template *template.Template
+
+	// signingDigest is the digest of the manifest the model was read from
+	// that its signatures are made over
+	signingDigest string
+
+	// encrypted lists the plaintext media types of the layers of the model
+	// that are stored encrypted
+	encrypted []string
 }
 
 // Capabilities returns the capabilities that the model supports
@@ -331,6 +340,11 @@ func GetModel(name string) (*Model, error) {
 		Template:  template.DefaultTemplate,
 	}
 
+	model.signingDigest, err = manifest.signingDigest()
+	if err != nil {
+		return nil, err
+	}
+
 	if manifest.Config.Digest != "" {
 		filename, err := GetBlobsPath(manifest.Config.Digest)
 		if err != nil {
@@ -354,7 +368,12 @@ func GetModel(name string) (*Model, error) {
 			return nil, err
 		}
 
-		switch layer.MediaType {
+		mediatype := plaintextMediaType(layer.MediaType)
+		if isEncrypted(layer.MediaType) {
+			model.encrypted = append(model.encrypted, mediatype)
+		}
+
+		switch mediatype {
 		case "application/vnd.ollama.image.model":
 			model.ModelPath = filename
 			model.ParentModel = layer.From
@@ -368,7 +387,7 @@ func GetModel(name string) (*Model, error) {
 			model.ProjectorPaths = append(model.ProjectorPaths, filename)
 		case "application/vnd.ollama.image.prompt",
 			"application/vnd.ollama.image.template":
-			bts, err := os.ReadFile(filename)
+			bts, err := readLayer(layer)
 			if err != nil {
 				return nil, err
 			}
@@ -378,31 +397,29 @@ func GetModel(name string) (*Model, error) {
 				return nil, err
 			}
 		case "application/vnd.ollama.image.system":
-			bts, err := os.ReadFile(filename)
+			bts, err := readLayer(layer)
 			if err != nil {
 				return nil, err
 			}
 
 			model.System = string(bts)
 		case "application/vnd.ollama.image.params":
-			params, err := os.Open(filename)
+			bts, err := readLayer(layer)
 			if err != nil {
 				return nil, err
 			}
-			defer params.Close()
 
 			// parse model options parameters into a map so that we can see which fields have been specified explicitly
-			if err = json.NewDecoder(params).Decode(&model.Options); err != nil {
+			if err = json.Unmarshal(bts, &model.Options); err != nil {
 				return nil, err
 			}
 		case "application/vnd.ollama.image.messages":
-			msgs, err := os.Open(filename)
+			bts, err := readLayer(layer)
 			if err != nil {
 				return nil, err
 			}
-			defer msgs.Close()
 
-			if err = json.NewDecoder(msgs).Decode(&model.Messages); err != nil {
+			if err = json.Unmarshal(bts, &model.Messages); err != nil {
 				return nil, err
 			}
 		case "application/vnd.ollama.image.license":
@@ -817,6 +834,10 @@ func makeRequest(ctx context.Context, method string, requestURL *url.URL, header
 		requestURL.Scheme = "http"
 	}
 
+	if err := security.CheckOutbound(requestURL.Host); err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
 	if err != nil {
 		return nil, err
@@ -18,10 +18,18 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/ollama/ollama/security"
 	"github.com/ollama/ollama/server/internal/cache/blob"
 	"github.com/ollama/ollama/server/internal/testutil"
 )
 
+func TestMain(m *testing.M) {
+	// the tests talk to fake registries at hosts like example.com, which
+	// strict network isolation, on by default, refuses
+	os.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "false")
+	os.Exit(m.Run())
+}
+
 func ExampleRegistry_cancelOnFirstError() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -708,6 +716,16 @@ func TestPullManifestError(t *testing.T) {
 	}
 }
 
+func TestPullNetworkIsolated(t *testing.T) {
+	t.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "true")
+
+	rc, _ := newClient(t, nil)
+	err := rc.Pull(t.Context(), "http://o.com/library/abc")
+	if !errors.Is(err, security.ErrNetworkIsolated) {
+		t.Fatalf("err = %v, want %v", err, security.ErrNetworkIsolated)
+	}
+}
+
 func TestPullLayerError(t *testing.T) {
 	c, ctx := newRegistryClient(t, func(w http.ResponseWriter, r *http.Request) {
 		checkRequest(t, r, "GET", "/v2/library/abc/manifests/latest")
@@ -23,6 +23,13 @@ import (
 	_ "embed"
 )
 
+func TestMain(m *testing.M) {
+	// the tests talk to fake registries at hosts like example.com, which
+	// strict network isolation, on by default, refuses
+	os.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "false")
+	os.Exit(m.Run())
+}
+
 type panicTransport struct{}
 
 func (t *panicTransport) RoundTrip(r *http.Request) (*http.Response, error) {
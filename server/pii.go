@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/pii"
+)
+
+// headerRedactions reports what was redacted from a request, for clients of
+// the OpenAI-compatible routes whose responses have no field for it
+const headerRedactions = "X-Secllama-Redactions"
+
+// loadRedactor returns the redactor for chat and generate prompts, or nil if
+// PII redaction is off
+func loadRedactor() (*pii.Redactor, error) {
+	if !envconfig.PIIRedaction() {
+		return nil, nil
+	}
+
+	r, err := pii.Load(envconfig.PIIPatterns())
+	if err != nil {
+		return nil, fmt.Errorf("pii redaction: %w", err)
+	}
+
+	slog.Info("pii redaction enabled", "patterns", envconfig.PIIPatterns())
+	return r, nil
+}
+
+// piiMiddleware redacts personal data from the prompts of requests to
+// ChatHandler, or GenerateHandler if chat is false, and restores it in the
+// responses. The system prompt is left as it is. On the OpenAI-compatible
+// routes it must come after the middleware translating the request.
+func piiMiddleware(r *pii.Redactor, chat bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		s := r.NewSession()
+		var restore func([]byte) []byte
+		if chat {
+			body, restore = redactChat(s, body)
+		} else {
+			body, restore = redactGenerate(s, body)
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+
+		if restore == nil {
+			// the handler reports the malformed request
+			c.Next()
+			return
+		}
+
+		if stats := s.Stats(); stats != nil {
+			c.Header(headerRedactions, formatRedactions(stats))
+		}
+
+		w := &lineWriter{ResponseWriter: c.Writer, rewrite: restore}
+		c.Writer = w
+
+		c.Next()
+
+		w.flush()
+	}
+}
+
+// formatRedactions formats redaction stats as "kind=count" pairs, sorted by
+// kind
+func formatRedactions(stats map[string]int) string {
+	pairs := make([]string, 0, len(stats))
+	for kind, n := range stats {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", kind, n))
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func redactChat(s *pii.Session, body []byte) ([]byte, func([]byte) []byte) {
+	var req api.ChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body, nil
+	}
+
+	for i := range req.Messages {
+		if req.Messages[i].Role != "system" {
+			req.Messages[i].Content = s.Redact(req.Messages[i].Content)
+		}
+	}
+
+	redacted, err := json.Marshal(req)
+	if err != nil {
+		return body, nil
+	}
+
+	content, thinking := s.NewRestorer(), s.NewRestorer()
+	return redacted, func(line []byte) []byte {
+		var resp api.ChatResponse
+		if isErrorResponse(line) || json.Unmarshal(line, &resp) != nil {
+			return line
+		}
+
+		resp.Message.Content = content.Write(resp.Message.Content)
+		resp.Message.Thinking = thinking.Write(resp.Message.Thinking)
+		restoreToolCalls(s, resp.Message.ToolCalls)
+		if resp.Done {
+			resp.Message.Content += content.Flush()
+			resp.Message.Thinking += thinking.Flush()
+			resp.Redactions = s.Stats()
+		}
+
+		return marshalOr(resp, line)
+	}
+}
+
+func redactGenerate(s *pii.Session, body []byte) ([]byte, func([]byte) []byte) {
+	var req api.GenerateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return body, nil
+	}
+
+	req.Prompt = s.Redact(req.Prompt)
+	req.Suffix = s.Redact(req.Suffix)
+
+	redacted, err := json.Marshal(req)
+	if err != nil {
+		return body, nil
+	}
+
+	response, thinking := s.NewRestorer(), s.NewRestorer()
+	return redacted, func(line []byte) []byte {
+		var resp api.GenerateResponse
+		if isErrorResponse(line) || json.Unmarshal(line, &resp) != nil {
+			return line
+		}
+
+		resp.Response = response.Write(resp.Response)
+		resp.Thinking = thinking.Write(resp.Thinking)
+		restoreToolCalls(s, resp.ToolCalls)
+		if resp.Done {
+			resp.Response += response.Flush()
+			resp.Thinking += thinking.Flush()
+			resp.Redactions = s.Stats()
+		}
+
+		return marshalOr(resp, line)
+	}
+}
+
+// restoreToolCalls restores the placeholders in the string arguments of
+// calls. Tool calls arrive whole, so they need no Restorer.
+func restoreToolCalls(s *pii.Session, calls []api.ToolCall) {
+	var restore func(v any) any
+	restore = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return s.Restore(v)
+		case []any:
+			for i := range v {
+				v[i] = restore(v[i])
+			}
+		case map[string]any:
+			for k := range v {
+				v[k] = restore(v[k])
+			}
+		}
+		return v
+	}
+
+	for _, call := range calls {
+		for k, v := range call.Function.Arguments {
+			call.Function.Arguments[k] = restore(v)
+		}
+	}
+}
+
+func isErrorResponse(line []byte) bool {
+	var resp struct {
+		Error *string `json:"error"`
+	}
+	return json.Unmarshal(line, &resp) == nil && resp.Error != nil
+}
+
+func marshalOr(v any, fallback []byte) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		slog.Warn("failed to restore redacted response", "error", err)
+		return fallback
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/middleware"
+	"github.com/ollama/ollama/openai"
+	"github.com/ollama/ollama/security/pii"
+)
+
+// piiTestServer serves a fake /api/chat behind the PII middleware. It records
+// the messages that would reach the model and echoes the last one back a few
+// bytes at a time, so placeholders are split between chunks.
+func piiTestServer(t *testing.T) (*httptest.Server, *[]api.Message) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	redactor, err := pii.New(pii.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []api.Message
+	handler := func(c *gin.Context) {
+		var req api.ChatRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		seen = req.Messages
+
+		content := req.Messages[len(req.Messages)-1].Content
+		if req.Stream != nil && !*req.Stream {
+			c.JSON(http.StatusOK, api.ChatResponse{Model: req.Model, Message: api.Message{Role: "assistant", Content: content}, Done: true})
+			return
+		}
+
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for i := 0; i < len(content); i += 3 {
+				ch <- api.ChatResponse{Model: req.Model, Message: api.Message{Role: "assistant", Content: content[i:min(i+3, len(content))]}}
+			}
+			ch <- api.ChatResponse{
+				Model: req.Model,
+				Message: api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{
+					Function: api.ToolCallFunction{Name: "send", Arguments: api.ToolCallFunctionArguments{"to": "[EMAIL_1]"}},
+				}}},
+			}
+			ch <- api.ChatResponse{Model: req.Model, Done: true}
+		}()
+		streamResponse(c, ch)
+	}
+
+	r := gin.New()
+	r.POST("/api/chat", piiMiddleware(redactor, true), handler)
+	r.POST("/v1/chat/completions", middleware.ChatMiddleware(), piiMiddleware(redactor, true), handler)
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return ts, &seen
+}
+
+func postPII(t *testing.T, ts *httptest.Server, path string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+
+	resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%d %s", resp.StatusCode, b)
+	}
+
+	return resp, b
+}
+
+func TestPIIMiddleware(t *testing.T) {
+	ts, seen := piiTestServer(t)
+
+	prompt := "Email alice@example.com, cc alice@example.com, from 192.168.1.10"
+	messages := []api.Message{
+		{Role: "system", Content: "Admin is admin@example.com"},
+		{Role: "user", Content: prompt},
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		resp, body := postPII(t, ts, "/api/chat", mustMarshal(t, api.ChatRequest{Model: "test", Messages: messages}))
+
+		if got, want := (*seen)[1].Content, "Email [EMAIL_1], cc [EMAIL_1], from [IP_1]"; got != want {
+			t.Errorf("model saw %q, want %q", got, want)
+		}
+		if got := (*seen)[0].Content; got != messages[0].Content {
+			t.Errorf("system prompt was changed to %q", got)
+		}
+
+		var content strings.Builder
+		var last api.ChatResponse
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+				t.Fatal(err)
+			}
+			content.WriteString(last.Message.Content)
+
+			if calls := last.Message.ToolCalls; len(calls) > 0 && calls[0].Function.Arguments["to"] != "alice@example.com" {
+				t.Errorf("tool call arguments not restored: %v", calls[0].Function.Arguments)
+			}
+		}
+
+		if content.String() != prompt {
+			t.Errorf("got %q, want %q", content.String(), prompt)
+		}
+
+		if want := map[string]int{pii.Email: 2, pii.IP: 1}; !maps.Equal(last.Redactions, want) {
+			t.Errorf("redactions %v, want %v", last.Redactions, want)
+		}
+
+		if got := resp.Header.Get(headerRedactions); got != "email=2,ip=1" {
+			t.Errorf("unexpected %s header %q", headerRedactions, got)
+		}
+	})
+
+	t.Run("no stream", func(t *testing.T) {
+		_, body := postPII(t, ts, "/api/chat", mustMarshal(t, api.ChatRequest{Model: "test", Messages: messages, Stream: &stream}))
+
+		var resp api.ChatResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("%v: %s", err, body)
+		}
+
+		if resp.Message.Content != prompt {
+			t.Errorf("got %q, want %q", resp.Message.Content, prompt)
+		}
+	})
+
+	t.Run("openai", func(t *testing.T) {
+		resp, body := postPII(t, ts, "/v1/chat/completions", []byte(`{"model": "test", "stream": false, "messages": [{"role": "user", "content": "Reply to alice@example.com"}]}`))
+
+		if got := (*seen)[0].Content; got != "Reply to [EMAIL_1]" {
+			t.Errorf("model saw %q", got)
+		}
+
+		var completion openai.ChatCompletion
+		if err := json.Unmarshal(body, &completion); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := completion.Choices[0].Message.Content; got != "Reply to alice@example.com" {
+			t.Errorf("got %q", got)
+		}
+
+		if got := resp.Header.Get(headerRedactions); got != "email=1" {
+			t.Errorf("unexpected %s header %q", headerRedactions, got)
+		}
+	})
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/policy"
+)
+
+// doneReasonPolicy is the done_reason of responses the output policy aborted
+const doneReasonPolicy = "policy"
+
+// loadPolicy returns the output policy for chat and generate responses, or nil
+// if there is none
+func loadPolicy() (*policy.Engine, error) {
+	path := envconfig.OutputPolicy()
+	if path == "" {
+		return nil, nil
+	}
+
+	e, err := policy.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("output policy: %w", err)
+	}
+
+	if e != nil {
+		slog.Info("output policy enabled", "rules", path)
+	}
+	return e, nil
+}
+
+// policyMiddleware applies the output policy to the responses of ChatHandler,
+// or GenerateHandler if chat is false. Masked text is replaced as it streams.
+// A response the policy aborts ends with what came before the match, in a
+// final response with done_reason "policy", and generation is cancelled.
+// The metrics of the final response it cut off never come, so its eval_count
+// is the number of responses streamed, about a token each, for quotas to
+// count. On the OpenAI-compatible routes it must come after the middleware
+// translating the request, and before piiMiddleware so it sees what clients
+// will see.
+func policyMiddleware(e *policy.Engine, chat bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if e == nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		r := e.NewResponse()
+		abort := func() {
+			slog.Warn("output policy aborted response", "rule", r.Aborted(), "path", c.Request.URL.Path)
+			cancel()
+		}
+
+		var check func([]byte) []byte
+		if chat {
+			check = checkChat(r, abort)
+		} else {
+			check = checkGenerate(r, abort)
+		}
+
+		w := &lineWriter{ResponseWriter: c.Writer, rewrite: check}
+		c.Writer = w
+
+		c.Next()
+
+		w.flush()
+	}
+}
+
+func checkChat(r *policy.Response, abort func()) func([]byte) []byte {
+	content, thinking := r.NewStream(), r.NewStream()
+	var generated int
+	return func(line []byte) []byte {
+		if r.Aborted() != "" {
+			// drop the rest, including the error of the cancelled request
+			return nil
+		}
+
+		var resp api.ChatResponse
+		if isErrorResponse(line) || json.Unmarshal(line, &resp) != nil {
+			return line
+		}
+		generated++
+
+		resp.Message.Thinking = thinking.Write(resp.Message.Thinking)
+		resp.Message.Content = content.Write(resp.Message.Content)
+		if len(resp.Message.ToolCalls) > 0 {
+			// text doesn't continue across a tool call
+			resp.Message.Thinking += thinking.Flush()
+			resp.Message.Content += content.Flush()
+			checkToolCalls(r, resp.Message.ToolCalls)
+		}
+
+		if r.Aborted() != "" {
+			if !resp.Done {
+				resp.EvalCount = generated
+			}
+			resp.Message.ToolCalls = nil
+			resp.Done, resp.DoneReason = true, doneReasonPolicy
+			abort()
+		}
+
+		if resp.Done {
+			resp.Message.Thinking += thinking.Flush()
+			resp.Message.Content += content.Flush()
+			resp.PolicyMatches = r.Matches()
+		}
+
+		return marshalOr(resp, line)
+	}
+}
+
+func checkGenerate(r *policy.Response, abort func()) func([]byte) []byte {
+	response, thinking := r.NewStream(), r.NewStream()
+	var generated int
+	return func(line []byte) []byte {
+		if r.Aborted() != "" {
+			return nil
+		}
+
+		var resp api.GenerateResponse
+		if isErrorResponse(line) || json.Unmarshal(line, &resp) != nil {
+			return line
+		}
+		generated++
+
+		resp.Thinking = thinking.Write(resp.Thinking)
+		resp.Response = response.Write(resp.Response)
+		if len(resp.ToolCalls) > 0 {
+			resp.Thinking += thinking.Flush()
+			resp.Response += response.Flush()
+			checkToolCalls(r, resp.ToolCalls)
+		}
+
+		if r.Aborted() != "" {
+			if !resp.Done {
+				resp.EvalCount = generated
+			}
+			resp.ToolCalls = nil
+			// the context would continue past what was cut off
+			resp.Context = nil
+			resp.Done, resp.DoneReason = true, doneReasonPolicy
+			abort()
+		}
+
+		if resp.Done {
+			resp.Thinking += thinking.Flush()
+			resp.Response += response.Flush()
+			resp.PolicyMatches = r.Matches()
+		}
+
+		return marshalOr(resp, line)
+	}
+}
+
+// checkToolCalls applies the tool call rules to calls, masking them in place
+func checkToolCalls(r *policy.Response, calls []api.ToolCall) {
+	for i := range calls {
+		f := &calls[i].Function
+		f.Name = r.ToolCall(f.Name, f.Arguments)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/apikey"
+	"github.com/ollama/ollama/security/quota"
+)
+
+// loadLimits returns the limiter enforcing per-caller rate limits and token
+// quotas, or nil if there are none
+func loadLimits() (*quota.Limiter, error) {
+	path := envconfig.Limits()
+	if path == "" {
+		return nil, nil
+	}
+
+	l, err := quota.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+
+	if l != nil {
+		slog.Info("rate limits enabled", "path", path)
+	}
+	return l, nil
+}
+
+// limitCaller identifies who a request counts against: its API key, the uid
+// of the calling process over the Unix socket, its client certificate, or
+// else its remote address
+func limitCaller(c *gin.Context) string {
+	if key, ok := c.Value(apiKeyContextKey).(*apikey.Key); ok {
+		return "key:" + key.ID
+	}
+
+	if cred, ok := peerCredFromContext(c.Request.Context()); ok {
+		return fmt.Sprintf("uid:%d", cred.UID)
+	}
+
+	if name, ok := clientCertName(c.Request); ok {
+		return "cert:" + name
+	}
+
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// quotaMiddleware refuses requests over their caller's limits with 429 before
+// they reach the handler, and so before a model is scheduled. The prompt and
+// generated tokens of the response count against the caller's token quota
+// once it is done. On the OpenAI-compatible routes it must come after the
+// middleware translating the request, so it sees native responses.
+func quotaMiddleware(l *quota.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+
+		caller := limitCaller(c)
+		release, err := l.Acquire(caller)
+		var limitErr *quota.LimitError
+		if errors.As(err, &limitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer release()
+
+		var tokens int
+		w := &lineWriter{ResponseWriter: c.Writer, rewrite: func(line []byte) []byte {
+			var m api.Metrics
+			if json.Unmarshal(line, &m) == nil {
+				tokens += m.PromptEvalCount + m.EvalCount
+			}
+			return line
+		}}
+		c.Writer = w
+
+		c.Next()
+
+		w.flush()
+		l.Record(caller, tokens)
+	}
+}
+
+// UsageHandler reports usage against rate limits and token quotas: every
+// caller's to admin keys, and the caller's own to anyone else, including
+// every caller of a server without API keys
+func (s *Server) UsageHandler(c *gin.Context) {
+	resp := api.UsageResponse{Callers: []api.CallerUsage{}}
+	if s.limits == nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	var usage []quota.Usage
+	if key, ok := c.Value(apiKeyContextKey).(*apikey.Key); ok && key.Scope.Allows(apikey.Admin) {
+		usage = s.limits.All()
+	} else {
+		usage = []quota.Usage{s.limits.Usage(limitCaller(c))}
+	}
+
+	for _, u := range usage {
+		resp.Callers = append(resp.Callers, api.CallerUsage{
+			Caller:     u.Caller,
+			Requests:   u.Requests,
+			Concurrent: u.Concurrent,
+			Tokens:     u.Tokens,
+			Limits:     api.UsageLimits(u.Limits),
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
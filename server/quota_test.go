@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/security/apikey"
+	"github.com/ollama/ollama/security/quota"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{limits: quota.New(quota.Config{Default: quota.Limits{RequestsPerMinute: 3, TokensPerHour: 100}})}
+
+	r := gin.New()
+	r.POST("/api/generate", quotaMiddleware(s.limits), func(c *gin.Context) {
+		c.JSON(http.StatusOK, api.GenerateResponse{
+			Response: "hi",
+			Done:     true,
+			Metrics:  api.Metrics{PromptEvalCount: 40, EvalCount: 20},
+		})
+	})
+	r.GET("/api/usage", s.UsageHandler)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/generate"); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	w := do(http.MethodGet, "/api/usage")
+	var usage api.UsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+
+	want := api.CallerUsage{Caller: "addr:192.0.2.1", Requests: 1, Tokens: 60, Limits: api.UsageLimits{RequestsPerMinute: 3, TokensPerHour: 100}}
+	if len(usage.Callers) != 1 || usage.Callers[0] != want {
+		t.Errorf("got %+v, want %+v", usage.Callers, want)
+	}
+
+	// the second request takes the caller over its token quota
+	if w := do(http.MethodPost, "/api/generate"); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodPost, "/api/generate")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After %q", got)
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{limits: quota.New(quota.Config{Default: quota.Limits{RequestsPerMinute: 10}})}
+	for _, caller := range []string{"addr:192.0.2.1", "addr:192.0.2.2", "key:reader"} {
+		if _, err := s.limits.Acquire(caller); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		key  *apikey.Key
+		want []string
+	}{
+		{"no key", nil, []string{"addr:192.0.2.1"}},
+		{"read key", &apikey.Key{ID: "reader", Scope: apikey.Read}, []string{"key:reader"}},
+		{"admin key", &apikey.Key{ID: "admin", Scope: apikey.Admin}, []string{"addr:192.0.2.1", "addr:192.0.2.2", "key:reader"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/api/usage", func(c *gin.Context) {
+				if tt.key != nil {
+					c.Set(apiKeyContextKey, tt.key)
+				}
+			}, s.UsageHandler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage", nil))
+
+			var usage api.UsageResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, u := range usage.Callers {
+				got = append(got, u.Caller)
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lineWriter rewrites a response written as NDJSON lines, or as one JSON
+// object, a line at a time. A line rewritten to nil is dropped.
+type lineWriter struct {
+	gin.ResponseWriter
+	rewrite func([]byte) []byte
+	buf     []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	// rewriting changes the length of the body
+	w.Header().Del("Content-Length")
+
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := w.rewrite(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if line == nil {
+			continue
+		}
+
+		if _, err := w.ResponseWriter.Write(slices.Concat(line, []byte{'\n'})); err != nil {
+			return 0, err
+		}
+	}
+
+	// a response written in one piece has no trailing newline
+	if len(w.buf) > 0 && json.Valid(w.buf) {
+		line := w.rewrite(w.buf)
+		w.buf = nil
+		if line != nil {
+			if _, err := w.ResponseWriter.Write(line); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(b), nil
+}
+
+func (w *lineWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// flush writes whatever is left once the handler is done. It isn't JSON, so
+// is passed on as it is.
+func (w *lineWriter) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+
+	if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+	w.buf = nil
+}
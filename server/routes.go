@@ -40,6 +40,10 @@ import (
 	"github.com/ollama/ollama/middleware"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/model/renderers"
+	"github.com/ollama/ollama/security"
+	"github.com/ollama/ollama/security/audit"
+	"github.com/ollama/ollama/security/quota"
+	"github.com/ollama/ollama/security/session"
 	"github.com/ollama/ollama/server/internal/client/ollama"
 	"github.com/ollama/ollama/server/internal/registry"
 	"github.com/ollama/ollama/template"
@@ -77,9 +81,12 @@ var lowVRAMThreshold uint64 = 20 * format.GibiByte
 var mode string = gin.DebugMode
 
 type Server struct {
-	addr    net.Addr
-	sched   *Scheduler
-	lowVRAM bool
+	addr     net.Addr
+	sched    *Scheduler
+	lowVRAM  bool
+	sessions *session.Store
+	audit    *audit.Log
+	limits   *quota.Limiter
 }
 
 func init() {
@@ -127,6 +134,10 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []model.C
 		return nil, nil, nil, err
 	}
 
+	if err := checkTrust(model); err != nil {
+		return nil, nil, nil, err
+	}
+
 	if slices.Contains(model.Config.ModelFamilies, "mllama") && len(model.ProjectorPaths) > 0 {
 		return nil, nil, nil, fmt.Errorf("'llama3.2-vision' is no longer compatible with your version of Ollama and has been replaced by a newer version. To re-download, run 'ollama pull llama3.2-vision'")
 	}
@@ -226,6 +237,11 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			return
 		}
 
+		if err := security.CheckOutbound(remoteURL.Host); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
 		req.Model = m.Config.RemoteModel
 
 		if req.Template == "" && m.Template.String() != "" {
@@ -576,6 +592,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			}
 		}
 	}()
+	ch = s.auditStream(c, audit.Record{Event: audit.EventGenerate, Model: m.ShortName, Digest: m.Digest}, ch)
 
 	if req.Stream != nil && !*req.Stream {
 		var r api.GenerateResponse
@@ -834,6 +851,11 @@ func (s *Server) PullHandler(c *gin.Context) {
 		return
 	}
 
+	if err := security.CheckOutbound(name.Host); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	name, err = getExistingName(name)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -858,6 +880,7 @@ func (s *Server) PullHandler(c *gin.Context) {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
+	ch = s.auditStream(c, audit.Record{Event: audit.EventPull, Model: name.DisplayShortest()}, ch)
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -889,6 +912,12 @@ func (s *Server) PushHandler(c *gin.Context) {
 		return
 	}
 
+	name := model.ParseName(mname)
+	if err := security.CheckOutbound(name.Host); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
@@ -913,6 +942,7 @@ func (s *Server) PushHandler(c *gin.Context) {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
+	ch = s.auditStream(c, audit.Record{Event: audit.EventPush, Model: name.DisplayShortest()}, ch)
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -983,12 +1013,13 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 		return
 	}
 
-	if err := m.Remove(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	err = m.Remove()
+	if err == nil {
+		err = m.RemoveLayers()
 	}
 
-	if err := m.RemoveLayers(); err != nil {
+	s.auditRequest(c, audit.Record{Event: audit.EventDelete, Model: n.DisplayShortest(), Digest: m.digest}, err)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1015,7 +1046,7 @@ func (s *Server) ShowHandler(c *gin.Context) {
 		return
 	}
 
-	resp, err := GetModelInfo(req)
+	resp, err := GetModelInfo(req, canReadEncryptedLayers(c))
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
@@ -1031,7 +1062,9 @@ func (s *Server) ShowHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
+// GetModelInfo describes the model req names. Encrypted layers are shown as
+// a placeholder unless showEncrypted is set.
+func GetModelInfo(req api.ShowRequest, showEncrypted bool) (*api.ShowResponse, error) {
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		return nil, ErrModelPathInvalid
@@ -1055,6 +1088,12 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		QuantizationLevel: m.Config.FileType,
 	}
 
+	// capabilities depend on the template, so are found before redacting it
+	capabilities := m.Capabilities()
+	if !showEncrypted {
+		m.redactEncrypted()
+	}
+
 	if req.System != "" {
 		m.System = req.System
 	}
@@ -1075,7 +1114,7 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		Template:     m.Template.String(),
 		Details:      modelDetails,
 		Messages:     msgs,
-		Capabilities: m.Capabilities(),
+		Capabilities: capabilities,
 		ModifiedAt:   manifest.fi.ModTime(),
 	}
 
@@ -1114,6 +1153,9 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		}
 	}
 	resp.Parameters = strings.Join(params, "\n")
+	if !showEncrypted && slices.Contains(m.encrypted, "application/vnd.ollama.image.params") {
+		resp.Parameters = encryptedPlaceholder
+	}
 
 	if len(req.Options) > 0 {
 		if m.Options == nil {
@@ -1129,6 +1171,16 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 	fmt.Fprintln(&sb, "# To build a new Modelfile based on this, replace FROM with:")
 	fmt.Fprintf(&sb, "# FROM %s\n\n", m.ShortName)
 	fmt.Fprint(&sb, m.String())
+	if !showEncrypted {
+		for _, mediatype := range m.encrypted {
+			switch mediatype {
+			case "application/vnd.ollama.image.params":
+				fmt.Fprintf(&sb, "# PARAMETER %s\n", encryptedPlaceholder)
+			case "application/vnd.ollama.image.messages":
+				fmt.Fprintf(&sb, "# MESSAGE %s\n", encryptedPlaceholder)
+			}
+		}
+	}
 	resp.Modelfile = sb.String()
 
 	// skip loading tensor information if this is a remote model
@@ -1269,7 +1321,10 @@ func (s *Server) CopyHandler(c *gin.Context) {
 		return
 	}
 
-	if err := CopyModel(src, dst); errors.Is(err, os.ErrNotExist) {
+	err = CopyModel(src, dst)
+	s.auditRequest(c, audit.Record{Event: audit.EventCopy, Model: src.DisplayShortest(), Target: dst.DisplayShortest(), Digest: manifestDigest(dst)}, err)
+
+	if errors.Is(err, os.ErrNotExist) {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Source)})
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -1439,6 +1494,8 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 		"User-Agent",
 		"Accept",
 		"X-Requested-With",
+		session.HeaderSession,
+		session.HeaderRequest,
 
 		// OpenAI compatibility headers
 		"OpenAI-Beta",
@@ -1457,11 +1514,39 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	}
 	corsConfig.AllowOrigins = envconfig.AllowedOrigins()
 
+	if s.sessions == nil {
+		s.sessions = session.NewStore(session.DefaultTTL)
+	}
+
+	socketUsers, err := socketAllowlist()
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := loadRedactor()
+	if err != nil {
+		return nil, err
+	}
+
+	outputPolicy, err := loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.limits, err = loadLimits(); err != nil {
+		return nil, err
+	}
+
+	keys := loadAPIKeys()
+
 	r := gin.Default()
 	r.HandleMethodNotAllowed = true
 	r.Use(
 		cors.New(corsConfig),
+		peerCredMiddleware(socketUsers),
 		allowedHostsMiddleware(s.addr),
+		apiKeyMiddleware(keys),
+		sessionMiddleware(s.sessions),
 	)
 
 	// General
@@ -1469,6 +1554,8 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "Ollama is running") })
 	r.HEAD("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
 	r.GET("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
+	r.GET("/api/security", s.SecurityHandler)
+	r.POST(session.Path, s.SessionHandler)
 
 	// Local model cache management (new implementation is at end of function)
 	r.POST("/api/pull", s.PullHandler)
@@ -1492,15 +1579,16 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 
 	// Inference
 	r.GET("/api/ps", s.PsHandler)
-	r.POST("/api/generate", s.GenerateHandler)
-	r.POST("/api/chat", s.ChatHandler)
-	r.POST("/api/embed", s.EmbedHandler)
-	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.GET("/api/usage", s.UsageHandler)
+	r.POST("/api/generate", quotaMiddleware(s.limits), policyMiddleware(outputPolicy, false), piiMiddleware(redactor, false), s.GenerateHandler)
+	r.POST("/api/chat", quotaMiddleware(s.limits), policyMiddleware(outputPolicy, true), piiMiddleware(redactor, true), s.ChatHandler)
+	r.POST("/api/embed", quotaMiddleware(s.limits), s.EmbedHandler)
+	r.POST("/api/embeddings", quotaMiddleware(s.limits), s.EmbeddingsHandler)
 
 	// Inference (OpenAI compatibility)
-	r.POST("/v1/chat/completions", middleware.ChatMiddleware(), s.ChatHandler)
-	r.POST("/v1/completions", middleware.CompletionsMiddleware(), s.GenerateHandler)
-	r.POST("/v1/embeddings", middleware.EmbeddingsMiddleware(), s.EmbedHandler)
+	r.POST("/v1/chat/completions", middleware.ChatMiddleware(), quotaMiddleware(s.limits), policyMiddleware(outputPolicy, true), piiMiddleware(redactor, true), s.ChatHandler)
+	r.POST("/v1/completions", middleware.CompletionsMiddleware(), quotaMiddleware(s.limits), policyMiddleware(outputPolicy, false), piiMiddleware(redactor, false), s.GenerateHandler)
+	r.POST("/v1/embeddings", middleware.EmbeddingsMiddleware(), quotaMiddleware(s.limits), s.EmbedHandler)
 	r.GET("/v1/models", middleware.ListMiddleware(), s.ListHandler)
 	r.GET("/v1/models/:model", middleware.RetrieveMiddleware(), s.ShowHandler)
 
@@ -1513,16 +1601,22 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 
 			Prune: PruneLayers,
 		}
-		return rs, nil
+		return peerCredHandler(socketUsers, s.localRegistryHandler(keys, rs)), nil
 	}
 
 	return r, nil
 }
 
-func Serve(ln net.Listener) error {
+// Serve serves the API on every listener in lns, until interrupted
+func Serve(lns ...net.Listener) error {
 	slog.SetDefault(logutil.NewLogger(os.Stderr, envconfig.LogLevel()))
 	slog.Info("server config", "env", envconfig.Values())
 
+	if envconfig.StrictNetworkIsolation() {
+		security.InstallNetworkGuard()
+		slog.Info("strict network isolation enabled: outbound connections are limited to localhost")
+	}
+
 	blobsDir, err := GetBlobsPath("")
 	if err != nil {
 		return err
@@ -1551,7 +1645,7 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
-	s := &Server{addr: ln.Addr()}
+	s := &Server{addr: lns[0].Addr(), audit: openAuditLog()}
 
 	var rc *ollama.Registry
 	if useClient2 {
@@ -1572,9 +1666,12 @@ func Serve(ln net.Listener) error {
 	ctx, done := context.WithCancel(context.Background())
 	schedCtx, schedDone := context.WithCancel(ctx)
 	sched := InitScheduler(schedCtx)
+	sched.audit = s.audit
 	s.sched = sched
 
-	slog.Info(fmt.Sprintf("Listening on %s (version %s)", ln.Addr(), version.Version))
+	for _, ln := range lns {
+		slog.Info(fmt.Sprintf("Listening on %s (version %s)", ln.Addr(), version.Version))
+	}
 	srvr := &http.Server{
 		// Use http.DefaultServeMux so we get net/http/pprof for
 		// free.
@@ -1585,6 +1682,8 @@ func Serve(ln net.Listener) error {
 		// and easy way to get pprof, but it may not be the best
 		// way.
 		Handler: nil,
+		// Unix socket connections carry the caller's credentials
+		ConnContext: connContext,
 	}
 
 	// listen for a ctrl+c and stop any loaded llm
@@ -1618,13 +1717,22 @@ func Serve(ln net.Listener) error {
 		slog.Info("entering low vram mode", "total vram", format.HumanBytes2(totalVRAM), "threshold", format.HumanBytes2(lowVRAMThreshold))
 	}
 
-	err = srvr.Serve(ln)
+	errCh := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func() { errCh <- srvr.Serve(ln) }()
+	}
+
+	err = <-errCh
 	// If server is closed from the signal handler, wait for the ctx to be done
 	// otherwise error out quickly
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	<-ctx.Done()
+
+	if err := security.Shutdown(); err != nil {
+		slog.Warn("failed to wipe encryption keys", "error", err)
+	}
 	return nil
 }
 
@@ -1713,6 +1821,11 @@ func (s *Server) WhoamiHandler(c *gin.Context) {
 		return
 	}
 
+	if err := security.CheckOutbound(u.Host); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	client := api.NewClient(u, http.DefaultClient)
 	user, err := client.Whoami(c)
 	if err != nil {
@@ -1753,6 +1866,11 @@ func (s *Server) SignoutHandler(c *gin.Context) {
 		return
 	}
 
+	if err := security.CheckOutbound(u.Host); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	client := api.NewClient(u, http.DefaultClient)
 	err = client.Disconnect(c, encKey)
 	if err != nil {
@@ -1878,6 +1996,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			return
 		}
 
+		if err := security.CheckOutbound(remoteURL.Host); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
 		req.Model = m.Config.RemoteModel
 		if req.Options == nil {
 			req.Options = map[string]any{}
@@ -2231,6 +2354,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			break
 		}
 	}()
+	ch = s.auditStream(c, audit.Record{Event: audit.EventChat, Model: m.ShortName, Digest: m.Digest}, ch)
 
 	if req.Stream != nil && !*req.Stream {
 		var resp api.ChatResponse
@@ -2287,6 +2411,8 @@ func handleScheduleError(c *gin.Context, name string, err error) {
 		c.JSON(499, gin.H{"error": "request canceled"})
 	case errors.Is(err, ErrMaxQueue):
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, errUntrusted):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 	case errors.Is(err, os.ErrNotExist):
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found, try pulling it first", name)})
 	default:
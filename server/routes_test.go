@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -13,6 +14,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -27,6 +29,7 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/openai"
+	"github.com/ollama/ollama/security"
 	"github.com/ollama/ollama/server/internal/client/ollama"
 	"github.com/ollama/ollama/types/model"
 	"github.com/ollama/ollama/version"
@@ -561,6 +564,7 @@ func casingShuffle(s string) string {
 
 func TestManifestCaseSensitivity(t *testing.T) {
 	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "false")
 
 	r := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -686,6 +690,39 @@ func TestManifestCaseSensitivity(t *testing.T) {
 	}
 }
 
+func TestNetworkIsolation(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("SECLLAMA_STRICT_NETWORK_ISOLATION", "true")
+
+	// nothing may be dialed
+	testMakeRequestDialContext = func(context.Context, string, string) (net.Conn, error) {
+		t.Fatal("unexpected dial")
+		return nil, nil
+	}
+	t.Cleanup(func() { testMakeRequestDialContext = nil })
+
+	var s Server
+	cases := map[string]*httptest.ResponseRecorder{
+		"pull":   createRequest(t, s.PullHandler, api.PullRequest{Model: "example.com/library/test"}),
+		"push":   createRequest(t, s.PushHandler, api.PushRequest{Model: "example.com/library/test"}),
+		"whoami": createRequest(t, s.WhoamiHandler, nil),
+	}
+
+	for name, w := range cases {
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: code = %d, want 403", name, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "SECLLAMA_STRICT_NETWORK_ISOLATION") {
+			t.Errorf("%s: unexpected body %s", name, w.Body.String())
+		}
+	}
+
+	// and so does anything else that goes through makeRequest
+	if _, err := makeRequest(t.Context(), http.MethodGet, &url.URL{Scheme: "http", Host: "example.com"}, nil, nil, nil); !errors.Is(err, security.ErrNetworkIsolated) {
+		t.Errorf("expected ErrNetworkIsolated, got %v", err)
+	}
+}
+
 func TestShow(t *testing.T) {
 	t.Setenv("OLLAMA_MODELS", t.TempDir())
 
@@ -20,6 +20,7 @@ import (
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/security/audit"
 	"github.com/ollama/ollama/types/model"
 )
 
@@ -54,6 +55,9 @@ type Scheduler struct {
 	getGpuFn        func(ctx context.Context, runners []ml.FilteredRunnerDiscovery) []ml.DeviceInfo
 	getSystemInfoFn func() ml.SystemInfo
 	waitForRecovery time.Duration
+
+	// audit records model loads and unloads; nil disables auditing
+	audit *audit.Log
 }
 
 // Default automatic value for number of models we allow per GPU
@@ -345,9 +349,11 @@ func (s *Scheduler) processCompleted(ctx context.Context) {
 					runnersSnapshot = append(runnersSnapshot, r)
 				}
 				finished := s.waitForVRAMRecovery(runner, runnersSnapshot)
+				m := runner.model
 				runner.unload()
 				delete(s.loaded, runner.modelPath)
 				s.loadedMu.Unlock()
+				s.auditRunner(audit.EventUnload, m, 0, nil)
 				slog.Debug("runner terminated and removed from list, blocking for VRAM recovery", "runner", runner)
 				<-finished
 				runner.refMu.Unlock()
@@ -430,6 +436,7 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo
 
 	s.loadedMu.Unlock()
 
+	start := time.Now()
 	gpuIDs, err := llama.Load(req.ctx, systemInfo, gpus, requireFull)
 	if err != nil {
 		if errors.Is(err, llm.ErrLoadRequiredFull) {
@@ -446,6 +453,7 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo
 		slog.Info("Load failed", "model", req.model.ModelPath, "error", err)
 		s.activeLoading.Close()
 		s.activeLoading = nil
+		s.auditRunner(audit.EventLoad, req.model, time.Since(start), err)
 		req.errCh <- err
 		return false
 	}
@@ -497,12 +505,14 @@ iGPUScan:
 		defer runner.refMu.Unlock()
 		if err = llama.WaitUntilRunning(req.ctx); err != nil {
 			slog.Error("error loading llama server", "error", err)
+			s.auditRunner(audit.EventLoad, req.model, time.Since(start), err)
 			req.errCh <- err
 			slog.Debug("triggering expiration for failed load", "runner", runner)
 			s.expiredCh <- runner
 			return
 		}
 		slog.Debug("finished setting up", "runner", runner)
+		s.auditRunner(audit.EventLoad, req.model, time.Since(start), nil)
 		if runner.pid < 0 {
 			runner.pid = llama.Pid()
 		}
@@ -727,11 +737,18 @@ func (runner *runnerRef) LogValue() slog.Value {
 }
 
 // Implements discover.RunnerDiscovery
-func (runner *runnerRef) GetPort() int {
+func (runner *runnerRef) GetSocket() string {
+	if runner.llama != nil {
+		return runner.llama.GetSocket()
+	}
+	return ""
+}
+
+func (runner *runnerRef) GetSecret() string {
 	if runner.llama != nil {
-		return runner.llama.GetPort()
+		return runner.llama.GetSecret()
 	}
-	return -1
+	return ""
 }
 
 func (runner *runnerRef) GetDeviceInfos(ctx context.Context) []ml.DeviceInfo {
@@ -819,10 +836,20 @@ func (s *Scheduler) unloadAllRunners() {
 		if runner.llama != nil {
 			slog.Debug("shutting down runner", "model", model)
 			runner.llama.Close()
+			s.auditRunner(audit.EventUnload, runner.model, 0, nil)
 		}
 	}
 }
 
+// auditRunner records a model load or unload in the audit log
+func (s *Scheduler) auditRunner(event string, m *Model, d time.Duration, err error) {
+	if s.audit == nil || m == nil {
+		return
+	}
+
+	appendAudit(s.audit, audit.Record{Event: event, Model: m.ShortName, Digest: m.Digest, Duration: d}, err)
+}
+
 func (s *Scheduler) expireRunner(model *Model) {
 	s.loadedMu.Lock()
 	runner, ok := s.loaded[model.ModelPath]
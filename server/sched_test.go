@@ -800,7 +800,8 @@ func (s *mockLlm) VRAMSize() uint64                                   { return s
 func (s *mockLlm) TotalSize() uint64                                  { return s.totalSize }
 func (s *mockLlm) VRAMByGPU(id ml.DeviceID) uint64                    { return s.vramByGPU[id] }
 func (s *mockLlm) Pid() int                                           { return -1 }
-func (s *mockLlm) GetPort() int                                       { return -1 }
+func (s *mockLlm) GetSocket() string                                  { return "" }
+func (s *mockLlm) GetSecret() string                                  { return "" }
 func (s *mockLlm) GetDeviceInfos(ctx context.Context) []ml.DeviceInfo { return nil }
 func (s *mockLlm) HasExited() bool                                    { return false }
 func (s *mockLlm) GetActiveDeviceIDs() []ml.DeviceID                  { return nil }
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/security"
+)
+
+// probeSandbox launches a sandboxed probe runner; replaced in tests
+var probeSandbox = llm.ProbeSandbox
+
+// probeCacheTTL is how long the result of a sandbox probe is reused. Each
+// probe starts a runner, which GET /api/security must not do on every request.
+const probeCacheTTL = 5 * time.Minute
+
+// sandboxProbe runs one sandbox probe at a time and reuses its result for ttl
+type sandboxProbe struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	report *security.ProbeReport
+	err    error
+	at     time.Time
+}
+
+var sandboxProbes = &sandboxProbe{ttl: probeCacheTTL}
+
+// run returns the result of the last probe if it finished less than ttl ago,
+// or else probes. Callers arriving during a probe wait for its result.
+func (p *sandboxProbe) run(ctx context.Context) (*security.ProbeReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.at.IsZero() && time.Since(p.at) < p.ttl {
+		return p.report, p.err
+	}
+
+	report, err := probeSandbox(ctx, sandboxProbeTargets())
+	if ctx.Err() != nil {
+		// a probe cut short by its request says nothing about the sandbox
+		return report, err
+	}
+
+	p.report, p.err, p.at = report, err, time.Now()
+	return report, err
+}
+
+func (s *Server) SecurityHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, securityStatus(c.Request.Context()))
+}
+
+// securityStatus measures which security mechanisms are actually in effect:
+// the key store is opened, a message is encrypted and decrypted, and a probe
+// runner is started in the runner sandbox to try to escape it. The probe's
+// result is reused for probeCacheTTL.
+func securityStatus(ctx context.Context) api.SecurityResponse {
+	var resp api.SecurityResponse
+	add := func(category, name string, passed bool, detail string) {
+		resp.Checks = append(resp.Checks, api.SecurityCheck{Category: category, Name: name, Passed: passed, Detail: detail})
+	}
+
+	mgr, err := security.GetManager()
+	if err != nil {
+		add("keystore", "open", false, err.Error())
+	} else {
+		resp.KeyStore = mgr.KeyStoreBackend()
+		add("keystore", "open", true, resp.KeyStore)
+	}
+
+	switch {
+	case !envconfig.EnableEncryption():
+		add("encryption", "messages", false, "disabled by SECLLAMA_ENABLE_ENCRYPTION")
+	case mgr == nil:
+		add("encryption", "messages", false, "no encryption key available")
+	default:
+		add("encryption", "messages", true, "AES-256-GCM, key "+mgr.KeyID())
+		if err := encryptionRoundTrip(mgr); err != nil {
+			add("encryption", "round trip", false, err.Error())
+		} else {
+			add("encryption", "round trip", true, "")
+		}
+	}
+
+	if !envconfig.EnableSandbox() {
+		add("sandbox", "runner sandbox", false, "disabled by SECLLAMA_ENABLE_SANDBOX")
+	} else {
+		add("sandbox", "runner sandbox", true, "enabled")
+	}
+
+	report, err := sandboxProbes.run(ctx)
+	if err != nil {
+		add("probe", "probe runner", false, err.Error())
+	} else {
+		for _, r := range report.Isolation {
+			add("sandbox", r.Name, r.Passed, r.Detail)
+		}
+		for _, r := range report.Probes {
+			add("probe", r.Name, r.Passed, r.Detail)
+		}
+	}
+
+	resp.Passed = true
+	for _, check := range resp.Checks {
+		resp.Passed = resp.Passed && check.Passed
+	}
+
+	return resp
+}
+
+// encryptionRoundTrip checks that a message encrypted with the active key
+// decrypts to itself
+func encryptionRoundTrip(mgr *security.Manager) error {
+	const plaintext = "secllama security check"
+
+	ciphertext, err := mgr.EncryptMessage(plaintext)
+	if err != nil {
+		return err
+	}
+
+	if ciphertext == plaintext {
+		return fmt.Errorf("message was not encrypted")
+	}
+
+	decrypted, err := mgr.DecryptMessage(ciphertext)
+	if err != nil {
+		return err
+	}
+
+	if decrypted != plaintext {
+		return fmt.Errorf("decrypted message does not match")
+	}
+
+	return nil
+}
+
+// sandboxProbeTargets are the server's own API and the files holding keys,
+// history and models, none of which a runner should be able to reach
+func sandboxProbeTargets() security.ProbeTargets {
+	denied := []string{envconfig.Models(), "/etc/passwd"}
+	if home, err := os.UserHomeDir(); err == nil {
+		denied = append(denied, filepath.Join(home, ".secllama"), filepath.Join(home, ".ssh"))
+	}
+
+	return security.DefaultProbeTargets(envconfig.Host().Host, denied...)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/security"
+)
+
+func TestSecurityStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SECLLAMA_KEYSTORE", "file")
+	t.Setenv("SECLLAMA_KEYSTORE_PASSPHRASE", "correct horse battery staple")
+	t.Setenv("SECLLAMA_ENABLE_ENCRYPTION", "true")
+	t.Setenv("SECLLAMA_ENABLE_SANDBOX", "true")
+
+	report := &security.ProbeReport{
+		Isolation: []security.ProbeResult{{Name: "network namespace", Passed: true}},
+		Probes:    []security.ProbeResult{{Name: "outbound tcp", Passed: true}},
+	}
+
+	var probeErr error
+	probeSandbox = func(context.Context, security.ProbeTargets) (*security.ProbeReport, error) {
+		return report, probeErr
+	}
+	t.Cleanup(func() { probeSandbox = llm.ProbeSandbox })
+
+	// probe every time, so each case sees its own result
+	sandboxProbes = &sandboxProbe{}
+	t.Cleanup(func() { sandboxProbes = &sandboxProbe{ttl: probeCacheTTL} })
+
+	t.Run("passed", func(t *testing.T) {
+		resp := securityStatus(t.Context())
+		if !resp.Passed {
+			t.Fatalf("expected all checks to pass: %+v", resp.Checks)
+		}
+		if resp.KeyStore != "file" {
+			t.Errorf("expected file keystore, got %q", resp.KeyStore)
+		}
+
+		names := map[string]bool{}
+		for _, check := range resp.Checks {
+			names[check.Category+"/"+check.Name] = true
+		}
+		for _, name := range []string{"keystore/open", "encryption/round trip", "sandbox/network namespace", "probe/outbound tcp"} {
+			if !names[name] {
+				t.Errorf("missing check %s", name)
+			}
+		}
+	})
+
+	t.Run("escaped", func(t *testing.T) {
+		report.Probes[0].Passed = false
+		t.Cleanup(func() { report.Probes[0].Passed = true })
+
+		if resp := securityStatus(t.Context()); resp.Passed {
+			t.Fatal("expected failing probe to fail the report")
+		}
+	})
+
+	t.Run("probe error", func(t *testing.T) {
+		probeErr = errors.New("runner crashed")
+		t.Cleanup(func() { probeErr = nil })
+
+		if resp := securityStatus(t.Context()); resp.Passed {
+			t.Fatal("expected probe error to fail the report")
+		}
+	})
+
+	t.Run("sandbox disabled", func(t *testing.T) {
+		t.Setenv("SECLLAMA_ENABLE_SANDBOX", "false")
+
+		if resp := securityStatus(t.Context()); resp.Passed {
+			t.Fatal("expected disabled sandbox to fail the report")
+		}
+	})
+}
+
+func TestSandboxProbeCache(t *testing.T) {
+	var probes atomic.Int32
+	probeSandbox = func(context.Context, security.ProbeTargets) (*security.ProbeReport, error) {
+		probes.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return &security.ProbeReport{}, nil
+	}
+	t.Cleanup(func() { probeSandbox = llm.ProbeSandbox })
+
+	p := &sandboxProbe{ttl: time.Hour}
+
+	// concurrent requests share one probe
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.run(t.Context()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := probes.Load(); n != 1 {
+		t.Fatalf("expected 1 probe, got %d", n)
+	}
+
+	// until the result expires
+	p.at = time.Now().Add(-2 * time.Hour)
+	if _, err := p.run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if n := probes.Load(); n != 2 {
+		t.Fatalf("expected 2 probes, got %d", n)
+	}
+
+	// a probe whose request was canceled isn't reused
+	p = &sandboxProbe{ttl: time.Hour}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, _ = p.run(ctx)
+	if !p.at.IsZero() {
+		t.Fatal("expected the canceled probe not to be cached")
+	}
+}
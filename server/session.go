@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/session"
+)
+
+// plaintextPromptPaths carry prompts or model output, and are refused without
+// an encrypted session when SECLLAMA_REQUIRE_ENCRYPTED_TRANSPORT is set
+var plaintextPromptPaths = []string{
+	"/api/generate",
+	"/api/chat",
+	"/api/embed",
+	"/api/embeddings",
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+}
+
+func (s *Server) SessionHandler(c *gin.Context) {
+	var req session.HandshakeRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := s.sessions.Handshake(req)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// sessionMiddleware opens the sealed body of requests made in an encrypted
+// session and seals everything written in response, line by line
+func sessionMiddleware(store *session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(session.HeaderSession)
+		if id == "" {
+			// connections over TLS are encrypted already
+			if envconfig.RequireEncryptedTransport() && c.Request.TLS == nil && slices.Contains(plaintextPromptPaths, c.Request.URL.Path) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this server requires an encrypted session (SECLLAMA_REQUIRE_ENCRYPTED_TRANSPORT)"})
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		requestID := c.GetHeader(session.HeaderRequest)
+		if requestID == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing " + session.HeaderRequest + " header"})
+			return
+		}
+
+		key, err := store.Use(id, requestID)
+		if err != nil {
+			c.Header(session.HeaderError, err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// requests without data, such as GETs, have nothing sealed
+			if len(body) > 0 {
+				if body, err = key.Stream(session.Request, requestID).OpenAll(body); err != nil {
+					c.Header(session.HeaderError, err.Error())
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+
+		w := &sealedWriter{ResponseWriter: c.Writer}
+		w.sealer = session.NewWriter(w.ResponseWriter, key.Stream(session.Response, requestID))
+		c.Writer = w
+		c.Header(session.HeaderSession, id)
+
+		c.Next()
+
+		if err := w.sealer.Close(); err != nil {
+			slog.Warn("failed to seal response", "error", err)
+		}
+	}
+}
+
+// sealedWriter seals a response body line by line, so streamed NDJSON chunks
+// reach the client as they are produced
+type sealedWriter struct {
+	gin.ResponseWriter
+	sealer *session.Writer
+}
+
+func (w *sealedWriter) Write(b []byte) (int, error) {
+	// sealing changes the length of the body
+	w.Header().Del("Content-Length")
+	return w.sealer.Write(b)
+}
+
+func (w *sealedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/security/session"
+)
+
+// sessionTestServer serves a fake /api/generate, which streams the prompt back
+// word by word, behind the session middleware. Every request and response body
+// that crosses the wire is recorded.
+func sessionTestServer(t *testing.T) (*api.Client, *bytes.Buffer) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	s := &Server{sessions: session.NewStore(session.DefaultTTL)}
+
+	r := gin.New()
+	r.Use(sessionMiddleware(s.sessions))
+	r.POST(session.Path, s.SessionHandler)
+	r.GET("/api/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": "0.0.0"})
+	})
+	r.POST("/api/generate", func(c *gin.Context) {
+		var req api.GenerateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+			for _, word := range strings.Fields(req.Prompt) {
+				ch <- api.GenerateResponse{Model: req.Model, Response: word}
+			}
+			ch <- api.GenerateResponse{Model: req.Model, Done: true}
+		}()
+		streamResponse(c, ch)
+	})
+
+	var wire bytes.Buffer
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		wire.Write(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		r.ServeHTTP(&wireRecorder{ResponseWriter: w, wire: &wire}, req)
+	}))
+	t.Cleanup(ts.Close)
+
+	base, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api.NewClient(base, ts.Client()), &wire
+}
+
+// wireRecorder copies a response body to wire as it is written
+type wireRecorder struct {
+	http.ResponseWriter
+	wire *bytes.Buffer
+}
+
+func (w *wireRecorder) Write(b []byte) (int, error) {
+	w.wire.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *wireRecorder) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *wireRecorder) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify() //nolint:staticcheck
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	t.Setenv("SECLLAMA_TRANSPORT_ENCRYPTION", "required")
+	client, wire := sessionTestServer(t)
+
+	if _, err := client.Version(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var words []string
+	req := &api.GenerateRequest{Model: "test", Prompt: "the secret launch codes"}
+	if err := client.Generate(t.Context(), req, func(resp api.GenerateResponse) error {
+		if resp.Response != "" {
+			words = append(words, resp.Response)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(words, " "); got != req.Prompt {
+		t.Errorf("expected %q, got %q", req.Prompt, got)
+	}
+
+	for _, word := range []string{"secret", "launch", "codes", "0.0.0"} {
+		if bytes.Contains(wire.Bytes(), []byte(word)) {
+			t.Errorf("%q crossed the wire in plaintext", word)
+		}
+	}
+}
+
+func TestSessionRequired(t *testing.T) {
+	t.Setenv("SECLLAMA_REQUIRE_ENCRYPTED_TRANSPORT", "true")
+	client, _ := sessionTestServer(t)
+
+	// metadata endpoints stay available without a session
+	if _, err := client.Version(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.Generate(t.Context(), &api.GenerateRequest{Model: "test", Prompt: "hello"}, func(api.GenerateResponse) error { return nil })
+	var statusErr api.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a plaintext prompt, got %v", err)
+	}
+}
+
+func TestSessionRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := session.NewStore(session.DefaultTTL)
+	s := &Server{sessions: store}
+
+	r := gin.New()
+	r.Use(sessionMiddleware(store))
+	r.POST(session.Path, s.SessionHandler)
+	r.POST("/api/generate", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	private, err := session.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := private.PublicKey().Bytes()
+
+	body, _ := json.Marshal(session.HandshakeRequest{PublicKey: public})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, session.Path, bytes.NewReader(body)))
+
+	var hr session.HandshakeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &hr); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := session.DeriveKey(hr.SessionID, private, public, hr.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestID := session.NewRequestID()
+	stream := key.Stream(session.Request, requestID)
+	sealed := append(stream.Seal([]byte(`{"model":"test"}`)), '\n')
+	sealed = append(append(sealed, stream.SealEnd()...), '\n')
+
+	send := func(sessionID string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/generate", bytes.NewReader(body))
+		req.Header.Set(session.HeaderSession, sessionID)
+		req.Header.Set(session.HeaderRequest, requestID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(hr.SessionID, sealed); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := send(hr.SessionID, sealed); w.Code != http.StatusUnauthorized || w.Header().Get(session.HeaderError) == "" {
+		t.Errorf("expected replay to be rejected, got %d", w.Code)
+	}
+
+	if w := send("unknown", sealed); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unknown session to be rejected, got %d", w.Code)
+	}
+
+	requestID = session.NewRequestID()
+	if w := send(hr.SessionID, []byte(`{"model":"test"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected unsealed body to be rejected, got %d", w.Code)
+	}
+
+	requestID = session.NewRequestID()
+	truncated := append(key.Stream(session.Request, requestID).Seal([]byte(`{"model":"test"}`)), '\n')
+	if w := send(hr.SessionID, truncated); w.Code != http.StatusBadRequest {
+		t.Errorf("expected body without its end record to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security"
+)
+
+// ListenUnix opens the server's Unix socket at path. The socket is only
+// accessible to the user running the server, unless SECLLAMA_SOCKET_USERS
+// admits other users, in which case anyone may connect and the peer
+// credentials of each connection decide.
+func ListenUnix(path string) (net.Listener, error) {
+	allowed, err := socketAllowlist()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	// a stale socket from a previous server would make bind fail, but a live
+	// one belongs to a server that is still running
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := os.FileMode(0o600)
+	if len(allowed) > 1 {
+		mode = 0o666
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// socketAllowlist returns the uids allowed to use the server's Unix socket:
+// the user running the server and those in SECLLAMA_SOCKET_USERS
+func socketAllowlist() (map[uint32]bool, error) {
+	allowed := map[uint32]bool{uint32(os.Getuid()): true}
+	for _, name := range envconfig.SocketUsers() {
+		uid, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return nil, fmt.Errorf("SECLLAMA_SOCKET_USERS: %w", err)
+			}
+
+			if uid, err = strconv.ParseUint(u.Uid, 10, 32); err != nil {
+				return nil, fmt.Errorf("SECLLAMA_SOCKET_USERS: %s has no numeric uid", name)
+			}
+		}
+
+		allowed[uint32(uid)] = true
+	}
+
+	return allowed, nil
+}
+
+type peerCredKey struct{}
+
+// peerCred is attached to the context of requests made over a Unix socket
+type peerCred struct {
+	cred *security.PeerCred
+	err  error
+}
+
+// connContext records the peer credentials of Unix socket connections in
+// the context of every request made over them
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	cred, err := security.PeerCredentials(conn)
+	return context.WithValue(ctx, peerCredKey{}, peerCred{cred, err})
+}
+
+// peerCredFromContext returns the credentials of the process that made a
+// request over the server's Unix socket. ok is false for other requests.
+func peerCredFromContext(ctx context.Context) (cred *security.PeerCred, ok bool) {
+	p, ok := ctx.Value(peerCredKey{}).(peerCred)
+	return p.cred, ok && p.cred != nil
+}
+
+// peerCredMiddleware refuses requests made over a Unix socket by users not
+// in allowed. Requests over TCP are passed through.
+func peerCredMiddleware(allowed map[uint32]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status, err := checkPeerCred(allowed, c.Request); err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// peerCredHandler applies peerCredMiddleware's check to requests next serves
+// without going through the gin router, like those registry.Local handles
+// itself
+func peerCredHandler(allowed map[uint32]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, err := checkPeerCred(allowed, r); err != nil {
+			writeError(w, status, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkPeerCred returns the status and error to refuse r with if it was made
+// over a Unix socket by a user not in allowed
+func checkPeerCred(allowed map[uint32]bool, r *http.Request) (int, error) {
+	p, ok := r.Context().Value(peerCredKey{}).(peerCred)
+	if !ok {
+		return 0, nil
+	}
+
+	if errors.Is(p.err, errors.ErrUnsupported) && len(allowed) == 1 {
+		// the socket's file mode already restricts it to our own user
+		return 0, nil
+	} else if p.err != nil {
+		slog.Warn("failed to read peer credentials", "error", p.err)
+		return http.StatusForbidden, errors.New("unable to identify the caller")
+	}
+
+	if !allowed[p.cred.UID] {
+		slog.Warn("refused unix socket request", "uid", p.cred.UID, "pid", p.cred.PID, "path", r.URL.Path)
+		return http.StatusForbidden, fmt.Errorf("uid %d is not allowed to use this server", p.cred.UID)
+	}
+
+	return 0, nil
+}
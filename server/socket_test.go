@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// socketTestServer serves /api/version behind the peer credential middleware
+// on a Unix socket, and returns a client for it
+func socketTestServer(t *testing.T, allowed map[uint32]bool) *api.Client {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(peerCredMiddleware(allowed))
+	r.GET("/api/version", func(c *gin.Context) {
+		cred, ok := peerCredFromContext(c.Request.Context())
+		if !ok || int(cred.UID) != os.Getuid() || int(cred.PID) != os.Getpid() {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "missing peer credentials"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"version": "0.0.0"})
+	})
+
+	socket := filepath.Join(t.TempDir(), "secllama.sock")
+	l, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: r, ConnContext: connContext}
+	go srv.Serve(l) //nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+
+	t.Setenv("OLLAMA_HOST", "unix://"+socket)
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPeerCredMiddleware(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED is Linux only")
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		client := socketTestServer(t, map[uint32]bool{uint32(os.Getuid()): true})
+		if _, err := client.Version(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		client := socketTestServer(t, map[uint32]bool{uint32(os.Getuid()) + 1: true})
+		_, err := client.Version(t.Context())
+
+		var statusErr api.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected 403, got %v", err)
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		r := gin.New()
+		r.Use(peerCredMiddleware(map[uint32]bool{}))
+		r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		ctx := connContext(context.Background(), &net.TCPConn{})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+}
+
+func TestListenUnix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "secllama.sock")
+
+	l, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("expected mode 0600, got %o", mode)
+	}
+
+	if _, err := ListenUnix(socket); err == nil {
+		t.Error("expected an error for a socket in use")
+	}
+
+	// leave a stale socket behind, as a crashed server would
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = ListenUnix(socket)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	l.Close()
+
+	notSocket := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ListenUnix(notSocket); err == nil {
+		t.Error("expected an error for a path that is not a socket")
+	}
+}
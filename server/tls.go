@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/security/certs"
+)
+
+// ListenTLS listens on addr for connections over TLS, with the server
+// certificate in SECLLAMA_TLS_DIR, issued by its CA on first use. With
+// SECLLAMA_TLS_CLIENT_AUTH, clients must present a certificate issued by the
+// same CA.
+func ListenTLS(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, clientAuth := envconfig.TLSDir(), envconfig.TLSClientAuth()
+	cfg, err := certs.ServerConfig(dir, certs.Hosts(host), clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := cfg.Certificates[0]
+	slog.Info("tls enabled", "dir", dir, "client_auth", clientAuth,
+		"fingerprint", certs.Fingerprint(leaf.Certificate[0]),
+		"ca_fingerprint", certs.Fingerprint(leaf.Certificate[len(leaf.Certificate)-1]))
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewListener(ln, cfg), nil
+}
+
+// clientCertName returns the common name of the certificate the client of r
+// presented, if any
+func clientCertName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName, true
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// Manifests are signed over their signing digest, the SHA-256 of the config
+// and layers of the manifest as this package encodes them, rather than of the
+// manifest file. A model keeps its signatures when it is copied or goes
+// through a bundle, both of which rewrite the manifest file. Signatures are
+// stored by signing digest in the signatures directory next to the manifests.
+//
+// The signed message is prefixed so a signature over a manifest can never be
+// mistaken for one of the registry challenges signed with the same key.
+const manifestSignaturePrefix = "secllama-manifest-v1:"
+
+var errUntrusted = errors.New("model is not signed by a trusted key")
+
+// ManifestSignature is a detached ed25519 signature over a manifest
+type ManifestSignature struct {
+	// PublicKey is the signing key in authorized_keys format
+	PublicKey string    `json:"public_key"`
+	Signature string    `json:"signature"`
+	Time      time.Time `json:"time"`
+}
+
+// signingDigest returns the digest manifest signatures are made over
+func (m *Manifest) signingDigest() (string, error) {
+	data, err := json.Marshal(struct {
+		Config Layer   `json:"config"`
+		Layers []Layer `json:"layers"`
+	}{m.Config, m.Layers})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+func signaturesPath(digest string) (string, error) {
+	// validates digest
+	if _, err := GetBlobsPath(digest); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(envconfig.Models(), "signatures")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, strings.Replace(digest, ":", "-", 1)+".json"), nil
+}
+
+// readSignatures returns the signatures of the manifest with signing digest
+// digest, if any
+func readSignatures(digest string) ([]ManifestSignature, error) {
+	p, err := signaturesPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sigs []ManifestSignature
+	if err := json.Unmarshal(data, &sigs); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return sigs, nil
+}
+
+// addSignatures stores sigs with the manifest with signing digest digest,
+// replacing any earlier signatures by the same keys
+func addSignatures(digest string, sigs ...ManifestSignature) error {
+	existing, err := readSignatures(digest)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range sigs {
+		existing = slices.DeleteFunc(existing, func(e ManifestSignature) bool {
+			return e.PublicKey == sig.PublicKey
+		})
+		existing = append(existing, sig)
+	}
+
+	data, err := json.MarshalIndent(existing, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	p, err := signaturesPath(digest)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(p, data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// verify checks sig against the manifest with signing digest digest and
+// returns the key that made it
+func (sig ManifestSignature) verify(digest string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sig.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type() != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("unsupported key type %s", key.Type())
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := key.Verify([]byte(manifestSignaturePrefix+digest), &ssh.Signature{Format: ssh.KeyAlgoED25519, Blob: blob}); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// SignModel signs the manifest of model n with signer, which must be an
+// ed25519 key, and stores the signature
+func SignModel(n model.Name, signer ssh.Signer) (ManifestSignature, error) {
+	if signer.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		return ManifestSignature{}, fmt.Errorf("unsupported key type %s, manifests are signed with ed25519 keys", signer.PublicKey().Type())
+	}
+
+	n, err := getExistingName(n)
+	if err != nil {
+		return ManifestSignature{}, err
+	}
+
+	m, err := ParseNamedManifest(n)
+	if errors.Is(err, os.ErrNotExist) {
+		return ManifestSignature{}, fmt.Errorf("model %q not found", n.DisplayShortest())
+	} else if err != nil {
+		return ManifestSignature{}, err
+	}
+
+	digest, err := m.signingDigest()
+	if err != nil {
+		return ManifestSignature{}, err
+	}
+
+	signature, err := signer.Sign(nil, []byte(manifestSignaturePrefix+digest))
+	if err != nil {
+		return ManifestSignature{}, err
+	}
+
+	sig := ManifestSignature{
+		PublicKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))),
+		Signature: base64.StdEncoding.EncodeToString(signature.Blob),
+		Time:      time.Now().UTC(),
+	}
+
+	if err := addSignatures(digest, sig); err != nil {
+		return ManifestSignature{}, err
+	}
+
+	return sig, nil
+}
+
+// Trust policy modes
+const (
+	trustEnforce = "enforce"
+	trustWarn    = "warn"
+	trustOff     = "off"
+)
+
+// trustPolicy lists the keys trusted to sign models, per namespace. Keys are
+// looked up by "host/namespace", then "namespace", then "*"; the first entry
+// that exists is the only one used.
+type trustPolicy struct {
+	Mode       string              `json:"mode"`
+	Namespaces map[string][]string `json:"namespaces"`
+
+	keys map[string][]ssh.PublicKey
+}
+
+// loadTrustPolicy reads the trust policy named by SECLLAMA_TRUST_POLICY. It
+// returns nil if there is none.
+func loadTrustPolicy() (*trustPolicy, error) {
+	path := envconfig.TrustPolicy()
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var p trustPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("trust policy %s: %w", path, err)
+	}
+
+	switch p.Mode {
+	case "":
+		p.Mode = trustEnforce
+	case trustEnforce, trustWarn, trustOff:
+	default:
+		return nil, fmt.Errorf("trust policy %s: unknown mode %q", path, p.Mode)
+	}
+
+	p.keys = make(map[string][]ssh.PublicKey)
+	for namespace, keys := range p.Namespaces {
+		// an empty list trusts no keys for the namespace
+		p.keys[namespace] = []ssh.PublicKey{}
+		for _, k := range keys {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+			if err != nil {
+				return nil, fmt.Errorf("trust policy %s: namespace %q: %w", path, namespace, err)
+			}
+			p.keys[namespace] = append(p.keys[namespace], key)
+		}
+	}
+
+	return &p, nil
+}
+
+// trustedKeys returns the keys trusted to sign model n, and the policy entry
+// they come from
+func (p *trustPolicy) trustedKeys(n model.Name) (string, []ssh.PublicKey) {
+	for _, namespace := range []string{n.Host + "/" + n.Namespace, n.Namespace, "*"} {
+		if keys, ok := p.keys[namespace]; ok {
+			return namespace, keys
+		}
+	}
+
+	return "", nil
+}
+
+// checkTrust returns an error wrapping errUntrusted if the trust policy is
+// enforced and m isn't signed by a key the policy trusts for its namespace.
+// In warn mode the failure is logged instead. A policy that can't be read
+// fails every check, whatever its mode.
+func checkTrust(m *Model) error {
+	policy, err := loadTrustPolicy()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUntrusted, err)
+	}
+
+	if policy == nil || policy.Mode == trustOff {
+		return nil
+	}
+
+	err = verifyTrust(policy, model.ParseName(m.Name), m.signingDigest)
+	if err != nil && policy.Mode == trustWarn {
+		slog.Warn("loading untrusted model", "model", m.ShortName, "error", err)
+		return nil
+	}
+
+	return err
+}
+
+func verifyTrust(policy *trustPolicy, n model.Name, digest string) error {
+	namespace, trusted := policy.trustedKeys(n)
+	if len(trusted) == 0 {
+		return fmt.Errorf("%w: no keys are trusted for %s", errUntrusted, n.DisplayShortest())
+	}
+
+	sigs, err := readSignatures(digest)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUntrusted, err)
+	}
+
+	for _, sig := range sigs {
+		key, err := sig.verify(digest)
+		if err != nil {
+			slog.Debug("invalid manifest signature", "model", n.DisplayShortest(), "error", err)
+			continue
+		}
+
+		if slices.ContainsFunc(trusted, func(k ssh.PublicKey) bool {
+			return bytes.Equal(k.Marshal(), key.Marshal())
+		}) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s has no valid signature by a key trusted for %q", errUntrusted, n.DisplayShortest(), namespace)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func authorizedKey(signer ssh.Signer) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func writeTrustPolicy(t *testing.T, policy map[string]any) {
+	t.Helper()
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "trust.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SECLLAMA_TRUST_POLICY", path)
+}
+
+func TestCheckTrust(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("SECLLAMA_TRUST_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	for _, name := range []string{"signed", "unsigned"} {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{Model: name, Files: map[string]string{"test.gguf": digest}, System: name})
+		if w.Code != http.StatusOK {
+			t.Fatalf("create %s: %d %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	trusted, untrusted := newTestSigner(t), newTestSigner(t)
+	if _, err := SignModel(model.ParseName("signed"), trusted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignModel(model.ParseName("unsigned"), untrusted); err != nil {
+		t.Fatal(err)
+	}
+
+	// copies keep their signatures
+	if w := createRequest(t, s.CopyHandler, api.CopyRequest{Source: "signed", Destination: "copied"}); w.Code != http.StatusOK {
+		t.Fatalf("copy: %d %s", w.Code, w.Body.String())
+	}
+
+	cases := []struct {
+		name    string
+		policy  map[string]any
+		model   string
+		trusted bool
+	}{
+		{"no policy", nil, "unsigned", true},
+		{"signed", map[string]any{"namespaces": map[string]any{"library": []string{authorizedKey(trusted)}}}, "signed", true},
+		{"copied", map[string]any{"namespaces": map[string]any{"library": []string{authorizedKey(trusted)}}}, "copied", true},
+		{"untrusted key", map[string]any{"namespaces": map[string]any{"library": []string{authorizedKey(trusted)}}}, "unsigned", false},
+		{"host namespace", map[string]any{"namespaces": map[string]any{"registry.ollama.ai/library": []string{authorizedKey(untrusted)}, "*": []string{authorizedKey(trusted)}}}, "signed", false},
+		{"wildcard", map[string]any{"namespaces": map[string]any{"*": []string{authorizedKey(trusted)}}}, "signed", true},
+		{"other namespace", map[string]any{"namespaces": map[string]any{"team": []string{authorizedKey(trusted)}}}, "signed", false},
+		{"warn", map[string]any{"mode": "warn", "namespaces": map[string]any{"library": []string{authorizedKey(trusted)}}}, "unsigned", true},
+		{"off", map[string]any{"mode": "off"}, "unsigned", true},
+		{"invalid mode", map[string]any{"mode": "sometimes"}, "signed", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.policy != nil {
+				writeTrustPolicy(t, tt.policy)
+			}
+
+			err := checkTrust(mustGetModel(t, tt.model))
+			if tt.trusted && err != nil {
+				t.Fatalf("expected %s to be trusted, got %v", tt.model, err)
+			} else if !tt.trusted && !errors.Is(err, errUntrusted) {
+				t.Fatalf("expected errUntrusted, got %v", err)
+			}
+		})
+	}
+
+	t.Run("forged signature", func(t *testing.T) {
+		writeTrustPolicy(t, map[string]any{"namespaces": map[string]any{"library": []string{authorizedKey(trusted)}}})
+
+		m := mustGetModel(t, "unsigned")
+
+		// a signature by the trusted key over another manifest
+		sigs, err := readSignatures(mustGetModel(t, "signed").signingDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := addSignatures(m.signingDigest, sigs...); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := checkTrust(m); !errors.Is(err, errUntrusted) {
+			t.Fatalf("expected errUntrusted, got %v", err)
+		}
+	})
+}
+
+func mustGetModel(t *testing.T, name string) *Model {
+	t.Helper()
+	m, err := GetModel(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}